@@ -0,0 +1,225 @@
+package stineapi
+
+import (
+	"errors"
+	"sort"
+)
+
+// ErrNoRegistrationLink is returned, if a module has no registration link, which is the case if the user is already registered for it.
+var ErrNoRegistrationLink = errors.New("module has no registration link, the user may already be registered for it")
+
+// ErrDuplicateChoice is returned for a [PlanItem], whose choices contain the same module multiple times e.g. to select different groups of it.
+var ErrDuplicateChoice = errors.New("plan item contains the same module multiple times, events of a module cannot be selected")
+
+/*
+PlanChoice represents a module, which can be selected for a [PlanItem].
+
+STiNE registers for a whole module, events like exercise groups cannot be selected. Groups can only be used as fallbacks,
+if STiNE lists every group as a separate module.
+*/
+type PlanChoice struct {
+	Module   Module   // Module to register for, ideally retrieved with GetCategories
+	ExamDate ExamDate // Exam date to select, see [ModuleRegistration.SetExamDate]
+}
+
+/*
+PlanItem represents something a user wants to be registered for e.g. an exercise group.
+The first choice is preferred, the following choices are fallbacks, which are tried in order if a registration fails e.g. "group 2, else group 4".
+*/
+type PlanItem struct {
+	Name     string       // Name of the item, only used to identify it in the report
+	Priority int          // Items with a lower priority are registered first
+	Choices  []PlanChoice // Preferred choice, followed by the fallbacks
+}
+
+/*
+RegistrationPlan represents multiple registrations, which should be executed by [Session.RegisterMany].
+*/
+type RegistrationPlan struct {
+	Items       []PlanItem
+	DryRun      bool                                      // If true, every registration is only resolved and nothing is submitted
+	TanCallback func(tanReq *TanRequired) (string, error) // Called, if an iTAN is required, should return the iTAN
+}
+
+// PlanStatus represents the outcome of a [PlanItem].
+type PlanStatus int
+
+const (
+	PlanResolved    PlanStatus = iota // Registration was resolved on a dry run and can be submitted
+	PlanRegistered                    // User was registered
+	PlanFailed                        // Registration failed for every choice
+	PlanTanRequired                   // Registration requires an iTAN, which was not provided, the run was stopped
+	PlanSkipped                       // Item was not processed, as the run was stopped before
+	PlanUnknown                       // Registration was submitted, but failed afterwards e.g. with a network error, the user may be registered
+)
+
+// PlanResult represents the outcome of a single [PlanItem] of a [RegistrationPlan].
+type PlanResult struct {
+	Item           PlanItem
+	Status         PlanStatus
+	Choice         int          // Index of the choice, which was registered, resolved or submitted with an unknown outcome, -1 if none
+	RegistrationId string       // Registration id of the choice, which was resolved on a dry run
+	Tan            *TanRequired // Not nil, if the status is PlanTanRequired
+	Err            error        // Error of the last failed choice
+}
+
+// resolves the registration of the choice without submitting it
+func (session *Session) resolveChoice(choice PlanChoice) (string, error) {
+	if choice.Module.RegistrationLink == "" {
+		return "", ErrNoRegistrationLink
+	}
+
+	modReg := session.RegisterForModule(choice.Module)
+	// an exam date, which is rejected on a real run, should not be resolved
+	err := modReg.SetExamDate(choice.ExamDate)
+	if err != nil {
+		return "", err
+	}
+	err = modReg.Prepare()
+	if err != nil {
+		return "", err
+	}
+	return modReg.registrationId, nil
+}
+
+// hasDuplicateChoice checks, if a module is listed multiple times as a choice of the item
+func hasDuplicateChoice(item PlanItem) bool {
+	seen := map[string]bool{}
+	for _, choice := range item.Choices {
+		link := choice.Module.RegistrationLink
+		if link == "" {
+			continue
+		}
+		if seen[link] {
+			return true
+		}
+		seen[link] = true
+	}
+	return false
+}
+
+/*
+registers for the choice and enters the itan provided by the callback, if required.
+submitted is true, if the registration was sent to stine, an error afterwards does not mean, that the user is not registered.
+*/
+func (session *Session) registerChoice(choice PlanChoice, tanCallback func(tanReq *TanRequired) (string, error)) (tanReq *TanRequired, submitted bool, err error) {
+	if choice.Module.RegistrationLink == "" {
+		return nil, false, ErrNoRegistrationLink
+	}
+
+	modReg := session.RegisterForModule(choice.Module)
+	err = modReg.SetExamDate(choice.ExamDate)
+	if err != nil {
+		return nil, false, err
+	}
+	// nothing is submitted, until the registration form was loaded
+	err = modReg.Prepare()
+	if err != nil {
+		return nil, false, err
+	}
+	// if a tan provider failed, the tanrequired is returned together with the error
+	tanReq, err = modReg.Register()
+	if errors.Is(err, ErrRegistrationRejected) {
+		// stine displayed why the user was not registered, so the next choice can be tried
+		return nil, false, err
+	}
+	if err != nil || tanReq == nil {
+		return tanReq, true, err
+	}
+
+	if tanCallback == nil {
+		return tanReq, true, nil
+	}
+	itan, err := tanCallback(tanReq)
+	if err != nil {
+		return tanReq, true, err
+	}
+	err = tanReq.SetTan(itan)
+	if err != nil {
+		// the itan list locks after too many failed attempts, do not continue with other registrations
+		return tanReq, true, err
+	}
+	return nil, true, nil
+}
+
+/*
+RegisterMany registers the user for every item of the passed plan, ordered by priority.
+For every item the choices are tried in order until a registration succeeds. The next choice is only tried,
+if the previous one was not submitted e.g. because its registration is not open, or STiNE rejected it e.g. because it is fully booked. If a choice was submitted, but failed afterwards
+e.g. with a network error, the user may be registered for it, so the item is reported as PlanUnknown and no further choice is tried.
+
+On a dry run, the registration link and registration id of every choice is resolved without submitting anything.
+
+Items listing the same module multiple times fail with [ErrDuplicateChoice] without submitting anything,
+as events of a module like exercise groups cannot be selected.
+
+If an iTAN is required, the TanCallback of the plan is called. If no callback is set, it returns an error or the iTAN is rejected,
+the run is stopped and every following item is skipped.
+
+A result is returned for every item in the order the items were passed.
+*/
+func (session *Session) RegisterMany(plan RegistrationPlan) []PlanResult {
+	results := make([]PlanResult, len(plan.Items))
+	for i, item := range plan.Items {
+		results[i] = PlanResult{Item: item, Status: PlanSkipped, Choice: -1}
+	}
+
+	order := make([]int, len(plan.Items))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return plan.Items[order[a]].Priority < plan.Items[order[b]].Priority
+	})
+
+	for _, i := range order {
+		result := &results[i]
+		result.Status = PlanFailed
+		if hasDuplicateChoice(result.Item) {
+			result.Err = ErrDuplicateChoice
+			continue
+		}
+
+		for choiceIndex, choice := range result.Item.Choices {
+			if plan.DryRun {
+				regId, err := session.resolveChoice(choice)
+				if err != nil {
+					result.Err = err
+					continue
+				}
+				result.Status = PlanResolved
+				result.Choice = choiceIndex
+				result.RegistrationId = regId
+				result.Err = nil
+				break
+			}
+
+			tanReq, submitted, err := session.registerChoice(choice, plan.TanCallback)
+			if tanReq != nil {
+				// itan could not be provided or was rejected, stop before anything else is submitted
+				result.Status = PlanTanRequired
+				result.Choice = choiceIndex
+				result.Tan = tanReq
+				result.Err = err
+				return results
+			}
+			if err != nil && submitted {
+				// registering for a fallback could register the user for both choices
+				result.Status = PlanUnknown
+				result.Choice = choiceIndex
+				result.Err = err
+				break
+			}
+			if err != nil {
+				result.Err = err
+				continue
+			}
+			result.Status = PlanRegistered
+			result.Choice = choiceIndex
+			result.Err = nil
+			break
+		}
+	}
+
+	return results
+}
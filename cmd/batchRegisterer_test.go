@@ -0,0 +1,192 @@
+package stineapi
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+// fakeRegistrationServer simulates a registration for every path, /full has no registration form and /tan requires an itan
+func fakeRegistrationServer(t *testing.T, submitted *[]string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/full" {
+			return
+		}
+		if r.Method == http.MethodGet {
+			w.Write([]byte(`<input name="rgtr_id" value="rgtr` + r.URL.Path + `"/>`))
+			return
+		}
+
+		err := r.ParseForm()
+		if err != nil {
+			t.Errorf("ERROR: %s", err)
+		}
+		*submitted = append(*submitted, r.URL.Path)
+		if r.URL.Path == "/tan" && !r.Form.Has("tan_code") {
+			w.Write([]byte(`<span class="itan"> 54</span>`))
+		}
+	}))
+}
+
+func TestRegisterManyDryRun(t *testing.T) {
+	var submitted []string
+	fakeServer := fakeRegistrationServer(t, &submitted)
+	defer fakeServer.Close()
+
+	session := Session{Client: &http.Client{}, SessionNo: "342424"}
+	results := session.RegisterMany(RegistrationPlan{
+		DryRun: true,
+		Items: []PlanItem{
+			{Name: "exercise", Choices: []PlanChoice{
+				{Module: Module{RegistrationLink: fakeServer.URL + "/full"}},
+				{Module: Module{RegistrationLink: fakeServer.URL + "/group4"}},
+			}},
+			{Name: "registered", Choices: []PlanChoice{{Module: Module{}}}},
+		},
+	})
+
+	if len(submitted) != 0 {
+		t.Errorf("nothing should be submitted on a dry run, submitted: %s", submitted)
+	}
+	if results[0].Status != PlanResolved || results[0].Choice != 1 || results[0].RegistrationId != "rgtr/group4" {
+		t.Error(fmt.Sprintf("fallback should have been resolved, received %+v", results[0]))
+	}
+	if results[1].Status != PlanFailed || results[1].Err != ErrNoRegistrationLink {
+		t.Error(fmt.Sprintf("module without registration link should fail, received %+v", results[1]))
+	}
+}
+
+func TestRegisterManyPriority(t *testing.T) {
+	var submitted []string
+	fakeServer := fakeRegistrationServer(t, &submitted)
+	defer fakeServer.Close()
+
+	session := Session{Client: &http.Client{}, SessionNo: "342424"}
+	results := session.RegisterMany(RegistrationPlan{
+		Items: []PlanItem{
+			{Name: "lecture", Priority: 2, Choices: []PlanChoice{{Module: Module{RegistrationLink: fakeServer.URL + "/lecture"}}}},
+			{Name: "exercise", Priority: 1, Choices: []PlanChoice{
+				{Module: Module{RegistrationLink: fakeServer.URL + "/full"}},
+				{Module: Module{RegistrationLink: fakeServer.URL + "/group4"}},
+			}},
+		},
+	})
+
+	if fmt.Sprint(submitted) != "[/group4 /lecture]" {
+		t.Errorf("items should be registered ordered by priority, submitted: %s", submitted)
+	}
+	for _, result := range results {
+		if result.Status != PlanRegistered {
+			t.Error(fmt.Sprintf("item %s should be registered, received %+v", result.Item.Name, result))
+		}
+	}
+	if results[1].Choice != 1 {
+		t.Errorf("expected fallback to be registered, received choice %d", results[1].Choice)
+	}
+}
+
+func TestRegisterManyStopsOnTan(t *testing.T) {
+	var submitted []string
+	fakeServer := fakeRegistrationServer(t, &submitted)
+	defer fakeServer.Close()
+
+	session := Session{Client: &http.Client{}, SessionNo: "342424"}
+	plan := RegistrationPlan{
+		Items: []PlanItem{
+			{Name: "first", Choices: []PlanChoice{{Module: Module{RegistrationLink: fakeServer.URL + "/tan"}}}},
+			{Name: "second", Choices: []PlanChoice{{Module: Module{RegistrationLink: fakeServer.URL + "/second"}}}},
+		},
+		TanCallback: func(tanReq *TanRequired) (string, error) {
+			return "", errors.New("no tan available")
+		},
+	}
+	results := session.RegisterMany(plan)
+
+	if results[0].Status != PlanTanRequired || results[0].Tan == nil || results[0].Tan.TanStartsWith != "054" {
+		t.Error(fmt.Sprintf("first item should require an itan, received %+v", results[0]))
+	}
+	if results[1].Status != PlanSkipped {
+		t.Error(fmt.Sprintf("second item should be skipped, received %+v", results[1]))
+	}
+
+	// supply the tan with the callback
+	submitted = nil
+	plan.TanCallback = func(tanReq *TanRequired) (string, error) {
+		return "0543423", nil
+	}
+	results = session.RegisterMany(plan)
+
+	if results[0].Status != PlanRegistered || results[1].Status != PlanRegistered {
+		t.Error(fmt.Sprintf("both items should be registered, received %+v", results))
+	}
+	if fmt.Sprint(submitted) != "[/tan /tan /second]" {
+		t.Errorf("unexpected requests: %s", submitted)
+	}
+}
+
+func TestRegisterManyUnknownOutcome(t *testing.T) {
+	var mu sync.Mutex
+	var submitted []string
+	fakeServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			w.Write([]byte(`<input name="rgtr_id" value="rgtr` + r.URL.Path + `"/>`))
+			return
+		}
+		mu.Lock()
+		submitted = append(submitted, r.URL.Path)
+		mu.Unlock()
+		// the connection drops after the registration was received
+		conn, _, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			t.Errorf("ERROR: %s", err)
+			return
+		}
+		conn.Close()
+	}))
+	defer fakeServer.Close()
+
+	session := Session{Client: &http.Client{}, SessionNo: "342424"}
+	results := session.RegisterMany(RegistrationPlan{
+		Items: []PlanItem{
+			{Name: "exercise", Choices: []PlanChoice{
+				{Module: Module{RegistrationLink: fakeServer.URL + "/group2"}},
+				{Module: Module{RegistrationLink: fakeServer.URL + "/group4"}},
+			}},
+		},
+	})
+
+	mu.Lock()
+	defer mu.Unlock()
+	if fmt.Sprint(submitted) != "[/group2]" {
+		t.Errorf("fallback should not be submitted after an unknown outcome, submitted: %s", submitted)
+	}
+	if results[0].Status != PlanUnknown || results[0].Choice != 0 || results[0].Err == nil {
+		t.Error(fmt.Sprintf("outcome of the first choice should be unknown, received %+v", results[0]))
+	}
+}
+
+func TestRegisterManyRejectsInvalidPlans(t *testing.T) {
+	var submitted []string
+	fakeServer := fakeRegistrationServer(t, &submitted)
+	defer fakeServer.Close()
+
+	session := Session{Client: &http.Client{}, SessionNo: "342424"}
+	group := Module{RegistrationLink: fakeServer.URL + "/exercise"}
+	results := session.RegisterMany(RegistrationPlan{
+		DryRun: true,
+		Items: []PlanItem{
+			{Name: "exam date", Choices: []PlanChoice{{Module: Module{RegistrationLink: fakeServer.URL + "/lecture"}, ExamDate: ExamDate(42)}}},
+			{Name: "groups of one module", Choices: []PlanChoice{{Module: group}, {Module: group}}},
+		},
+	})
+
+	if results[0].Status != PlanFailed || results[0].Err != ErrInvalidExamDate {
+		t.Error(fmt.Sprintf("invalid exam date should fail on a dry run, received %+v", results[0]))
+	}
+	if results[1].Status != PlanFailed || results[1].Err != ErrDuplicateChoice {
+		t.Error(fmt.Sprintf("item with the same module twice should fail, received %+v", results[1]))
+	}
+}
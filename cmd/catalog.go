@@ -0,0 +1,194 @@
+package stineapi
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/martenmatrix/stine-api/cmd/internal/campusnet"
+	"math"
+	"net/http"
+)
+
+/*
+CatalogVersion is the version of the JSON schema written by MarshalCatalog. It is increased, whenever the schema changes incompatibly.
+
+Version 1 has the following schema:
+
+	{
+		"version": 1,
+		"root": Category
+	}
+
+	Category: {"id": string, "title": string, "url": string, "categories": [Category], "modules": [Module]}
+	Module:   {"id": string, "number": string, "title": string, "teacher": string, "registrationLink": string, "events": [Event]}
+	Event:    {"id": string, "courseId": string, "title": string, "link": string, "maxCapacity": Capacity, "currentCapacity": Capacity}
+	Capacity: number or "unlimited", if STiNE lists the capacity as "-"
+
+The ids of categories, modules and courses do not change between sessions, unlike the session number in the links.
+An empty registrationLink means, the user is already registered for the module or the registration is closed.
+*/
+const CatalogVersion = 1
+
+// unlimitedCapacity encodes capacities STiNE lists as "-", which are math.Inf(1) in an [Event]
+const unlimitedCapacity = "unlimited"
+
+// ErrUnsupportedCatalogVersion is returned by LoadCatalog, if the catalog was written with another version of the schema.
+var ErrUnsupportedCatalogVersion = errors.New("catalog was written with an unsupported version of the schema")
+
+// ErrNotAttached is returned by Category.Refresh, if the category was loaded with LoadCatalog and is not attached to a session.
+var ErrNotAttached = errors.New("category is not attached to a session, call Session.Attach first")
+
+// catalog is the document written by MarshalCatalog
+type catalog struct {
+	Version int      `json:"version"`
+	Root    Category `json:"root"`
+}
+
+func marshalCapacity(capacity float64) any {
+	if math.IsInf(capacity, 1) {
+		return unlimitedCapacity
+	}
+	return capacity
+}
+
+func unmarshalCapacity(data json.RawMessage) (float64, error) {
+	var text string
+	if json.Unmarshal(data, &text) == nil {
+		if text != unlimitedCapacity {
+			return 0, errors.New(fmt.Sprintf("invalid capacity %q, only numbers and %q are accepted", text, unlimitedCapacity))
+		}
+		return math.Inf(1), nil
+	}
+
+	var capacity float64
+	err := json.Unmarshal(data, &capacity)
+	return capacity, err
+}
+
+// eventJSON is an [Event] with capacities, which can be encoded
+type eventJSON struct {
+	Id              string          `json:"id"`
+	CourseId        string          `json:"courseId"`
+	Title           string          `json:"title"`
+	Link            string          `json:"link"`
+	MaxCapacity     json.RawMessage `json:"maxCapacity"`
+	CurrentCapacity json.RawMessage `json:"currentCapacity"`
+}
+
+// MarshalJSON encodes the event, unlimited capacities are encoded as "unlimited".
+func (event Event) MarshalJSON() ([]byte, error) {
+	maxCapacity, err := json.Marshal(marshalCapacity(event.MaxCapacity))
+	if err != nil {
+		return nil, err
+	}
+	currentCapacity, err := json.Marshal(marshalCapacity(event.CurrentCapacity))
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(eventJSON{
+		Id:              event.Id,
+		CourseId:        event.CourseId,
+		Title:           event.Title,
+		Link:            event.Link,
+		MaxCapacity:     maxCapacity,
+		CurrentCapacity: currentCapacity,
+	})
+}
+
+// UnmarshalJSON decodes an event encoded with MarshalJSON.
+func (event *Event) UnmarshalJSON(data []byte) error {
+	var decoded eventJSON
+	err := json.Unmarshal(data, &decoded)
+	if err != nil {
+		return err
+	}
+
+	maxCapacity, err := unmarshalCapacity(decoded.MaxCapacity)
+	if err != nil {
+		return err
+	}
+	currentCapacity, err := unmarshalCapacity(decoded.CurrentCapacity)
+	if err != nil {
+		return err
+	}
+
+	*event = Event{
+		Id:              decoded.Id,
+		CourseId:        decoded.CourseId,
+		Title:           decoded.Title,
+		Link:            decoded.Link,
+		MaxCapacity:     maxCapacity,
+		CurrentCapacity: currentCapacity,
+	}
+	return nil
+}
+
+// MarshalCatalog encodes a crawled category and everything listed in it as JSON, see [CatalogVersion] for the schema.
+func MarshalCatalog(root Category) ([]byte, error) {
+	return json.MarshalIndent(catalog{
+		Version: CatalogVersion,
+		Root:    root,
+	}, "", "  ")
+}
+
+/*
+LoadCatalog decodes a catalog written by MarshalCatalog.
+
+The returned category needs to be attached to a session with Session.Attach, before it can be refreshed.
+*/
+func LoadCatalog(data []byte) (Category, error) {
+	// the version is checked first, as the root of another version may not be decodable
+	var version struct {
+		Version int `json:"version"`
+	}
+	err := json.Unmarshal(data, &version)
+	if err != nil {
+		return Category{}, err
+	}
+	if version.Version != CatalogVersion {
+		return Category{}, ErrUnsupportedCatalogVersion
+	}
+
+	var decoded catalog
+	err = json.Unmarshal(data, &decoded)
+	if err != nil {
+		return Category{}, err
+	}
+	return decoded.Root, nil
+}
+
+// attach sets the client of the category and its child categories and replaces the session numbers in every link, the passed category is not modified
+func attach(category Category, client *http.Client, sessionNo string) Category {
+	category.clientUsed = client
+	category.Url = campusnet.RefreshSessionNo(category.Url, sessionNo)
+
+	category.Modules = append([]Module(nil), category.Modules...)
+	for i := range category.Modules {
+		module := &category.Modules[i]
+		if module.RegistrationLink != "" {
+			module.RegistrationLink = campusnet.RefreshSessionNo(module.RegistrationLink, sessionNo)
+		}
+		module.Events = append([]Event(nil), module.Events...)
+		for j := range module.Events {
+			module.Events[j].Link = campusnet.RefreshSessionNo(module.Events[j].Link, sessionNo)
+		}
+	}
+
+	category.Categories = append([]Category(nil), category.Categories...)
+	for i := range category.Categories {
+		category.Categories[i] = attach(category.Categories[i], client, sessionNo)
+	}
+
+	return category
+}
+
+/*
+Attach returns a copy of the category, which is refreshed with the session, e.g. a category loaded with LoadCatalog.
+The session numbers in the links of the category and everything listed in it are replaced with the one of the session.
+*/
+func (session *Session) Attach(category Category) Category {
+	attached := attach(category, session.Client, session.SessionNo)
+	attached.setCache(session.cacheSettings())
+	return attached
+}
@@ -0,0 +1,95 @@
+package stineapi
+
+import (
+	"errors"
+	"fmt"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"math"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+var crawledCatalog = Category{
+	Title: "initial",
+	Url:   "https://www.stine.uni-hamburg.de/scripts/mgrqispi.dll?APPNAME=CampusNet&PRGNAME=REGISTRATION&ARGUMENTS=-N111111111111111,-N000309,",
+	Categories: []Category{
+		{
+			Title: "Informatics",
+			Url:   "https://www.stine.uni-hamburg.de/scripts/mgrqispi.dll?APPNAME=CampusNet&PRGNAME=REGISTRATION&ARGUMENTS=-N111111111111111,-N000309,-N42",
+			Modules: []Module{
+				{
+					Number:           "InfB-SE 2",
+					Title:            "Software Development II",
+					Teacher:          "Peter Lustig",
+					RegistrationLink: "https://www.stine.uni-hamburg.de/scripts/mgrqispi.dll?APPNAME=CampusNet&PRGNAME=REGCOURSEMOD&ARGUMENTS=-N111111111111111,-N000309,-N7",
+					Events: []Event{
+						{Id: "64-010", Title: "Lecture", MaxCapacity: 550, CurrentCapacity: 162},
+						{Id: "64-091", Title: "Exercises", MaxCapacity: math.Inf(1), CurrentCapacity: math.Inf(1)},
+					},
+				},
+			},
+		},
+	},
+}
+
+func TestCatalog(t *testing.T) {
+	data, err := MarshalCatalog(crawledCatalog)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{`"version": 1`, `"maxCapacity": 550`, `"maxCapacity": "unlimited"`, `"currentCapacity": "unlimited"`, `"number": "InfB-SE 2"`} {
+		if !strings.Contains(string(data), expected) {
+			t.Error(fmt.Sprintf("catalog should contain %s, received: %s", expected, data))
+		}
+	}
+
+	loaded, err := LoadCatalog(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(crawledCatalog, loaded, cmpopts.IgnoreUnexported(Category{})); diff != "" {
+		t.Error(fmt.Sprintf("loaded catalog differs: %s", diff))
+	}
+
+	_, err = loaded.Refresh(1)
+	if !errors.Is(err, ErrNotAttached) {
+		t.Error(fmt.Sprintf("WANT: %s, GOT: %v", ErrNotAttached, err))
+	}
+
+	_, err = LoadCatalog([]byte(`{"version": 2, "root": {}}`))
+	if !errors.Is(err, ErrUnsupportedCatalogVersion) {
+		t.Error(fmt.Sprintf("WANT: %s, GOT: %v", ErrUnsupportedCatalogVersion, err))
+	}
+
+	// the root of a future version may not match the current schema
+	_, err = LoadCatalog([]byte(`{"version": 2, "root": [{"modules": "changed"}]}`))
+	if !errors.Is(err, ErrUnsupportedCatalogVersion) {
+		t.Error(fmt.Sprintf("WANT: %s, GOT: %v", ErrUnsupportedCatalogVersion, err))
+	}
+
+	_, err = LoadCatalog([]byte(`{"version": 1, "root": {"modules": [{"events": [{"maxCapacity": "many"}]}]}}`))
+	if err == nil {
+		t.Error("invalid capacities should be rejected")
+	}
+}
+
+func TestAttach(t *testing.T) {
+	client := &http.Client{}
+	session := Session{Client: client, SessionNo: "222222222222222"}
+
+	attached := session.Attach(crawledCatalog)
+	informatics := attached.Categories[0]
+	if informatics.clientUsed != client || attached.clientUsed != client {
+		t.Error("client should be set on every category")
+	}
+	for _, link := range []string{attached.Url, informatics.Url, informatics.Modules[0].RegistrationLink} {
+		if !strings.Contains(link, "-N222222222222222") {
+			t.Error(fmt.Sprintf("session number should be replaced in %s", link))
+		}
+	}
+	if strings.Contains(crawledCatalog.Categories[0].Url, "222222222222222") {
+		t.Error("attached category should be a copy")
+	}
+}
@@ -0,0 +1,251 @@
+package stineapi
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"github.com/martenmatrix/stine-api/cmd/internal/campusnet"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+/*
+CachedCategory is the page of a single category stored in a [CategoryCache]. The child categories of the category only contain
+their id, title and url, as they are cached separately.
+*/
+type CachedCategory struct {
+	Category Category  `json:"category"`
+	Fetched  time.Time `json:"fetched"` // When the page was fetched from STiNE
+}
+
+/*
+CategoryCache stores the pages of crawled categories, so they do not need to be fetched again on every crawl.
+It can be set on a [Session] with SetCategoryCache.
+
+Pages are keyed by the account, the language and the id of the category, which does not change between sessions,
+as the registration links and titles differ between accounts and languages. Categories without an id, like the initial category,
+are keyed by their url without the session number instead of the id.
+*/
+type CategoryCache interface {
+	// Load returns the cached page of the category, the second return value is false, if the category is not cached.
+	Load(key string) (CachedCategory, bool, error)
+	// Store saves the page of the category.
+	Store(key string, category CachedCategory) error
+}
+
+// cacheSettings is the cache and ttl categories are crawled with
+type cacheSettings struct {
+	cache    CategoryCache
+	ttl      time.Duration
+	account  string   // user the categories are crawled for, the registration links differ between users
+	language Language // language the session is pinned to, empty if it is not pinned
+}
+
+// cacheKey returns the key the category with the url is cached under
+func (settings *cacheSettings) cacheKey(url string) string {
+	id := campusnet.ParseId(url)
+	if id == "" {
+		id = campusnet.RefreshSessionNo(url, campusnet.EmptySessionNo)
+	}
+	return settings.account + "/" + string(settings.language) + "/" + id
+}
+
+// getCategory returns the page of the category from the cache, if it is younger than the ttl and force is not set, otherwise it is fetched and cached
+func (settings *cacheSettings) getCategory(client *http.Client, title string, url string, force bool) (Category, error) {
+	if settings == nil {
+		return getCategory(client, title, url)
+	}
+	key := settings.cacheKey(url)
+
+	if !force {
+		cached, found, err := settings.cache.Load(key)
+		if err != nil {
+			log.Println("Unable to load category from cache, fetching it from STiNE:", err)
+		}
+		if err == nil && found && time.Since(cached.Fetched) < settings.ttl {
+			// links in the cached page contain the session number of the session, which fetched it
+			category := attach(cached.Category, client, sessionNoOf(url))
+			category.Title = title
+			category.Url = url
+			category.setCache(settings)
+			return category, nil
+		}
+	}
+
+	category, err := getCategory(client, title, url)
+	if err != nil {
+		return Category{}, err
+	}
+	category.setCache(settings)
+
+	page := category
+	page.Categories = nil
+	for _, child := range category.Categories {
+		page.Categories = append(page.Categories, Category{Id: child.Id, Title: child.Title, Url: child.Url})
+	}
+	err = settings.cache.Store(key, CachedCategory{Category: page, Fetched: time.Now()})
+	if err != nil {
+		log.Println("Unable to store category in cache:", err)
+	}
+
+	return category, nil
+}
+
+// sessionNoOf returns the session number of a stine url, the session number of a user, who is not authenticated, if it has none
+func sessionNoOf(url string) string {
+	req, err := campusnet.Parse(url)
+	if err != nil {
+		return campusnet.EmptySessionNo
+	}
+	return req.SessionNo
+}
+
+// cacheSettings returns the cache settings for the current user and pinned language of the session, nil if categories are not cached
+func (session *Session) cacheSettings() *cacheSettings {
+	if session.categoryCache == nil {
+		return nil
+	}
+
+	settings := *session.categoryCache
+	settings.account = session.username
+	settings.language = session.pinnedLanguage()
+	return &settings
+}
+
+// setCache sets the cache on the category and its child categories, so they are refreshed with it
+func (category *Category) setCache(settings *cacheSettings) {
+	category.cacheUsed = settings
+	for i := range category.Categories {
+		category.Categories[i].setCache(settings)
+	}
+}
+
+/*
+SetCategoryCache sets the cache, GetCategories and Category.Refresh read categories from. Categories younger than the ttl
+are read from the cache instead of STiNE, Category.Refresh always re-fetches the category it is called on.
+A nil cache disables caching.
+
+A cache can be shared by the sessions of multiple accounts, every account only reads the categories crawled for it.
+The categories are separated by the language the session is pinned to, pin the language with PinLanguage,
+if sessions of the same account use different languages.
+*/
+func (session *Session) SetCategoryCache(cache CategoryCache, ttl time.Duration) {
+	if cache == nil {
+		session.categoryCache = nil
+		return
+	}
+	session.categoryCache = &cacheSettings{
+		cache: cache,
+		ttl:   ttl,
+	}
+}
+
+// MemoryCategoryCache is a [CategoryCache], which stores the categories for the lifetime of the program.
+type MemoryCategoryCache struct {
+	categories map[string]CachedCategory
+	mu         sync.Mutex
+}
+
+// NewMemoryCategoryCache creates a new empty [MemoryCategoryCache].
+func NewMemoryCategoryCache() *MemoryCategoryCache {
+	return &MemoryCategoryCache{
+		categories: map[string]CachedCategory{},
+	}
+}
+
+// Load returns the cached page of the category.
+func (cache *MemoryCategoryCache) Load(key string) (CachedCategory, bool, error) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	category, found := cache.categories[key]
+	return category, found, nil
+}
+
+// Store saves the page of the category.
+func (cache *MemoryCategoryCache) Store(key string, category CachedCategory) error {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	cache.categories[key] = category
+	return nil
+}
+
+/*
+FileCategoryCache is a [CategoryCache], which stores every category as a JSON file in a directory,
+so the categories are not lost after a restart of the program.
+*/
+type FileCategoryCache struct {
+	dir string
+}
+
+// NewFileCategoryCache creates a new [FileCategoryCache], which stores the categories in dir. The directory is created, if it does not exist.
+func NewFileCategoryCache(dir string) (*FileCategoryCache, error) {
+	err := os.MkdirAll(dir, 0700)
+	if err != nil {
+		return nil, err
+	}
+	return &FileCategoryCache{
+		dir: dir,
+	}, nil
+}
+
+// path returns the path of the file the category is stored in
+func (cache *FileCategoryCache) path(key string) string {
+	name := key
+	if strings.Trim(key, "0123456789") != "" {
+		// urls cannot be used as file names
+		hash := sha256.Sum256([]byte(key))
+		name = hex.EncodeToString(hash[:])
+	}
+	return filepath.Join(cache.dir, name+".json")
+}
+
+// Load returns the cached page of the category.
+func (cache *FileCategoryCache) Load(key string) (CachedCategory, bool, error) {
+	data, err := os.ReadFile(cache.path(key))
+	if errors.Is(err, os.ErrNotExist) {
+		return CachedCategory{}, false, nil
+	}
+	if err != nil {
+		return CachedCategory{}, false, err
+	}
+
+	var category CachedCategory
+	err = json.Unmarshal(data, &category)
+	if err != nil {
+		return CachedCategory{}, false, err
+	}
+	return category, true, nil
+}
+
+// Store saves the page of the category.
+func (cache *FileCategoryCache) Store(key string, category CachedCategory) error {
+	data, err := json.Marshal(category)
+	if err != nil {
+		return err
+	}
+
+	// write to a temporary file first, so a crash does not leave a partially written file
+	path := cache.path(key)
+	tmpFile, err := os.CreateTemp(cache.dir, "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	_, err = tmpFile.Write(data)
+	closeErr := tmpFile.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmpFile.Name())
+		return err
+	}
+	return os.Rename(tmpFile.Name(), path)
+}
@@ -0,0 +1,162 @@
+package stineapi
+
+import (
+	"fmt"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// newCategoryServer serves an initial category, which lists a single child category, and counts the requests for every page
+func newCategoryServer(t *testing.T) (*httptest.Server, map[string]int, *sync.Mutex) {
+	requests := map[string]int{}
+	var mu sync.Mutex
+
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests[r.URL.Path]++
+		mu.Unlock()
+
+		switch r.URL.Path {
+		case "/initial":
+			fmt.Fprintf(w, `<ul><li><a href="%s/informatics">Informatics</a></li></ul>`, server.URL)
+		case "/informatics":
+			fmt.Fprintf(w, `<ul><li><a href="%s/electives">Electives</a></li></ul>`, server.URL)
+		default:
+			w.Write([]byte("<html></html>"))
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	return server, requests, &mu
+}
+
+func TestCategoryCache(t *testing.T) {
+	server, requests, mu := newCategoryServer(t)
+	settings := &cacheSettings{cache: NewMemoryCategoryCache(), ttl: time.Hour}
+
+	crawled, err := getAvailableModules(2, server.URL+"/initial", &http.Client{}, settings, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(crawled.Categories) != 1 || len(crawled.Categories[0].Categories) != 1 {
+		t.Fatalf("nested categories should be crawled, received: %+v", crawled)
+	}
+
+	cached, err := getAvailableModules(2, server.URL+"/initial", &http.Client{}, settings, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(crawled, cached, cmpopts.IgnoreUnexported(Category{})); diff != "" {
+		t.Error(fmt.Sprintf("cached categories differ: %s", diff))
+	}
+
+	informatics := cached.Categories[0]
+	_, err = informatics.Refresh(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	want := map[string]int{"/initial": 1, "/informatics": 2, "/electives": 1}
+	if diff := cmp.Diff(want, requests); diff != "" {
+		t.Error(fmt.Sprintf("only the refreshed category should be fetched again: %s", diff))
+	}
+}
+
+func TestCategoryCacheTTL(t *testing.T) {
+	server, requests, mu := newCategoryServer(t)
+	settings := &cacheSettings{cache: NewMemoryCategoryCache(), ttl: 0}
+
+	for i := 0; i < 2; i++ {
+		_, err := getAvailableModules(0, server.URL+"/initial", &http.Client{}, settings, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if requests["/initial"] != 2 {
+		t.Error(fmt.Sprintf("stale categories should be fetched again, fetched %d times", requests["/initial"]))
+	}
+}
+
+func TestFileCategoryCache(t *testing.T) {
+	dir := t.TempDir()
+	cache, err := NewFileCategoryCache(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stored := CachedCategory{
+		Category: Category{
+			Id:    "389000000000001",
+			Title: "Informatics",
+			Modules: []Module{{Title: "Software Development II", Events: []Event{
+				{Id: "64-010", MaxCapacity: math.Inf(1), CurrentCapacity: 162},
+			}}},
+		},
+		Fetched: time.Date(2023, time.July, 24, 10, 0, 0, 0, time.UTC),
+	}
+	for _, key := range []string{"389000000000001", "https://www.stine.uni-hamburg.de/scripts/mgrqispi.dll?APPNAME=CampusNet&PRGNAME=REGISTRATION&ARGUMENTS=-N000000000000000,-N000309"} {
+		err = cache.Store(key, stored)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// a new cache reads the categories stored by the previous one
+		reopened, err := NewFileCategoryCache(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		loaded, found, err := reopened.Load(key)
+		if err != nil || !found {
+			t.Fatalf("category should be loaded, found: %t, error: %v", found, err)
+		}
+		if diff := cmp.Diff(stored, loaded, cmpopts.IgnoreUnexported(Category{})); diff != "" {
+			t.Error(fmt.Sprintf("loaded category differs: %s", diff))
+		}
+	}
+
+	_, found, err := cache.Load("389000000000002")
+	if found || err != nil {
+		t.Error(fmt.Sprintf("unknown category should not be found, found: %t, error: %v", found, err))
+	}
+}
+
+func TestCategoryCacheSeparatesAccounts(t *testing.T) {
+	server, requests, mu := newCategoryServer(t)
+	cache := NewMemoryCategoryCache()
+
+	for _, username := range []string{"BBB1234", "BBB5678", "BBB1234"} {
+		session := Session{Client: &http.Client{}, username: username}
+		session.SetCategoryCache(cache, time.Hour)
+		_, err := getAvailableModules(0, server.URL+"/initial", session.Client, session.cacheSettings(), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// pinned to another language
+	session := Session{Client: &http.Client{Transport: &languageGuard{}}, username: "BBB1234"}
+	session.Client.Transport.(*languageGuard).pin(English)
+	session.SetCategoryCache(cache, time.Hour)
+	_, err := getAvailableModules(0, server.URL+"/initial", session.Client, session.cacheSettings(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if requests["/initial"] != 3 {
+		t.Error(fmt.Sprintf("categories of another account or language should not be read from the cache, fetched %d times", requests["/initial"]))
+	}
+}
@@ -0,0 +1,108 @@
+package stineapi
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrCredentialsNotFound is returned by a [CredentialProvider], if it has no credentials for the requested account.
+var ErrCredentialsNotFound = errors.New("no credentials found for the account")
+
+// ErrNoCredentialProvider is returned by Relogin, if the session was not logged in with LoginWithProvider.
+var ErrNoCredentialProvider = errors.New("session has no credential provider, log in with LoginWithProvider first")
+
+// Credentials represent the username and password of a STiNE account.
+type Credentials struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// Lookup returns the credentials, if the username is empty or matches, so fixed credentials can be used as a [CredentialProvider].
+func (credentials Credentials) Lookup(username string) (Credentials, error) {
+	if username != "" && username != credentials.Username {
+		return Credentials{}, ErrCredentialsNotFound
+	}
+	return credentials, nil
+}
+
+/*
+CredentialProvider provides the credentials of STiNE accounts, so passwords do not need to be passed around as plain strings.
+Implementations for environment variables, files and interactive prompts are provided by the credentials package.
+
+A provider is asked for the credentials on every login, changed passwords are picked up on the next re-login.
+*/
+type CredentialProvider interface {
+	// Lookup returns the credentials of the account with the username or of the default account of the provider, if the username is empty.
+	// If the provider has no credentials for the account, ErrCredentialsNotFound should be returned.
+	Lookup(username string) (Credentials, error)
+}
+
+/*
+LoginWithProvider authenticates the session with the credentials of the account with the username, which are looked up with the provider.
+If the username is empty, the default account of the provider is used. The provider is kept to log in again with Relogin.
+
+The operations of the session e.g. GetCategories log the session in again automatically, if it expired after being unused.
+*/
+func (session *Session) LoginWithProvider(provider CredentialProvider, username string) error {
+	credentials, err := provider.Lookup(username)
+	if err != nil {
+		return err
+	}
+
+	// kept even if the login fails, so it can be retried with Relogin
+	session.credentials = provider
+	session.username = credentials.Username
+	return session.Login(credentials.Username, credentials.Password)
+}
+
+/*
+Relogin authenticates the session again e.g. after it expired, see Alive. The credentials are looked up again with
+the provider passed to LoginWithProvider, if the session was not logged in with a provider, [ErrNoCredentialProvider] is returned.
+*/
+func (session *Session) Relogin() error {
+	if session.credentials == nil {
+		return ErrNoCredentialProvider
+	}
+	return session.LoginWithProvider(session.credentials, session.username)
+}
+
+/*
+ReloginIfExpired logs the session in again with the provider passed to LoginWithProvider, if it expired, see Alive.
+It reports whether the session was logged in again. Sessions, which were not logged in with a provider, are not checked.
+*/
+func (session *Session) ReloginIfExpired() (bool, error) {
+	if session.credentials == nil {
+		return false, nil
+	}
+
+	alive, err := session.Alive()
+	if err != nil || alive {
+		return false, err
+	}
+	err = session.Relogin()
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// reloginCheckAfter is the time a session needs to be unused, before operations check if it expired, STiNE only expires inactive sessions
+const reloginCheckAfter = time.Minute
+
+/*
+autoRelogin logs the session in again before an operation, if it was logged in with LoginWithProvider and expired.
+Sessions used within reloginCheckAfter are not checked, so operations in quick succession do not send additional requests.
+*/
+func (session *Session) autoRelogin() error {
+	if session.credentials == nil {
+		return nil
+	}
+	if time.Since(session.lastUsed) >= reloginCheckAfter {
+		_, err := session.ReloginIfExpired()
+		if err != nil {
+			return err
+		}
+	}
+	session.lastUsed = time.Now()
+	return nil
+}
@@ -0,0 +1,343 @@
+/*
+Package credentials provides the credentials of STiNE accounts from sources other than plain strings in code.
+
+Every provider implements [stineapi.CredentialProvider] and can be passed to Session.LoginWithProvider:
+environment variables ([Env]), a JSON file ([File]), a netrc file ([Netrc]), an external command like an OS keyring ([Command])
+and an interactive prompt ([Prompt]).
+*/
+package credentials
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/martenmatrix/stine-api/cmd"
+	"golang.org/x/term"
+	"io"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"sync"
+)
+
+// ErrInsecurePermissions is returned, if a file containing passwords can be read or written by other users than its owner.
+var ErrInsecurePermissions = errors.New("credential file is accessible by other users, restrict its permissions to 0600")
+
+// readPrivate reads the file, if only its owner can access it, windows does not support unix permissions.
+// The permissions are checked on the opened file, so the file cannot be replaced between the check and the read.
+func readPrivate(path string) ([]byte, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if runtime.GOOS != "windows" && info.Mode().Perm()&0077 != 0 {
+		return nil, ErrInsecurePermissions
+	}
+	return io.ReadAll(file)
+}
+
+// matching returns the credentials with the username, the first ones, if the username is empty
+func matching(accounts []stineapi.Credentials, username string) (stineapi.Credentials, error) {
+	for _, account := range accounts {
+		if username == "" || account.Username == username {
+			return account, nil
+		}
+	}
+	return stineapi.Credentials{}, stineapi.ErrCredentialsNotFound
+}
+
+// Env provides the credentials of a single account from environment variables.
+type Env struct {
+	UsernameVar string // Variable containing the username, defaults to STINE_USERNAME
+	PasswordVar string // Variable containing the password, defaults to STINE_PASSWORD
+}
+
+// NewEnv creates a new [Env], which reads the credentials from STINE_USERNAME and STINE_PASSWORD.
+func NewEnv() *Env {
+	return &Env{
+		UsernameVar: "STINE_USERNAME",
+		PasswordVar: "STINE_PASSWORD",
+	}
+}
+
+// Lookup returns the credentials stored in the environment variables.
+func (env *Env) Lookup(username string) (stineapi.Credentials, error) {
+	account := stineapi.Credentials{
+		Username: os.Getenv(env.UsernameVar),
+		Password: os.Getenv(env.PasswordVar),
+	}
+	if account.Username == "" || account.Password == "" {
+		return stineapi.Credentials{}, stineapi.ErrCredentialsNotFound
+	}
+	return account.Lookup(username)
+}
+
+/*
+File provides the credentials of one or multiple accounts from a JSON file, which only its owner can access.
+The file contains a single account or a list of accounts:
+
+	[{"username": "BAA1234", "password": "secret"}, {"username": "BAB5678", "password": "secret"}]
+
+The file is read on every lookup, so changed passwords are picked up on the next login.
+*/
+type File struct {
+	path string
+}
+
+// NewFile creates a new [File], which reads the credentials from the file at path.
+func NewFile(path string) *File {
+	return &File{
+		path: path,
+	}
+}
+
+// Lookup returns the credentials of the account with the username, the first account in the file, if the username is empty.
+func (file *File) Lookup(username string) (stineapi.Credentials, error) {
+	data, err := readPrivate(file.path)
+	if err != nil {
+		return stineapi.Credentials{}, err
+	}
+
+	var accounts []stineapi.Credentials
+	if json.Unmarshal(data, &accounts) != nil {
+		var account stineapi.Credentials
+		err = json.Unmarshal(data, &account)
+		if err != nil {
+			return stineapi.Credentials{}, errors.New(fmt.Sprintf("unable to parse credential file %s: %s", file.path, err))
+		}
+		accounts = []stineapi.Credentials{account}
+	}
+	return matching(accounts, username)
+}
+
+/*
+Netrc provides the credentials of accounts from a netrc file, which only its owner can access e.g. ~/.netrc:
+
+	machine stine.uni-hamburg.de login BAA1234 password secret
+
+Entries of the Machine and the default entry are used, the file is read on every lookup.
+*/
+type Netrc struct {
+	Machine string // Host of the entries, a leading "www." is ignored, defaults to stine.uni-hamburg.de
+	path    string
+}
+
+// NewNetrc creates a new [Netrc], which reads the credentials from the file at path.
+func NewNetrc(path string) *Netrc {
+	return &Netrc{
+		Machine: "stine.uni-hamburg.de",
+		path:    path,
+	}
+}
+
+// parseNetrc returns the logins of the entries for the machine followed by the ones of the default entry
+func parseNetrc(content string, machine string) []stineapi.Credentials {
+	var accounts, defaults []stineapi.Credentials
+	var current *stineapi.Credentials
+	isDefault := false
+	machine = strings.TrimPrefix(strings.ToLower(machine), "www.")
+
+	// finish adds the current entry, if it belongs to the machine
+	finish := func() {
+		if current != nil && current.Username != "" {
+			if isDefault {
+				defaults = append(defaults, *current)
+			} else {
+				accounts = append(accounts, *current)
+			}
+		}
+		current = nil
+	}
+
+	fields := strings.Fields(content)
+	for i := 0; i < len(fields); i++ {
+		next := func() string {
+			if i+1 >= len(fields) {
+				return ""
+			}
+			i++
+			return fields[i]
+		}
+
+		switch fields[i] {
+		case "machine":
+			finish()
+			if strings.TrimPrefix(strings.ToLower(next()), "www.") == machine {
+				current = &stineapi.Credentials{}
+				isDefault = false
+			}
+		case "default":
+			finish()
+			current = &stineapi.Credentials{}
+			isDefault = true
+		case "login":
+			if login := next(); current != nil {
+				current.Username = login
+			}
+		case "password":
+			if password := next(); current != nil {
+				current.Password = password
+			}
+		case "macdef":
+			// macro definitions end with an empty line, they are not split into fields, so the rest of the entry is skipped
+			finish()
+			for i+1 < len(fields) && fields[i+1] != "machine" && fields[i+1] != "default" {
+				i++
+			}
+		case "account":
+			next()
+		}
+	}
+	finish()
+
+	return append(accounts, defaults...)
+}
+
+// Lookup returns the credentials of the account with the username, the first entry of the machine, if the username is empty.
+func (netrc *Netrc) Lookup(username string) (stineapi.Credentials, error) {
+	data, err := readPrivate(netrc.path)
+	if err != nil {
+		return stineapi.Credentials{}, err
+	}
+
+	return matching(parseNetrc(string(data), netrc.Machine), username)
+}
+
+/*
+Command provides the password of a single account from an external command, which prints the password to stdout.
+It is used to read passwords from an OS keyring through its local agent, for instance:
+
+	credentials.NewCommand("BAA1234", "secret-tool", "lookup", "service", "stine", "username", "BAA1234") // Linux
+	credentials.NewCommand("BAA1234", "security", "find-generic-password", "-s", "stine", "-a", "BAA1234", "-w") // macOS
+	credentials.NewCommand("BAA1234", "pass", "show", "stine") // pass
+
+The username is passed to the command in the environment variable STINE_USERNAME, only the first line of the output is used.
+*/
+type Command struct {
+	username string
+	name     string
+	args     []string
+}
+
+// NewCommand creates a new [Command], which runs the command with the arguments to get the password of the account with the username.
+func NewCommand(username string, name string, args ...string) *Command {
+	return &Command{
+		username: username,
+		name:     name,
+		args:     args,
+	}
+}
+
+// Lookup runs the command and returns the printed password.
+func (command *Command) Lookup(username string) (stineapi.Credentials, error) {
+	if username != "" && username != command.username {
+		return stineapi.Credentials{}, stineapi.ErrCredentialsNotFound
+	}
+
+	cmd := exec.Command(command.name, command.args...)
+	cmd.Env = append(os.Environ(), "STINE_USERNAME="+command.username)
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		return stineapi.Credentials{}, errors.New(fmt.Sprintf("unable to get password from %s: %s %s", command.name, err, strings.TrimSpace(stderr.String())))
+	}
+
+	password, _, _ := strings.Cut(string(output), "\n")
+	password = strings.TrimSuffix(password, "\r")
+	if password == "" {
+		return stineapi.Credentials{}, stineapi.ErrCredentialsNotFound
+	}
+	return stineapi.Credentials{Username: command.username, Password: password}, nil
+}
+
+/*
+Prompt asks for the credentials in the terminal on every lookup. The username is only asked for, if it is not requested by the caller.
+If In is a terminal, the password is not echoed.
+*/
+type Prompt struct {
+	In     io.Reader // Input the credentials are read from, defaults to os.Stdin
+	Out    io.Writer // Output the questions are written to, defaults to os.Stderr
+	reader *bufio.Reader
+	mu     sync.Mutex
+}
+
+// NewPrompt creates a new [Prompt], which asks in the terminal.
+func NewPrompt() *Prompt {
+	return &Prompt{
+		In:  os.Stdin,
+		Out: os.Stderr,
+	}
+}
+
+// readLine asks the question and returns the entered line
+func (prompt *Prompt) readLine(question string) (string, error) {
+	fmt.Fprint(prompt.Out, question)
+	line, err := prompt.reader.ReadString('\n')
+	if err != nil && (err != io.EOF || line == "") {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// isTerminal checks, if the input is a terminal, which echoes the input
+func isTerminal(in io.Reader) (*os.File, bool) {
+	file, isFile := in.(*os.File)
+	if !isFile {
+		return nil, false
+	}
+	return file, term.IsTerminal(int(file.Fd()))
+}
+
+// readPassword asks for the password without echoing it, if the input is a terminal
+func (prompt *Prompt) readPassword(question string) (string, error) {
+	terminal, isTerm := isTerminal(prompt.In)
+	if !isTerm {
+		return prompt.readLine(question)
+	}
+
+	fmt.Fprint(prompt.Out, question)
+	password, err := term.ReadPassword(int(terminal.Fd()))
+	// the newline of the user was not echoed
+	fmt.Fprintln(prompt.Out)
+	if err != nil {
+		return "", err
+	}
+	return string(password), nil
+}
+
+// Lookup asks for the username, if it is empty, and the password.
+func (prompt *Prompt) Lookup(username string) (stineapi.Credentials, error) {
+	prompt.mu.Lock()
+	defer prompt.mu.Unlock()
+
+	if prompt.reader == nil {
+		prompt.reader = bufio.NewReader(prompt.In)
+	}
+
+	var err error
+	if username == "" {
+		username, err = prompt.readLine("STiNE username: ")
+		if err != nil {
+			return stineapi.Credentials{}, err
+		}
+	}
+
+	password, err := prompt.readPassword(fmt.Sprintf("STiNE password for %s: ", username))
+	if err != nil {
+		return stineapi.Credentials{}, err
+	}
+
+	if username == "" || password == "" {
+		return stineapi.Credentials{}, stineapi.ErrCredentialsNotFound
+	}
+	return stineapi.Credentials{Username: username, Password: password}, nil
+}
@@ -0,0 +1,149 @@
+package credentials
+
+import (
+	"errors"
+	"fmt"
+	"github.com/martenmatrix/stine-api/cmd"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func writeFile(t *testing.T, content string, perm os.FileMode) string {
+	path := filepath.Join(t.TempDir(), "credentials")
+	err := os.WriteFile(path, []byte(content), perm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestEnv(t *testing.T) {
+	env := NewEnv()
+	if _, err := env.Lookup(""); !errors.Is(err, stineapi.ErrCredentialsNotFound) {
+		t.Error(fmt.Sprintf("WANT: %s, GOT: %v", stineapi.ErrCredentialsNotFound, err))
+	}
+
+	t.Setenv("STINE_USERNAME", "BAA1234")
+	t.Setenv("STINE_PASSWORD", "secret")
+	account, err := env.Lookup("")
+	if err != nil || account != (stineapi.Credentials{Username: "BAA1234", Password: "secret"}) {
+		t.Error(fmt.Sprintf("WANT: BAA1234 secret, GOT: %+v, %v", account, err))
+	}
+	if _, err := env.Lookup("BAB5678"); !errors.Is(err, stineapi.ErrCredentialsNotFound) {
+		t.Error(fmt.Sprintf("other account should not be found, GOT: %v", err))
+	}
+}
+
+func TestFile(t *testing.T) {
+	path := writeFile(t, `[{"username": "BAA1234", "password": "first"}, {"username": "BAB5678", "password": "second"}]`, 0600)
+	file := NewFile(path)
+
+	tests := []struct {
+		username string
+		want     string
+	}{
+		{"", "first"},
+		{"BAB5678", "second"},
+	}
+	for _, test := range tests {
+		account, err := file.Lookup(test.username)
+		if err != nil || account.Password != test.want {
+			t.Error(fmt.Sprintf("WANT: %s, GOT: %+v, %v", test.want, account, err))
+		}
+	}
+
+	single := NewFile(writeFile(t, `{"username": "BAA1234", "password": "single"}`, 0600))
+	if account, err := single.Lookup("BAA1234"); err != nil || account.Password != "single" {
+		t.Error(fmt.Sprintf("WANT: single, GOT: %+v, %v", account, err))
+	}
+}
+
+func TestInsecurePermissions(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("windows does not support unix permissions")
+	}
+
+	path := writeFile(t, `{"username": "BAA1234", "password": "secret"}`, 0644)
+	if _, err := NewFile(path).Lookup(""); !errors.Is(err, ErrInsecurePermissions) {
+		t.Error(fmt.Sprintf("WANT: %s, GOT: %v", ErrInsecurePermissions, err))
+	}
+	if _, err := NewNetrc(path).Lookup(""); !errors.Is(err, ErrInsecurePermissions) {
+		t.Error(fmt.Sprintf("WANT: %s, GOT: %v", ErrInsecurePermissions, err))
+	}
+}
+
+func TestNetrc(t *testing.T) {
+	path := writeFile(t, `machine example.com login someone password other
+machine www.stine.uni-hamburg.de
+	login BAA1234
+	password first
+macdef init
+	cd /pub
+
+machine stine.uni-hamburg.de login BAB5678 password second
+default login anonymous password guest
+`, 0600)
+	netrc := NewNetrc(path)
+
+	tests := []struct {
+		username string
+		want     string
+	}{
+		{"", "first"},
+		{"BAB5678", "second"},
+		{"anonymous", "guest"},
+	}
+	for _, test := range tests {
+		account, err := netrc.Lookup(test.username)
+		if err != nil || account.Password != test.want {
+			t.Error(fmt.Sprintf("WANT: %s, GOT: %+v, %v", test.want, account, err))
+		}
+	}
+	if _, err := netrc.Lookup("someone"); !errors.Is(err, stineapi.ErrCredentialsNotFound) {
+		t.Error(fmt.Sprintf("entries of other machines should not be used, GOT: %v", err))
+	}
+}
+
+func TestCommand(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("test uses a shell")
+	}
+
+	command := NewCommand("BAA1234", "sh", "-c", `echo "secret-of-$STINE_USERNAME"; echo second line`)
+	account, err := command.Lookup("")
+	if err != nil || account != (stineapi.Credentials{Username: "BAA1234", Password: "secret-of-BAA1234"}) {
+		t.Error(fmt.Sprintf("WANT: secret-of-BAA1234, GOT: %+v, %v", account, err))
+	}
+
+	failing := NewCommand("BAA1234", "sh", "-c", "echo locked >&2; exit 1")
+	if _, err := failing.Lookup(""); err == nil || !strings.Contains(err.Error(), "locked") {
+		t.Error(fmt.Sprintf("error of the command should be returned, GOT: %v", err))
+	}
+}
+
+func TestPrompt(t *testing.T) {
+	var out strings.Builder
+	prompt := &Prompt{In: strings.NewReader("BAA1234\nsecret\nrotated\n"), Out: &out}
+
+	account, err := prompt.Lookup("")
+	if err != nil || account != (stineapi.Credentials{Username: "BAA1234", Password: "secret"}) {
+		t.Error(fmt.Sprintf("WANT: BAA1234 secret, GOT: %+v, %v", account, err))
+	}
+	// the username is known on a re-login
+	account, err = prompt.Lookup("BAA1234")
+	if err != nil || account.Password != "rotated" {
+		t.Error(fmt.Sprintf("WANT: rotated, GOT: %+v, %v", account, err))
+	}
+
+	want := "STiNE username: STiNE password for BAA1234: STiNE password for BAA1234: "
+	if out.String() != want {
+		t.Error(fmt.Sprintf("WANT: %q, GOT: %q", want, out.String()))
+	}
+
+	if _, err := prompt.Lookup("BAA1234"); err == nil {
+		t.Error("prompt without input should fail")
+	}
+}
@@ -0,0 +1,247 @@
+/*
+Package diff compares two crawled category trees e.g. before and after a refresh and lists what changed in the offering.
+
+	before, err := session.GetCategories(3)
+	after, err := before.Refresh(3)
+	changes := diff.Compare(before, after)
+	fmt.Print(diff.Summary(changes))
+*/
+package diff
+
+import (
+	"fmt"
+	"github.com/martenmatrix/stine-api/cmd"
+	"math"
+	"strings"
+)
+
+// Kind represents the kind of a [Change].
+type Kind int
+
+const (
+	CategoryAdded Kind = iota
+	CategoryRemoved
+	ModuleAdded
+	ModuleRemoved
+	EventAdded
+	EventRemoved
+	CapacityChanged    // Maximum or current capacity of an event changed
+	TeacherChanged     // Teachers of a module changed
+	RegistrationOpened // Module has a registration link, it did not have one before
+	RegistrationClosed // Module has no registration link anymore e.g. because the user registered
+)
+
+var kindNames = map[Kind]string{
+	CategoryAdded:      "category added",
+	CategoryRemoved:    "category removed",
+	ModuleAdded:        "module added",
+	ModuleRemoved:      "module removed",
+	EventAdded:         "event added",
+	EventRemoved:       "event removed",
+	CapacityChanged:    "capacity changed",
+	TeacherChanged:     "teacher changed",
+	RegistrationOpened: "registration opened",
+	RegistrationClosed: "registration closed",
+}
+
+func (kind Kind) String() string {
+	if name, exists := kindNames[kind]; exists {
+		return name
+	}
+	return fmt.Sprintf("Kind(%d)", int(kind))
+}
+
+// Change represents a single difference between two category trees.
+type Change struct {
+	Kind     Kind
+	Path     []string        // Titles of the categories from the root to the changed category or the category listing the module, the root is not included
+	Module   stineapi.Module // Module, which changed, the previous version for removed modules, empty for category changes
+	Event    stineapi.Event  // Event, which changed, the previous version for removed events, empty for category and module changes
+	Previous string          // Previous value for capacity and teacher changes e.g. "550 | 162"
+	Current  string          // Current value for capacity and teacher changes e.g. "550 | 163"
+}
+
+// moduleName returns the number and title of the module as listed on STiNE
+func moduleName(module stineapi.Module) string {
+	return strings.TrimSpace(module.Number + " " + module.Title)
+}
+
+// String describes the change in a single line.
+func (change Change) String() string {
+	path := strings.Join(change.Path, " > ")
+	switch change.Kind {
+	case CategoryAdded, CategoryRemoved:
+		return fmt.Sprintf("%s: %s", change.Kind, path)
+	case EventAdded, EventRemoved:
+		return fmt.Sprintf("%s: %s %s in %s (%s)", change.Kind, change.Event.Id, change.Event.Title, moduleName(change.Module), path)
+	case CapacityChanged:
+		return fmt.Sprintf("%s: %s in %s (%s): %s -> %s", change.Kind, change.Event.Id, moduleName(change.Module), path, change.Previous, change.Current)
+	case TeacherChanged:
+		return fmt.Sprintf("%s: %s (%s): %s -> %s", change.Kind, moduleName(change.Module), path, change.Previous, change.Current)
+	}
+	return fmt.Sprintf("%s: %s (%s)", change.Kind, moduleName(change.Module), path)
+}
+
+// Summary describes every change in a line, changes of the same kind are listed together.
+func Summary(changes []Change) string {
+	if len(changes) == 0 {
+		return "no changes\n"
+	}
+
+	var summary strings.Builder
+	fmt.Fprintf(&summary, "%d changes\n", len(changes))
+	for kind := CategoryAdded; kind <= RegistrationClosed; kind++ {
+		for _, change := range changes {
+			if change.Kind == kind {
+				summary.WriteString(change.String() + "\n")
+			}
+		}
+	}
+	return summary.String()
+}
+
+// capacity formats the capacity of an event like STiNE does, unlimited capacities are displayed as "-"
+func capacity(event stineapi.Event) string {
+	format := func(value float64) string {
+		if math.IsInf(value, 1) {
+			return "-"
+		}
+		return fmt.Sprintf("%g", value)
+	}
+	return fmt.Sprintf("%s | %s", format(event.MaxCapacity), format(event.CurrentCapacity))
+}
+
+// pair matches the elements of two lists by their keys, elements with the same key are matched in the order they are listed
+func pair(previousKeys []string, currentKeys []string, matched func(previous int, current int), removed func(previous int), added func(current int)) {
+	unmatched := map[string][]int{}
+	for i, key := range previousKeys {
+		unmatched[key] = append(unmatched[key], i)
+	}
+
+	wasMatched := make([]bool, len(previousKeys))
+	for j, key := range currentKeys {
+		if len(unmatched[key]) == 0 {
+			added(j)
+			continue
+		}
+		i := unmatched[key][0]
+		unmatched[key] = unmatched[key][1:]
+		wasMatched[i] = true
+		matched(i, j)
+	}
+
+	for i := range previousKeys {
+		if !wasMatched[i] {
+			removed(i)
+		}
+	}
+}
+
+func categoryKeys(categories []stineapi.Category) []string {
+	var keys []string
+	for _, category := range categories {
+		key := category.Title
+		if category.Id != "" {
+			key = category.Id
+		}
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+func moduleKeys(modules []stineapi.Module) []string {
+	var keys []string
+	for _, module := range modules {
+		key := module.Number + "\x00" + module.Title
+		if module.Id != "" {
+			key = module.Id
+		}
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+func eventKeys(events []stineapi.Event) []string {
+	var keys []string
+	for _, event := range events {
+		keys = append(keys, event.Id)
+	}
+	return keys
+}
+
+// comparison collects the changes between two category trees
+type comparison struct {
+	changes []Change
+}
+
+func (c *comparison) add(change Change) {
+	c.changes = append(c.changes, change)
+}
+
+// everything adds a change for the category and everything listed in it
+func (c *comparison) everything(category stineapi.Category, path []string, categoryKind Kind, moduleKind Kind) {
+	c.add(Change{Kind: categoryKind, Path: path})
+	for _, module := range category.Modules {
+		c.add(Change{Kind: moduleKind, Path: path, Module: module})
+	}
+	for _, child := range category.Categories {
+		c.everything(child, append(path[:len(path):len(path)], child.Title), categoryKind, moduleKind)
+	}
+}
+
+func (c *comparison) categories(previous stineapi.Category, current stineapi.Category, path []string) {
+	pair(moduleKeys(previous.Modules), moduleKeys(current.Modules), func(i int, j int) {
+		c.modules(previous.Modules[i], current.Modules[j], path)
+	}, func(i int) {
+		c.add(Change{Kind: ModuleRemoved, Path: path, Module: previous.Modules[i]})
+	}, func(j int) {
+		c.add(Change{Kind: ModuleAdded, Path: path, Module: current.Modules[j]})
+	})
+
+	childPath := func(child stineapi.Category) []string {
+		return append(path[:len(path):len(path)], child.Title)
+	}
+	pair(categoryKeys(previous.Categories), categoryKeys(current.Categories), func(i int, j int) {
+		c.categories(previous.Categories[i], current.Categories[j], childPath(current.Categories[j]))
+	}, func(i int) {
+		c.everything(previous.Categories[i], childPath(previous.Categories[i]), CategoryRemoved, ModuleRemoved)
+	}, func(j int) {
+		c.everything(current.Categories[j], childPath(current.Categories[j]), CategoryAdded, ModuleAdded)
+	})
+}
+
+func (c *comparison) modules(previous stineapi.Module, current stineapi.Module, path []string) {
+	if previous.Teacher != current.Teacher {
+		c.add(Change{Kind: TeacherChanged, Path: path, Module: current, Previous: previous.Teacher, Current: current.Teacher})
+	}
+	if previous.RegistrationLink == "" && current.RegistrationLink != "" {
+		c.add(Change{Kind: RegistrationOpened, Path: path, Module: current})
+	}
+	if previous.RegistrationLink != "" && current.RegistrationLink == "" {
+		c.add(Change{Kind: RegistrationClosed, Path: path, Module: current})
+	}
+
+	pair(eventKeys(previous.Events), eventKeys(current.Events), func(i int, j int) {
+		previousCapacity, currentCapacity := capacity(previous.Events[i]), capacity(current.Events[j])
+		if previousCapacity != currentCapacity {
+			c.add(Change{Kind: CapacityChanged, Path: path, Module: current, Event: current.Events[j], Previous: previousCapacity, Current: currentCapacity})
+		}
+	}, func(i int) {
+		c.add(Change{Kind: EventRemoved, Path: path, Module: previous, Event: previous.Events[i]})
+	}, func(j int) {
+		c.add(Change{Kind: EventAdded, Path: path, Module: current, Event: current.Events[j]})
+	})
+}
+
+/*
+Compare lists the changes from the previous to the current category tree. Categories and modules are matched by their id,
+if it is known, otherwise categories are matched by their title and modules by their number and title. Events are matched by their id.
+The titles of the root categories are ignored.
+
+The changes are listed in the order the categories and modules are listed on STiNE.
+*/
+func Compare(previous stineapi.Category, current stineapi.Category) []Change {
+	var c comparison
+	c.categories(previous, current, nil)
+	return c.changes
+}
@@ -0,0 +1,115 @@
+package diff
+
+import (
+	"fmt"
+	"github.com/google/go-cmp/cmp"
+	"github.com/martenmatrix/stine-api/cmd"
+	"math"
+	"testing"
+)
+
+func catalog() stineapi.Category {
+	return stineapi.Category{
+		Title: "initial",
+		Categories: []stineapi.Category{
+			{
+				Title: "Informatics",
+				Modules: []stineapi.Module{
+					{
+						Number:  "InfB-SE 2",
+						Title:   "Software Development II",
+						Teacher: "Peter Lustig",
+						Events: []stineapi.Event{
+							{Id: "64-010", Title: "Lecture", MaxCapacity: 550, CurrentCapacity: 162},
+							{Id: "64-012", Title: "Exercises", MaxCapacity: 458, CurrentCapacity: 130},
+						},
+					},
+					{
+						Number:           "InfB-VSS",
+						Title:            "Distributed Systems",
+						Teacher:          "Peter Parker",
+						RegistrationLink: "https://www.stine.uni-hamburg.de/scripts/register",
+						Events:           []stineapi.Event{{Id: "64-091", Title: "Lecture", MaxCapacity: math.Inf(1), CurrentCapacity: 99}},
+					},
+				},
+			},
+			{Title: "Electives", Modules: []stineapi.Module{{Number: "InfB-IKON", Title: "Interdisciplinary Colloquium"}}},
+		},
+	}
+}
+
+func TestCompare(t *testing.T) {
+	previous := catalog()
+	if changes := Compare(previous, catalog()); len(changes) != 0 {
+		t.Fatalf("identical catalogs should not differ, received: %+v", changes)
+	}
+
+	current := catalog()
+	informatics := &current.Categories[0]
+	se := &informatics.Modules[0]
+	se.Teacher = "Peter Lustig; Franz Karen"
+	se.RegistrationLink = "https://www.stine.uni-hamburg.de/scripts/register-se"
+	se.Events[0].CurrentCapacity = 163
+	se.Events = se.Events[:1]
+	vss := &informatics.Modules[1]
+	vss.RegistrationLink = ""
+	vss.Events = append(vss.Events, stineapi.Event{Id: "64-091a", Title: "Exercises", MaxCapacity: 30})
+	informatics.Categories = []stineapi.Category{{Title: "Projects", Modules: []stineapi.Module{{Number: "InfB-PRO", Title: "Project"}}}}
+	current.Categories = current.Categories[:1]
+
+	changes := Compare(previous, current)
+
+	var got []string
+	for _, change := range changes {
+		got = append(got, change.String())
+	}
+	want := []string{
+		"teacher changed: InfB-SE 2 Software Development II (Informatics): Peter Lustig -> Peter Lustig; Franz Karen",
+		"registration opened: InfB-SE 2 Software Development II (Informatics)",
+		"capacity changed: 64-010 in InfB-SE 2 Software Development II (Informatics): 550 | 162 -> 550 | 163",
+		"event removed: 64-012 Exercises in InfB-SE 2 Software Development II (Informatics)",
+		"registration closed: InfB-VSS Distributed Systems (Informatics)",
+		"event added: 64-091a Exercises in InfB-VSS Distributed Systems (Informatics)",
+		"category added: Informatics > Projects",
+		"module added: InfB-PRO Project (Informatics > Projects)",
+		"category removed: Electives",
+		"module removed: InfB-IKON Interdisciplinary Colloquium (Electives)",
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Error(fmt.Sprintf("changes were not detected correctly: %s", diff))
+	}
+
+	capacityChange := changes[2]
+	if capacityChange.Kind != CapacityChanged || capacityChange.Event.CurrentCapacity != 163 || capacityChange.Module.Number != "InfB-SE 2" {
+		t.Error(fmt.Sprintf("capacity change is missing the event or module: %+v", capacityChange))
+	}
+}
+
+func TestSummary(t *testing.T) {
+	if summary := Summary(nil); summary != "no changes\n" {
+		t.Error(fmt.Sprintf("WANT: %q, GOT: %q", "no changes\n", summary))
+	}
+
+	changes := []Change{
+		{Kind: ModuleRemoved, Path: []string{"Electives"}, Module: stineapi.Module{Title: "Colloquium"}},
+		{Kind: CategoryAdded, Path: []string{"Informatics", "Projects"}},
+	}
+	want := "2 changes\ncategory added: Informatics > Projects\nmodule removed: Colloquium (Electives)\n"
+	if summary := Summary(changes); summary != want {
+		t.Error(fmt.Sprintf("WANT: %q, GOT: %q", want, summary))
+	}
+}
+
+func TestCompareById(t *testing.T) {
+	previous := stineapi.Category{Categories: []stineapi.Category{
+		{Id: "389000000000001", Title: "Informatik", Modules: []stineapi.Module{{Id: "388000000000002", Title: "Softwareentwicklung II"}}},
+	}}
+	// the same category and module in english
+	current := stineapi.Category{Categories: []stineapi.Category{
+		{Id: "389000000000001", Title: "Informatics", Modules: []stineapi.Module{{Id: "388000000000002", Title: "Software Development II"}}},
+	}}
+
+	if changes := Compare(previous, current); len(changes) != 0 {
+		t.Error(fmt.Sprintf("categories and modules should be matched by their id, received: %+v", changes))
+	}
+}
@@ -58,8 +58,8 @@ func ExampleSession_RegisterForModule() {
 
 	// Create module registration
 	moduleRegistration := session.RegisterForModule(vssModule)
-	moduleRegistration.SetExamDate(1)            // Select second available exam date
-	tanReq, err := moduleRegistration.Register() // Send registration to servers
+	moduleRegistration.SetExamDate(SecondExamDate) // Select second available exam date
+	tanReq, err := moduleRegistration.Register()   // Send registration to servers
 
 	if err != nil {
 		// Handle error
@@ -97,3 +97,26 @@ func ExampleSession_ChangeLanguage() {
 
 	// Language is set to English
 }
+
+func ExampleSession_RegisterMany() {
+	// Session should be authenticated
+	session := NewSession()
+
+	// Modules ideally should be retrieved with GetCategories
+	group2, group4, lecture := Module{}, Module{}, Module{}
+
+	plan := RegistrationPlan{
+		Items: []PlanItem{
+			{Name: "Exercise", Priority: 1, Choices: []PlanChoice{{Module: group2}, {Module: group4}}}, // group 2, else group 4
+			{Name: "Lecture", Priority: 2, Choices: []PlanChoice{{Module: lecture, ExamDate: SecondExamDate}}},
+		},
+		DryRun: true, // Only resolve the registrations, remove to submit them
+		TanCallback: func(tanReq *TanRequired) (string, error) {
+			return "087233233", nil // Return the iTAN starting with tanReq.TanStartsWith
+		},
+	}
+
+	for _, result := range session.RegisterMany(plan) {
+		fmt.Println(result.Item.Name, result.Status, result.Choice, result.Err)
+	}
+}
@@ -0,0 +1,222 @@
+package stineapi
+
+import (
+	"errors"
+	"github.com/PuerkitoBio/goquery"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ExamDate represents the exam date, which is selected during a module registration.
+type ExamDate int
+
+const (
+	FirstExamDate  ExamDate = iota // Selects the first exam date (default choice)
+	SecondExamDate                 // Selects the second exam date
+	OtherSemester                  // Opts for writing the exam in a different semester (exact date not specified)
+)
+
+// ErrInvalidExamDate is returned, if an [ExamDate] other than the defined constants is passed.
+var ErrInvalidExamDate = errors.New("invalid exam date, only FirstExamDate, SecondExamDate and OtherSemester are accepted")
+
+// ErrInvalidExamOption is returned, if the selected exam is not offered by STiNE.
+var ErrInvalidExamOption = errors.New("selected exam is not offered by STiNE")
+
+// ExamKind represents the kind of an exam, it is parsed from the German and English labels on STiNE.
+type ExamKind int
+
+const (
+	UnknownExam ExamKind = iota // Kind could not be determined from the label
+	WrittenExam                 // e.g. "Klausur" or "Written exam"
+	OralExam                    // e.g. "mündliche Prüfung" or "Oral exam"
+	TermPaper                   // e.g. "Hausarbeit" or "Term paper"
+)
+
+// keywords in the labels of the exam kinds in German and English
+var examKindKeywords = []struct {
+	kind     ExamKind
+	keywords []string
+}{
+	{OralExam, []string{"mündlich", "muendlich", "oral"}},
+	{WrittenExam, []string{"klausur", "schriftlich", "written"}},
+	{TermPaper, []string{"hausarbeit", "term paper"}},
+}
+
+// parseExamKind returns the kind of the exam described by the label
+func parseExamKind(label string) ExamKind {
+	label = strings.ToLower(label)
+	for _, examKind := range examKindKeywords {
+		for _, keyword := range examKind.keywords {
+			if strings.Contains(label, keyword) {
+				return examKind.kind
+			}
+		}
+	}
+	return UnknownExam
+}
+
+/*
+ExamOption represents an exam the user can select on STiNE e.g. the first written exam or an oral exam.
+Fields, which are not listed on STiNE, are empty.
+*/
+type ExamOption struct {
+	Group string    // Name of the radio group the option belongs to, modules with multiple exams list one group per exam
+	Value string    // Value sent to STiNE, if the option is selected
+	Label string    // Label of the option as listed on STiNE e.g. "Klausur"
+	Kind  ExamKind  // Kind of the exam parsed from the label, independent of the language
+	Start time.Time // Start of the exam
+	End   time.Time // End of the exam, equals Start if no end time is listed
+	Room  string    // Room the exam takes place in
+}
+
+// ExamSelector is called with the exam options offered by STiNE and returns the option, which should be selected.
+type ExamSelector func(options []ExamOption) (ExamOption, error)
+
+var (
+	numericDateRegex = regexp.MustCompile(`(\d{1,2})\.(\d{1,2})\.(\d{4})`)                  // e.g. 24.07.2023
+	textDateRegex    = regexp.MustCompile(`(\d{1,2})\.\s*([A-Za-zäÄ]{3,4})\.?\s+(\d{4})`)   // e.g. Mo, 24. Jul. 2023 or Mon, 24. Jul. 2023
+	timeRegex        = regexp.MustCompile(`(\d{1,2}):(\d{2})(?:\s*-\s*(\d{1,2}):(\d{2}))?`) // e.g. 10:00 - 12:00
+)
+
+// abbreviations of the months in German and English
+var monthAbbreviations = map[string]time.Month{
+	"jan":  time.January,
+	"feb":  time.February,
+	"mär":  time.March,
+	"mrz":  time.March,
+	"mar":  time.March,
+	"apr":  time.April,
+	"mai":  time.May,
+	"may":  time.May,
+	"jun":  time.June,
+	"jul":  time.July,
+	"aug":  time.August,
+	"sep":  time.September,
+	"sept": time.September,
+	"okt":  time.October,
+	"oct":  time.October,
+	"nov":  time.November,
+	"dez":  time.December,
+	"dec":  time.December,
+}
+
+// stineLocation returns the time zone the dates on STiNE are listed in
+func stineLocation() *time.Location {
+	location, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		return time.Local
+	}
+	return location
+}
+
+// parseDate extracts the first date listed in the text, the second return value is false if no date was found
+func parseDate(text string) (int, time.Month, int, bool) {
+	if match := numericDateRegex.FindStringSubmatch(text); match != nil {
+		day, _ := strconv.Atoi(match[1])
+		month, _ := strconv.Atoi(match[2])
+		year, _ := strconv.Atoi(match[3])
+		return year, time.Month(month), day, true
+	}
+
+	if match := textDateRegex.FindStringSubmatch(text); match != nil {
+		month, known := monthAbbreviations[strings.ToLower(match[2])]
+		if !known {
+			return 0, 0, 0, false
+		}
+		day, _ := strconv.Atoi(match[1])
+		year, _ := strconv.Atoi(match[3])
+		return year, month, day, true
+	}
+
+	return 0, 0, 0, false
+}
+
+// parseTimeRange extracts the start and end of the first time range listed in the text on the passed date
+func parseTimeRange(text string, year int, month time.Month, day int) (time.Time, time.Time, bool) {
+	match := timeRegex.FindStringSubmatch(text)
+	if match == nil {
+		start := time.Date(year, month, day, 0, 0, 0, 0, stineLocation())
+		return start, start, false
+	}
+
+	startHour, _ := strconv.Atoi(match[1])
+	startMinute, _ := strconv.Atoi(match[2])
+	start := time.Date(year, month, day, startHour, startMinute, 0, 0, stineLocation())
+	if match[3] == "" {
+		return start, start, true
+	}
+
+	endHour, _ := strconv.Atoi(match[3])
+	endMinute, _ := strconv.Atoi(match[4])
+	return start, time.Date(year, month, day, endHour, endMinute, 0, 0, stineLocation()), true
+}
+
+// parseExamOption extracts the label, date and room of an exam from the table row the radio input is located in
+func parseExamOption(radio *goquery.Selection) ExamOption {
+	group, _ := radio.Attr("name")
+	value, _ := radio.Attr("value")
+	option := ExamOption{
+		Group: group,
+		Value: value,
+	}
+
+	var texts []string
+	row := radio.Closest("tr")
+	if row.Length() == 0 {
+		texts = []string{strings.TrimSpace(radio.Parent().Text())}
+	} else {
+		row.Find("td").Each(func(i int, cell *goquery.Selection) {
+			// skip the cell with the radio input
+			if cell.Find(`input[type="radio"]`).Length() == 0 {
+				texts = append(texts, strings.TrimSpace(cell.Text()))
+			}
+		})
+	}
+
+	var dateFound bool
+	var year, day int
+	var month time.Month
+	var rest []string
+
+	for _, text := range texts {
+		if text == "" {
+			continue
+		}
+		if !dateFound {
+			if year, month, day, dateFound = parseDate(text); dateFound {
+				option.Start, option.End, _ = parseTimeRange(text, year, month, day)
+				continue
+			}
+		}
+		if dateFound && timeRegex.MatchString(text) && len(timeRegex.FindString(text)) == len(text) {
+			// time is listed in a separate cell
+			option.Start, option.End, _ = parseTimeRange(text, year, month, day)
+			continue
+		}
+		rest = append(rest, text)
+	}
+
+	// the first remaining cell describes the exam, the last one is the room
+	if len(rest) > 0 {
+		option.Label = rest[0]
+		option.Kind = parseExamKind(option.Label)
+	}
+	if len(rest) > 1 {
+		option.Room = rest[len(rest)-1]
+	}
+
+	return option
+}
+
+// parseExamOptions extracts every exam the user can select on the page
+func parseExamOptions(doc *goquery.Document) []ExamOption {
+	var options []ExamOption
+
+	doc.Find(`input[type="radio"]`).Each(func(i int, radio *goquery.Selection) {
+		options = append(options, parseExamOption(radio))
+	})
+
+	return options
+}
@@ -0,0 +1,129 @@
+package stineapi
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/PuerkitoBio/goquery"
+	"github.com/google/go-cmp/cmp"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+)
+
+const examSelectionPage = `
+	<input name="PRGNAME" type="hidden" value="SAVEEXAMDETAILS">
+	<table>
+		<tr>
+			<td><input type="radio" name="RB_388233088543" value=" 1"></td>
+			<td>Klausur</td>
+			<td>Mo, 24. Jul. 2023</td>
+			<td>10:00 - 12:00</td>
+			<td>ESA A</td>
+		</tr>
+		<tr>
+			<td><input type="radio" name="RB_388233088543" value=" 2"></td>
+			<td>Klausur</td>
+			<td>Mi, 27. Sep. 2023 14:00 - 16:00</td>
+			<td>Audimax</td>
+		</tr>
+		<tr>
+			<td><input type="radio" name="RB_388233088543" value=" 3"></td>
+			<td>mündliche Prüfung</td>
+			<td>02.10.2023</td>
+			<td>09:30</td>
+			<td>D-220</td>
+		</tr>
+		<tr>
+			<td><input type="radio" name="RB_388233088543" value="99"></td>
+			<td>Prüfung in einem anderen Semester</td>
+		</tr>
+	</table>
+`
+
+func TestParseExamOptions(t *testing.T) {
+	doc, err := goquery.NewDocumentFromReader(io.NopCloser(bytes.NewBufferString(examSelectionPage)))
+	if err != nil {
+		t.Errorf(err.Error())
+	}
+
+	berlin := stineLocation()
+	shouldReturn := []ExamOption{
+		{
+			Group: "RB_388233088543",
+			Value: " 1",
+			Label: "Klausur",
+			Kind:  WrittenExam,
+			Start: time.Date(2023, time.July, 24, 10, 0, 0, 0, berlin),
+			End:   time.Date(2023, time.July, 24, 12, 0, 0, 0, berlin),
+			Room:  "ESA A",
+		},
+		{
+			Group: "RB_388233088543",
+			Value: " 2",
+			Label: "Klausur",
+			Kind:  WrittenExam,
+			Start: time.Date(2023, time.September, 27, 14, 0, 0, 0, berlin),
+			End:   time.Date(2023, time.September, 27, 16, 0, 0, 0, berlin),
+			Room:  "Audimax",
+		},
+		{
+			Group: "RB_388233088543",
+			Value: " 3",
+			Label: "mündliche Prüfung",
+			Kind:  OralExam,
+			Start: time.Date(2023, time.October, 2, 9, 30, 0, 0, berlin),
+			End:   time.Date(2023, time.October, 2, 9, 30, 0, 0, berlin),
+			Room:  "D-220",
+		},
+		{
+			Group: "RB_388233088543",
+			Value: "99",
+			Label: "Prüfung in einem anderen Semester",
+		},
+	}
+
+	options := parseExamOptions(doc)
+	if !cmp.Equal(options, shouldReturn) {
+		t.Error(cmp.Diff(shouldReturn, options))
+	}
+}
+
+func TestSelectExam(t *testing.T) {
+	doc, err := goquery.NewDocumentFromReader(io.NopCloser(bytes.NewBufferString(examSelectionPage)))
+	if err != nil {
+		t.Errorf(err.Error())
+	}
+
+	modReg := createModuleRegistration("x", "232323", &http.Client{})
+
+	// exam date is used without selector
+	modReg.SetExamDate(OtherSemester)
+	group, value, err := modReg.selectExam(doc)
+	if err != nil || group != "RB_388233088543" || value != "99" {
+		t.Error(fmt.Sprintf("unexpected selection: %s %s %s", group, value, err))
+	}
+
+	// selector overrides exam date
+	modReg.SetExamSelector(func(options []ExamOption) (ExamOption, error) {
+		for _, option := range options {
+			if option.Label == "mündliche Prüfung" {
+				return option, nil
+			}
+		}
+		return ExamOption{}, nil
+	})
+	group, value, err = modReg.selectExam(doc)
+	if err != nil || value != " 3" {
+		t.Error(fmt.Sprintf("oral exam should be selected, received: %s %s %s", group, value, err))
+	}
+
+	// options not offered by stine are rejected
+	modReg.SetExamSelector(func(options []ExamOption) (ExamOption, error) {
+		return ExamOption{Group: "RB_388233088543", Value: " 4"}, nil
+	})
+	_, _, err = modReg.selectExam(doc)
+	if err != ErrInvalidExamOption {
+		t.Error(fmt.Sprintf("WANT: %s, GOT: %s", ErrInvalidExamOption, err))
+	}
+}
@@ -0,0 +1,270 @@
+package stineapi
+
+import (
+	"errors"
+	"fmt"
+	"github.com/PuerkitoBio/goquery"
+	"github.com/martenmatrix/stine-api/cmd/internal/campusnet"
+	"github.com/martenmatrix/stine-api/cmd/internal/onPage"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const examMenuId = "000310" // default menu id of "Exams" > "Exam registration"
+
+// examRegistrationURL returns the url of the exam registration page
+func examRegistrationURL(sessionNumber string, menuId string) string {
+	return campusnet.Request{PrgName: "EXAMREGISTRATION", SessionNo: sessionNumber, MenuId: menuId}.URL()
+}
+
+// ErrDeadlinePassed is returned, if the deadline to register for or deregister from an exam has passed.
+var ErrDeadlinePassed = errors.New("the deadline to register for or deregister from the exam has passed")
+
+// ErrNoDeregistrationLink is returned, if an exam has no deregistration link, which is the case if the user is not registered for it.
+var ErrNoDeregistrationLink = errors.New("exam has no deregistration link, the user may not be registered for it")
+
+// ErrDeregistrationNotOpen is returned, if STiNE does not offer a deregistration form for the exam.
+var ErrDeregistrationNotOpen = errors.New("deregistration is not open, unable to find registration id in response")
+
+// Exam represents an exam listed under "Exams" > "Exam registration".
+type Exam struct {
+	Module             string    // Title of the module the exam belongs to
+	Title              string    // Title of the exam e.g. "Klausur"
+	Kind               ExamKind  // Kind of the exam parsed from the title, independent of the language
+	Start              time.Time // Start of the exam, zero if not listed
+	Deadline           time.Time // Point in time until the user can register for or deregister from the exam, zero if not listed
+	Registered         bool      // Whether the user is registered for the exam
+	RegistrationLink   string    // Link to register for the exam, empty if the user is already registered
+	DeregistrationLink string    // Link to deregister from the exam, empty if the user is not registered
+}
+
+// DeadlinePassed checks, if the deadline to register for or deregister from the exam has passed.
+func (exam Exam) DeadlinePassed() bool {
+	return !exam.Deadline.IsZero() && time.Now().After(exam.Deadline)
+}
+
+// extracts an exam from a table row of the exam registration page
+func extractExam(row *goquery.Selection) Exam {
+	var exam Exam
+	var texts []string
+
+	row.Find("td").Each(func(i int, cell *goquery.Selection) {
+		if cell.Find("a.register, a.deregister").Length() == 0 {
+			texts = append(texts, strings.TrimSpace(cell.Text()))
+		}
+	})
+
+	var datesFound int
+	var rest []string
+	for _, text := range texts {
+		if text == "" {
+			continue
+		}
+		year, month, day, isDate := parseDate(text)
+		if !isDate {
+			rest = append(rest, text)
+			continue
+		}
+
+		start, end, hasTime := parseTimeRange(text, year, month, day)
+		if datesFound == 0 {
+			exam.Start = start
+		} else {
+			exam.Deadline = end
+			if !hasTime {
+				// deadline ends with the listed day
+				exam.Deadline = start.AddDate(0, 0, 1).Add(-time.Second)
+			}
+		}
+		datesFound++
+	}
+
+	if len(rest) > 0 {
+		exam.Module = rest[0]
+	}
+	if len(rest) > 1 {
+		exam.Title = rest[1]
+		exam.Kind = parseExamKind(exam.Title)
+	}
+
+	registrationLink, exists := row.Find("a.register").Attr("href")
+	if exists {
+		exam.RegistrationLink = addSTiNEPrefix(registrationLink)
+	}
+	deregistrationLink, exists := row.Find("a.deregister").Attr("href")
+	if exists {
+		exam.DeregistrationLink = addSTiNEPrefix(deregistrationLink)
+		exam.Registered = true
+	}
+
+	return exam
+}
+
+// getExams returns every exam listed on the exam registration page
+func getExams(client *http.Client, examURL string) ([]Exam, error) {
+	res, err := client.Get(examURL)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	doc, err := goquery.NewDocumentFromReader(res.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	var exams []Exam
+	doc.Find("tr:has(a.register), tr:has(a.deregister)").Each(func(i int, row *goquery.Selection) {
+		exams = append(exams, extractExam(row))
+	})
+
+	return exams, nil
+}
+
+// getDocument requests the url and returns the parsed response
+func getDocument(client *http.Client, reqURL string) (*goquery.Document, error) {
+	res, err := client.Get(reqURL)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	return goquery.NewDocumentFromReader(res.Body)
+}
+
+// ErrRegistrationRejected is wrapped by a [RejectedError], if STiNE rejected a registration or deregistration e.g. because the event is fully booked.
+var ErrRegistrationRejected = errors.New("stine rejected the registration")
+
+// RejectedError is returned, if STiNE displayed an error message instead of completing a registration or deregistration.
+type RejectedError struct {
+	Message string // Error message displayed by STiNE e.g. "Die Veranstaltung ist ausgebucht"
+}
+
+func (rejectedErr *RejectedError) Error() string {
+	return fmt.Sprintf("stine returned an error: %s", rejectedErr.Message)
+}
+
+func (rejectedErr *RejectedError) Unwrap() error {
+	return ErrRegistrationRejected
+}
+
+// checkForError returns the error message displayed by stine as a [RejectedError], if there is one
+func checkForError(doc *goquery.Document) error {
+	errorMsg := strings.Join(strings.Fields(doc.Find(".error").First().Text()), " ")
+	if errorMsg != "" {
+		return &RejectedError{Message: errorMsg}
+	}
+	return nil
+}
+
+// submitForm sends every hidden input of the first form on the page to reqURL and returns the parsed response
+func submitForm(client *http.Client, reqURL string, doc *goquery.Document) (*goquery.Document, error) {
+	formQuery := url.Values{}
+	doc.Find(`form`).First().Find(`input[type="hidden"]`).Each(func(i int, input *goquery.Selection) {
+		name, _ := input.Attr("name")
+		value, _ := input.Attr("value")
+		formQuery.Add(name, value)
+	})
+
+	res, err := client.PostForm(reqURL, formQuery)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	return goquery.NewDocumentFromReader(res.Body)
+}
+
+// getExamOptions returns the exam dates the user can select for the exam
+func getExamOptions(client *http.Client, sessionNumber string, exam Exam) ([]ExamOption, error) {
+	if exam.RegistrationLink == "" {
+		return nil, ErrNoRegistrationLink
+	}
+
+	doc, err := getDocument(client, campusnet.RefreshSessionNo(exam.RegistrationLink, sessionNumber))
+	if err != nil {
+		return nil, err
+	}
+	return parseExamOptions(doc), nil
+}
+
+// registerForExam selects the option on the registration page of the exam
+func registerForExam(client *http.Client, sessionNumber string, menuId string, exam Exam, option ExamOption) (*TanRequired, error) {
+	if exam.RegistrationLink == "" {
+		return nil, ErrNoRegistrationLink
+	}
+	if exam.DeadlinePassed() {
+		return nil, ErrDeadlinePassed
+	}
+
+	registrationLink := campusnet.RefreshSessionNo(exam.RegistrationLink, sessionNumber)
+	doc, err := getDocument(client, registrationLink)
+	if err != nil {
+		return nil, err
+	}
+
+	// without a registration id no options are offered, as the registration window is closed
+	regId, exists := doc.Find(`input[name="rgtr_id"]`).First().Attr("value")
+	if !exists {
+		return nil, ErrRegistrationNotOpen
+	}
+
+	var offered bool
+	for _, offeredOption := range parseExamOptions(doc) {
+		if offeredOption.Group == option.Group && offeredOption.Value == option.Value {
+			offered = true
+		}
+	}
+	if !offered {
+		return nil, ErrInvalidExamOption
+	}
+
+	res, err := doExamRegistrationRequest(client, registrationLink, option.Group, sessionNumber, menuId, regId, option.Value, nextButton(doc))
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	resDoc, err := goquery.NewDocumentFromReader(res.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if onPage.OniTANPage(resDoc) {
+		// exam registrations and deregistrations send the tan to different programs
+		return newTanRequired(resDoc, client, sessionNumber, registrationLink, regId, tanFormProgram(resDoc, "SAVEREGISTRATION")), nil
+	}
+	return nil, checkForError(resDoc)
+}
+
+// deregisterFromExam confirms the deregistration on the deregistration page of the exam
+func deregisterFromExam(client *http.Client, sessionNumber string, exam Exam) (*TanRequired, error) {
+	if exam.DeregistrationLink == "" {
+		return nil, ErrNoDeregistrationLink
+	}
+	if exam.DeadlinePassed() {
+		return nil, ErrDeadlinePassed
+	}
+
+	deregistrationLink := campusnet.RefreshSessionNo(exam.DeregistrationLink, sessionNumber)
+	doc, err := getDocument(client, deregistrationLink)
+	if err != nil {
+		return nil, err
+	}
+
+	regId, exists := doc.Find(`input[name="rgtr_id"]`).First().Attr("value")
+	if !exists {
+		return nil, ErrDeregistrationNotOpen
+	}
+	resDoc, err := submitForm(client, deregistrationLink, doc)
+	if err != nil {
+		return nil, err
+	}
+
+	if onPage.OniTANPage(resDoc) {
+		return newTanRequired(resDoc, client, sessionNumber, deregistrationLink, regId, tanFormProgram(resDoc, "SAVEREGISTRATION")), nil
+	}
+	return nil, checkForError(resDoc)
+}
@@ -0,0 +1,207 @@
+package stineapi
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+const examRegistrationPage = `
+	<table>
+		<tr>
+			<td>InfB-SE 2 Software Development II</td>
+			<td>Klausur</td>
+			<td>Mo, 24. Jul. 2023 10:00 - 12:00</td>
+			<td>10.07.2023</td>
+			<td><a class="register" href="/scripts/registerexam">Register</a></td>
+		</tr>
+		<tr>
+			<td>InfB-VSS Distributed Systems and Systems Security</td>
+			<td>mündliche Prüfung</td>
+			<td>02.10.2023 09:30</td>
+			<td>25.09.2023 23:59</td>
+			<td><a class="deregister" href="/scripts/deregisterexam">Deregister</a></td>
+		</tr>
+	</table>
+`
+
+func TestGetExams(t *testing.T) {
+	fakeServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(examRegistrationPage))
+	}))
+	defer fakeServer.Close()
+
+	exams, err := getExams(&http.Client{}, fakeServer.URL)
+	if err != nil {
+		t.Errorf(err.Error())
+	}
+
+	if len(exams) != 2 {
+		t.Fatalf("expected 2 exams, received %d", len(exams))
+	}
+
+	berlin := stineLocation()
+	se := exams[0]
+	if se.Module != "InfB-SE 2 Software Development II" || se.Title != "Klausur" || se.Registered {
+		t.Error(fmt.Sprintf("exam was not parsed correctly: %+v", se))
+	}
+	if !se.Start.Equal(time.Date(2023, time.July, 24, 10, 0, 0, 0, berlin)) {
+		t.Errorf("unexpected start: %s", se.Start)
+	}
+	if !se.Deadline.Equal(time.Date(2023, time.July, 10, 23, 59, 59, 0, berlin)) {
+		t.Errorf("deadline should end with the listed day, received: %s", se.Deadline)
+	}
+	if se.RegistrationLink == "" || se.DeregistrationLink != "" {
+		t.Error("user should only be able to register for the exam")
+	}
+
+	vss := exams[1]
+	if !vss.Registered || vss.DeregistrationLink == "" || vss.RegistrationLink != "" {
+		t.Error("user should only be able to deregister from the exam")
+	}
+	if !vss.Deadline.Equal(time.Date(2023, time.September, 25, 23, 59, 0, 0, berlin)) {
+		t.Errorf("unexpected deadline: %s", vss.Deadline)
+	}
+}
+
+func TestRegisterForExam(t *testing.T) {
+	var requestCounter int
+
+	fakeServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestCounter++
+
+		switch requestCounter {
+		case 1:
+			w.Write([]byte(`
+				<input name="rgtr_id" value="4242">
+				<table><tr><td><input type="radio" name="RB_1" value=" 2"></td><td>Klausur</td></tr></table>
+			`))
+		case 2:
+			err := r.ParseForm()
+			if err != nil {
+				t.Errorf("ERROR: %s", err)
+			}
+			if r.Form.Get("RB_1") != " 2" || r.Form.Get("rgtr_id") != "4242" || r.Form.Get("PRGNAME") != "SAVEEXAMDETAILS" {
+				t.Error(fmt.Sprintf("form was not sent with correct attributes: %s", r.Form))
+			}
+			w.Write([]byte(`<form method="post"><input name="PRGNAME" type="hidden" value="SAVEEXAMREGISTRATION"><span class="itan"> 12</span><input type="text" name="tan_code"></form>`))
+		case 3:
+			err := r.ParseForm()
+			if err != nil {
+				t.Errorf("ERROR: %s", err)
+			}
+			if r.Form.Get("PRGNAME") != "SAVEEXAMREGISTRATION" || r.Form.Get("tan_code") != "123456" || r.Form.Get("rgtr_id") != "4242" {
+				t.Error(fmt.Sprintf("itan was not sent with correct attributes: %s", r.Form))
+			}
+		}
+	}))
+	defer fakeServer.Close()
+
+	exam := Exam{RegistrationLink: fakeServer.URL, Deadline: time.Now().Add(time.Hour)}
+
+	// option is not offered
+	_, err := registerForExam(&http.Client{}, "1234", "000310", exam, ExamOption{Group: "RB_1", Value: " 1"})
+	if err != ErrInvalidExamOption {
+		t.Error(fmt.Sprintf("WANT: %s, GOT: %s", ErrInvalidExamOption, err))
+	}
+
+	requestCounter = 0
+	tanReq, err := registerForExam(&http.Client{}, "1234", "000310", exam, ExamOption{Group: "RB_1", Value: " 2"})
+	if err != nil {
+		t.Errorf(err.Error())
+	}
+	if tanReq == nil || tanReq.TanStartsWith != "012" {
+		t.Fatal("an itan is required, however no tanrequired object was returned")
+	}
+
+	err = tanReq.SetTan("012123456")
+	if err != nil {
+		t.Errorf(err.Error())
+	}
+	if requestCounter != 3 {
+		t.Error(fmt.Sprintf("expected 3 requests, however received %d", requestCounter))
+	}
+}
+
+func TestExamRegistrationClosed(t *testing.T) {
+	var posted bool
+
+	fakeServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			posted = true
+		}
+		// stine still lists the exam dates, but offers no form to select them
+		w.Write([]byte(`
+			<form><input type="hidden" name="PRGNAME" value="SAVEEXAMDEREGISTRATION"></form>
+			<table><tr><td><input type="radio" name="RB_1" value=" 2" disabled></td><td>Klausur</td></tr></table>
+		`))
+	}))
+	defer fakeServer.Close()
+
+	exam := Exam{RegistrationLink: fakeServer.URL, DeregistrationLink: fakeServer.URL, Deadline: time.Now().Add(time.Hour)}
+
+	_, err := registerForExam(&http.Client{}, "1234", "000310", exam, ExamOption{Group: "RB_1", Value: " 1"})
+	if err != ErrRegistrationNotOpen {
+		t.Error(fmt.Sprintf("WANT: %s, GOT: %s", ErrRegistrationNotOpen, err))
+	}
+
+	_, err = deregisterFromExam(&http.Client{}, "1234", exam)
+	if err != ErrDeregistrationNotOpen {
+		t.Error(fmt.Sprintf("WANT: %s, GOT: %s", ErrDeregistrationNotOpen, err))
+	}
+	if posted {
+		t.Error("no form should be submitted, if the window is closed")
+	}
+}
+
+func TestExamDeadlinePassed(t *testing.T) {
+	exam := Exam{
+		RegistrationLink:   "x",
+		DeregistrationLink: "x",
+		Deadline:           time.Now().Add(-time.Minute),
+	}
+
+	_, err := registerForExam(&http.Client{}, "1234", "000310", exam, ExamOption{})
+	if err != ErrDeadlinePassed {
+		t.Error(fmt.Sprintf("WANT: %s, GOT: %s", ErrDeadlinePassed, err))
+	}
+
+	_, err = deregisterFromExam(&http.Client{}, "1234", exam)
+	if err != ErrDeadlinePassed {
+		t.Error(fmt.Sprintf("WANT: %s, GOT: %s", ErrDeadlinePassed, err))
+	}
+}
+
+func TestDeregisterFromExam(t *testing.T) {
+	var formSent bool
+
+	fakeServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			w.Write([]byte(`
+				<form>
+					<input type="hidden" name="PRGNAME" value="SAVEEXAMDEREGISTRATION">
+					<input type="hidden" name="rgtr_id" value="4242">
+				</form>
+			`))
+			return
+		}
+
+		err := r.ParseForm()
+		if err != nil {
+			t.Errorf("ERROR: %s", err)
+		}
+		formSent = r.Form.Get("PRGNAME") == "SAVEEXAMDEREGISTRATION" && r.Form.Get("rgtr_id") == "4242"
+		w.Write([]byte(`<span class="error">Deregistration is not possible anymore</span>`))
+	}))
+	defer fakeServer.Close()
+
+	_, err := deregisterFromExam(&http.Client{}, "1234", Exam{DeregistrationLink: fakeServer.URL})
+	if !formSent {
+		t.Error("deregistration form was not submitted")
+	}
+	if err == nil {
+		t.Error("error displayed by stine should be returned")
+	}
+}
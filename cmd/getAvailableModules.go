@@ -1,8 +1,10 @@
 package stineapi
 
 import (
+	"errors"
 	"fmt"
 	"github.com/PuerkitoBio/goquery"
+	"github.com/martenmatrix/stine-api/cmd/internal/campusnet"
 	"github.com/martenmatrix/stine-api/cmd/internal/stineURL"
 	"math"
 	"net/http"
@@ -12,28 +14,33 @@ import (
 )
 
 type Category struct {
-	Title      string       // Title of the Category e.g. "Compulsory Modules Informatics"
-	Url        string       // Link associated to title anchor
-	Categories []Category   // All categories, which are listed under the current category
-	Modules    []Module     // All Module's the category contains
-	clientUsed *http.Client // The client used for the initial request
+	Id         string         `json:"id"`         // ID of the category, which does not change between sessions, empty for the initial category
+	Title      string         `json:"title"`      // Title of the Category e.g. "Compulsory Modules Informatics"
+	Url        string         `json:"url"`        // Link associated to title anchor
+	Categories []Category     `json:"categories"` // All categories, which are listed under the current category
+	Modules    []Module       `json:"modules"`    // All Module's the category contains
+	clientUsed *http.Client   // The client used for the initial request
+	cacheUsed  *cacheSettings // The cache the category was read from, nil if no cache is used
 }
 
 // Module represents a module open for registration.
 type Module struct {
-	Title            string  // Title of the module
-	Teacher          string  // Teachers of the module
-	RegistrationLink string  // Link a user gets re-directed to, if he wants to register for the module. It will return an empty string, if the user has already registered for the module
-	Events           []Event // All events, which are correlated to the module like exercises and lectures
+	Id               string  `json:"id"`               // ID of the module, which does not change between sessions
+	Number           string  `json:"number"`           // Number of the module e.g. "InfB-SE 2"
+	Title            string  `json:"title"`            // Title of the module
+	Teacher          string  `json:"teacher"`          // Teachers of the module
+	RegistrationLink string  `json:"registrationLink"` // Link a user gets re-directed to, if he wants to register for the module. It will return an empty string, if the user has already registered for the module
+	Events           []Event `json:"events"`           // All events, which are correlated to the module like exercises and lectures
 }
 
 // Event represents events of a module like exercises or lectures.
 type Event struct {
-	Id              string  // ID of the event in the following format 64-010
-	Title           string  // Title of the event
-	Link            string  // The link a user gets re-directed to, if he clicks the title
-	MaxCapacity     float64 // Maximum student capacity of the event
-	CurrentCapacity float64 // Currently registered students for the event
+	Id              string  `json:"id"`              // ID of the event in the following format 64-010
+	CourseId        string  `json:"courseId"`        // ID of the course STiNE uses in links, which does not change between sessions
+	Title           string  `json:"title"`           // Title of the event
+	Link            string  `json:"link"`            // The link a user gets re-directed to, if he clicks the title
+	MaxCapacity     float64 `json:"maxCapacity"`     // Maximum student capacity of the event, math.Inf(1) if it is unlimited
+	CurrentCapacity float64 `json:"currentCapacity"` // Currently registered students for the event, math.Inf(1) if STiNE does not list them
 }
 
 // check if string already contains http for testing purposes, otherwise add stine url before path
@@ -66,6 +73,7 @@ func extractCategories(doc *goquery.Document, client *http.Client) ([]Category,
 		}
 
 		categories = append(categories, Category{
+			Id:         campusnet.ParseId(link),
 			Title:      title,
 			Url:        addSTiNEPrefix(link),
 			clientUsed: client,
@@ -139,6 +147,7 @@ func extractEvent(eventSelection *goquery.Selection) (Event, error) {
 
 	return Event{
 		Id:              id,
+		CourseId:        campusnet.ParseId(link),
 		Title:           title,
 		Link:            addSTiNEPrefix(link),
 		MaxCapacity:     maxCap,
@@ -180,6 +189,11 @@ func extractModules(doc *goquery.Document) ([]Module, error) {
 		if strings.Contains(html, "<!-- MODULE -->") {
 			// iterate over each module
 			title := selection.Find(".eventTitle").Text()
+			// the number precedes the title in the link of the module
+			moduleLink := selection.Find(".eventTitle").First().Parent()
+			numberLink := moduleLink.Clone()
+			numberLink.Find(".eventTitle").Remove()
+			number := strings.TrimSpace(numberLink.Text())
 			teacher := selection.Find("p:not(:has(a))").Text()
 			registerLink, exists := selection.Find(".register").Attr("href")
 			if !exists {
@@ -191,7 +205,16 @@ func extractModules(doc *goquery.Document) ([]Module, error) {
 				events = []Event{}
 			}
 
+			// the module is identified by its link, the registration link is used, if it has none
+			detailsLink, _ := moduleLink.Attr("href")
+			id := campusnet.ParseId(detailsLink)
+			if id == "" {
+				id = campusnet.ParseId(registerLink)
+			}
+
 			modules = append(modules, Module{
+				Id:               id,
+				Number:           number,
 				Title:            title,
 				Teacher:          teacher,
 				RegistrationLink: addSTiNEPrefix(registerLink),
@@ -211,6 +234,10 @@ func getCategory(client *http.Client, title string, url string) (Category, error
 	if errGet != nil {
 		return Category{}, errGet
 	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return Category{}, errors.New(fmt.Sprintf("unable to fetch category %q, stine responded with status %d", title, resp.StatusCode))
+	}
 
 	// convert to goquery doc
 	doc, docErr := goquery.NewDocumentFromReader(resp.Body)
@@ -228,6 +255,7 @@ func getCategory(client *http.Client, title string, url string) (Category, error
 		return Category{}, errMod
 	}
 
+	category.Id = campusnet.ParseId(url)
 	category.Title = title
 	category.Url = url
 	// set categories and modules of current category
@@ -238,40 +266,31 @@ func getCategory(client *http.Client, title string, url string) (Category, error
 	return category, nil
 }
 
-var depth int
-
-func resetDepth() {
-	depth = 0
-}
-
-// recursively gets all child categories of the passed category and returns the edited passed category struct
-func getChildCategories(client *http.Client, category Category, maxDepth int) (Category, error) {
-	defer resetDepth()
-
-	if depth >= maxDepth {
-		// break
+// crawl fetches the category and its child categories up to depth levels below it, the category itself is re-fetched, if force is set.
+// Failed child categories are collected in partial, if it is not nil, otherwise they abort the crawl.
+func crawl(client *http.Client, cache *cacheSettings, title string, url string, depth int, force bool, partial *partialCrawl) (Category, error) {
+	category, err := cache.getCategory(client, title, url, force)
+	if err != nil {
+		return Category{}, err
+	}
+	if depth <= 0 {
 		return category, nil
 	}
 
 	var childCategories []Category
-
-	for _, category := range category.Categories {
-		// needs to be child of prev category
-		parsedCategory, parseErr := getCategory(client, category.Title, category.Url)
-		if parseErr != nil {
-			return Category{}, parseErr
-		}
-
-		// parse every child category and add it to struct
-		childCategories = append(childCategories, parsedCategory)
-
-		depth++
-		_, err := getChildCategories(client, parsedCategory, maxDepth)
+	for _, child := range category.Categories {
+		crawledChild, err := crawl(client, cache, child.Title, child.Url, depth-1, false, partial.child(child.Title))
 		if err != nil {
-			return Category{}, err
+			// every further category would fail as well during a maintenance
+			if partial == nil || errors.Is(err, ErrMaintenance) {
+				return Category{}, err
+			}
+			// keep the link to the category, so it can be refreshed later
+			partial.failed(child, err)
+			crawledChild = child
 		}
+		childCategories = append(childCategories, crawledChild)
 	}
-	// store new categories as child
 	category.Categories = childCategories
 
 	return category, nil
@@ -288,21 +307,13 @@ as it exceeds the specified depth limit.
 
 The registerURL represents the URL, which re-directs to "Studying" > "Register for modules and courses".
 
-The client is the HTTP Client the requests should be executed with.
-*/
-func getAvailableModules(depth int, registerURL string, client *http.Client) (Category, error) {
-	// handle first page
-	firstCategory, firstCatErr := getCategory(client, "initial", registerURL)
-	if firstCatErr != nil {
-		return Category{}, firstCatErr
-	}
+The client is the HTTP Client the requests should be executed with. Categories younger than the ttl of the cache are read from it, the cache may be nil.
 
-	withSubCategories, err := getChildCategories(client, firstCategory, depth)
-	if err != nil {
-		return Category{}, err
-	}
-
-	return withSubCategories, nil
+If partial is nil, the first category, which cannot be fetched, aborts the crawl. Otherwise the failed categories are collected in partial
+and returned without their content.
+*/
+func getAvailableModules(depth int, registerURL string, client *http.Client, cache *cacheSettings, partial *partialCrawl) (Category, error) {
+	return crawl(client, cache, "initial", registerURL, depth, false, partial)
 }
 
 /*
@@ -310,21 +321,17 @@ Refresh re-fetches the data of a category from the STiNE servers. The session of
 
 In order to refresh a module, the whole category needs to be re-fetched, which makes a Refresh function for a module useless.
 
-The client is the HTTP client used for the request, needs to be authenticated on STiNE.
+A category loaded with LoadCatalog needs to be attached to a session with Session.Attach first, otherwise [ErrNotAttached] is returned.
+
+If the category was crawled with a cache, see Session.SetCategoryCache, only the category itself is always re-fetched,
+its child categories are read from the cache, if they are younger than the ttl.
 
 The depth indicates how deep different categories are nested within a category.
 */
 func (category *Category) Refresh(depth int) (Category, error) {
-	// handle first page
-	firstCategory, firstCatErr := getCategory(category.clientUsed, category.Title, category.Url)
-	if firstCatErr != nil {
-		return Category{}, firstCatErr
-	}
-
-	withSubCategories, err := getChildCategories(category.clientUsed, firstCategory, depth)
-	if err != nil {
-		return Category{}, nil
+	if category.clientUsed == nil {
+		return Category{}, ErrNotAttached
 	}
 
-	return withSubCategories, nil
+	return crawl(category.clientUsed, category.cacheUsed, category.Title, category.Url, depth, true, nil)
 }
@@ -9,6 +9,7 @@ import (
 	"math"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 )
 
@@ -290,7 +291,7 @@ func TestGetAvailableModules(t *testing.T) {
 		}
 	}))
 
-	modules, err := getAvailableModules(1, firstCategoryPage.URL, &http.Client{})
+	modules, err := getAvailableModules(1, firstCategoryPage.URL, &http.Client{}, nil, nil)
 
 	if err != nil {
 		t.Errorf(err.Error())
@@ -318,6 +319,7 @@ func TestGetAvailableModules(t *testing.T) {
 			},
 			Modules: []Module{
 				{
+					Number:           "InfB-SE 2",
 					Title:            "Software Development II (SuSe 23)",
 					Teacher:          "Peter Lustig; Franz Karen",
 					RegistrationLink: stineURL.Url + "/scripts/mgrqispi.dll?REGISTERFORMODULE",
@@ -339,6 +341,7 @@ func TestGetAvailableModules(t *testing.T) {
 					},
 				},
 				{
+					Number:           "InfB-VSS",
 					Title:            "Distributed Systems and Systems Security (SuSe 23)",
 					Teacher:          "Peter Parker 2",
 					RegistrationLink: "", // should be empty, as simulated user is already registered
@@ -490,7 +493,7 @@ func TestRefreshModule(t *testing.T) {
 		}
 	}))
 
-	modules, err := getAvailableModules(1, firstCategoryPage.URL, &http.Client{})
+	modules, err := getAvailableModules(1, firstCategoryPage.URL, &http.Client{}, nil, nil)
 
 	if err != nil {
 		t.Errorf(err.Error())
@@ -505,6 +508,7 @@ func TestRefreshModule(t *testing.T) {
 			Categories: []Category(nil),
 			Modules: []Module{
 				{
+					Number:           "InfB-VSS",
 					Title:            "Distributed Systems and Systems Security (SuSe 23)",
 					Teacher:          "Peter Parker 2",
 					RegistrationLink: "", // should be empty, as simulated user is already registered
@@ -542,6 +546,7 @@ func TestRefreshModule(t *testing.T) {
 		Categories: []Category(nil),
 		Modules: []Module{
 			{
+				Number:           "InfB-VSS",
 				Title:            "Distributed Systems and Systems Security (SuSe 23)",
 				Teacher:          "Peter Parker 2",
 				RegistrationLink: "", // should be empty, as simulated user is already registered
@@ -564,3 +569,35 @@ func TestRefreshModule(t *testing.T) {
 		t.Error(fmt.Sprintf("\n EXPECTED: %s \n RECEIVED: %s", render.Render(shouldReturnAfterRefresh), render.Render(categoryCoolRefresh)))
 	}
 }
+
+func TestRefreshFailingChildCategory(t *testing.T) {
+	childFails := false
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/initial":
+			fmt.Fprintf(w, `<ul><li><a href="%s/informatics">Informatics</a></li></ul>`, server.URL)
+		case "/informatics":
+			fmt.Fprintf(w, `<ul><li><a href="%s/electives">Electives</a></li></ul>`, server.URL)
+		case "/electives":
+			if childFails {
+				w.WriteHeader(http.StatusInternalServerError)
+			}
+		}
+	}))
+	defer server.Close()
+
+	category, err := getAvailableModules(2, server.URL+"/initial", &http.Client{}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	childFails = true
+	refreshed, err := category.Refresh(2)
+	if err == nil {
+		t.Error(fmt.Sprintf("failed child category should abort the refresh, received: %+v", refreshed))
+	}
+	if err != nil && !strings.Contains(err.Error(), "status 500") {
+		t.Error(fmt.Sprintf("WANT: error of the failed child category, GOT: %s", err))
+	}
+}
@@ -0,0 +1,144 @@
+/*
+Package index flattens a crawled category tree, so modules can be looked up without walking the tree.
+
+	category, err := session.GetCategories(3)
+	modules := index.New(category)
+	entries := modules.ByEventId("64-010")
+*/
+package index
+
+import (
+	"github.com/martenmatrix/stine-api/cmd"
+	"math"
+	"strings"
+)
+
+// Entry represents a module of the category tree.
+type Entry struct {
+	Module stineapi.Module
+	Path   []string // Titles of the categories from the root to the category listing the module, the root is not included
+}
+
+// Index contains every module of a category tree.
+type Index struct {
+	entries  []Entry
+	byEvent  map[string][]int // positions of the entries by event id
+	byNumber map[string][]int // positions of the entries by lowercase module number
+	byId     map[string][]int // positions of the entries by module id
+}
+
+// New creates a new [Index] of every module listed in the category and its child categories.
+func New(root stineapi.Category) *Index {
+	index := &Index{
+		byEvent:  map[string][]int{},
+		byNumber: map[string][]int{},
+		byId:     map[string][]int{},
+	}
+	index.add(root, nil)
+	return index
+}
+
+// add adds the modules of the category and its child categories, path leads to the category
+func (index *Index) add(category stineapi.Category, path []string) {
+	for _, module := range category.Modules {
+		position := len(index.entries)
+		index.entries = append(index.entries, Entry{
+			Module: module,
+			Path:   append([]string(nil), path...),
+		})
+
+		for _, event := range module.Events {
+			index.byEvent[event.Id] = append(index.byEvent[event.Id], position)
+		}
+		if module.Id != "" {
+			index.byId[module.Id] = append(index.byId[module.Id], position)
+		}
+		if module.Number != "" {
+			number := strings.ToLower(module.Number)
+			index.byNumber[number] = append(index.byNumber[number], position)
+		}
+	}
+
+	for _, child := range category.Categories {
+		index.add(child, append(path[:len(path):len(path)], child.Title))
+	}
+}
+
+func (index *Index) at(positions []int) []Entry {
+	var entries []Entry
+	for _, position := range positions {
+		entries = append(entries, index.entries[position])
+	}
+	return entries
+}
+
+// Modules returns every module of the index in the order they are listed on STiNE.
+func (index *Index) Modules() []Entry {
+	return append([]Entry(nil), index.entries...)
+}
+
+/*
+ByEventId returns the modules containing the event with the id e.g. "64-010".
+A module can be listed in multiple categories, so multiple entries may be returned.
+*/
+func (index *Index) ByEventId(id string) []Entry {
+	return index.at(index.byEvent[strings.TrimSpace(id)])
+}
+
+/*
+ByNumber returns the modules with the number e.g. "InfB-SE 2", the case is ignored.
+A module can be listed in multiple categories, so multiple entries may be returned.
+*/
+func (index *Index) ByNumber(number string) []Entry {
+	return index.at(index.byNumber[strings.ToLower(strings.TrimSpace(number))])
+}
+
+/*
+ById returns the modules with the id, see [stineapi.Module].
+A module can be listed in multiple categories, so multiple entries may be returned.
+*/
+func (index *Index) ById(id string) []Entry {
+	return index.at(index.byId[strings.TrimSpace(id)])
+}
+
+// Filter returns every module, for which keep returns true.
+func (index *Index) Filter(keep func(entry Entry) bool) []Entry {
+	var entries []Entry
+	for _, entry := range index.entries {
+		if keep(entry) {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+// containsFold checks, if text contains query, the case is ignored
+func containsFold(text string, query string) bool {
+	return strings.Contains(strings.ToLower(text), strings.ToLower(strings.TrimSpace(query)))
+}
+
+// SearchTitle returns every module, whose title contains the query, the case is ignored.
+func (index *Index) SearchTitle(query string) []Entry {
+	return index.Filter(func(entry Entry) bool {
+		return containsFold(entry.Module.Title, query)
+	})
+}
+
+// SearchTeacher returns every module, whose teachers contain the query, the case is ignored.
+func (index *Index) SearchTeacher(query string) []Entry {
+	return index.Filter(func(entry Entry) bool {
+		return containsFold(entry.Module.Teacher, query)
+	})
+}
+
+// WithFreeSeats returns every module, which contains an event with at least one free seat or an unlimited capacity.
+func (index *Index) WithFreeSeats() []Entry {
+	return index.Filter(func(entry Entry) bool {
+		for _, event := range entry.Module.Events {
+			if math.IsInf(event.MaxCapacity, 1) || event.CurrentCapacity < event.MaxCapacity {
+				return true
+			}
+		}
+		return false
+	})
+}
@@ -0,0 +1,88 @@
+package index
+
+import (
+	"fmt"
+	"github.com/google/go-cmp/cmp"
+	"github.com/martenmatrix/stine-api/cmd"
+	"math"
+	"testing"
+)
+
+var (
+	softwareDevelopment = stineapi.Module{
+		Id:      "388000000000001",
+		Number:  "InfB-SE 2",
+		Title:   "Software Development II (SuSe 23)",
+		Teacher: "Peter Lustig; Franz Karen",
+		Events: []stineapi.Event{
+			{Id: "64-010", Title: "Lecture", MaxCapacity: 550, CurrentCapacity: 550},
+			{Id: "64-012", Title: "Exercises", MaxCapacity: 458, CurrentCapacity: 130},
+		},
+	}
+	distributedSystems = stineapi.Module{
+		Number:  "InfB-VSS",
+		Title:   "Distributed Systems and Systems Security (SuSe 23)",
+		Teacher: "Peter Parker",
+		Events:  []stineapi.Event{{Id: "64-091", Title: "Lecture", MaxCapacity: math.Inf(1), CurrentCapacity: math.Inf(1)}},
+	}
+	root = stineapi.Category{
+		Title: "initial",
+		Categories: []stineapi.Category{
+			{
+				Title: "Informatics",
+				Categories: []stineapi.Category{
+					{Title: "Compulsory Modules", Modules: []stineapi.Module{softwareDevelopment, distributedSystems}},
+				},
+			},
+			{Title: "Electives", Modules: []stineapi.Module{distributedSystems}},
+		},
+	}
+)
+
+func TestIndex(t *testing.T) {
+	index := New(root)
+
+	want := []Entry{
+		{Module: softwareDevelopment, Path: []string{"Informatics", "Compulsory Modules"}},
+		{Module: distributedSystems, Path: []string{"Informatics", "Compulsory Modules"}},
+		{Module: distributedSystems, Path: []string{"Electives"}},
+	}
+	if diff := cmp.Diff(want, index.Modules()); diff != "" {
+		t.Error(fmt.Sprintf("modules were not indexed correctly: %s", diff))
+	}
+
+	if diff := cmp.Diff(want[:1], index.ByEventId("64-012")); diff != "" {
+		t.Error(fmt.Sprintf("lookup by event id failed: %s", diff))
+	}
+	if diff := cmp.Diff(want[1:], index.ByNumber("infb-vss")); diff != "" {
+		t.Error(fmt.Sprintf("lookup by module number failed: %s", diff))
+	}
+	if diff := cmp.Diff(want[:1], index.ById("388000000000001")); diff != "" {
+		t.Error(fmt.Sprintf("lookup by module id failed: %s", diff))
+	}
+	if entries := index.ByEventId("64-999"); len(entries) != 0 {
+		t.Error(fmt.Sprintf("unknown event should not be found, found: %+v", entries))
+	}
+}
+
+func TestSearch(t *testing.T) {
+	index := New(root)
+
+	tests := []struct {
+		name    string
+		entries []Entry
+		want    int
+	}{
+		{"title", index.SearchTitle("software development"), 1},
+		{"title of module in two categories", index.SearchTitle("SYSTEMS SECURITY"), 2},
+		{"teacher", index.SearchTeacher("lustig"), 1},
+		{"unknown teacher", index.SearchTeacher("Voldemort"), 0},
+		{"free seats and unlimited capacity in two categories", index.WithFreeSeats(), 3},
+	}
+
+	for _, test := range tests {
+		if len(test.entries) != test.want {
+			t.Error(fmt.Sprintf("%s: WANT: %d entries, GOT: %d", test.name, test.want, len(test.entries)))
+		}
+	}
+}
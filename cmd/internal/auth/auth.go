@@ -3,31 +3,55 @@ package auth
 import (
 	"errors"
 	"github.com/PuerkitoBio/goquery"
-	"github.com/martenmatrix/stine-api/cmd/internal/stineURL"
+	"github.com/martenmatrix/stine-api/cmd/internal/campusnet"
 	"net/http"
 	"net/url"
 	"strings"
 )
 
-const (
-	StartPage          = stineURL.Url + "/scripts/mgrqispi.dll?APPNAME=CampusNet&PRGNAME=EXTERNALPAGES&ARGUMENTS=-N000000000000001,-N000265,-Astartseite"
-	AuthenticationForm = "https://cndsf.ad.uni-hamburg.de/IdentityServer/Account/Login"
-)
+const AuthenticationForm = "https://cndsf.ad.uni-hamburg.de/IdentityServer/Account/Login"
 
-func getLoginHrefValue(resp *http.Response) (string, error) {
-	doc, err := goquery.NewDocumentFromReader(resp.Body)
-	if err != nil {
-		return "", err
-	}
+// StartPageMenuId is the default menu id of the start page, if it cannot be looked up in the menu
+const StartPageMenuId = "000265"
+
+// StartPage returns the url of the start page, which contains the login button
+func StartPage(menuId string) string {
+	return campusnet.Request{
+		PrgName:   "EXTERNALPAGES",
+		SessionNo: "000000000000001",
+		MenuId:    menuId,
+		Args:      []campusnet.Arg{campusnet.A("startseite")},
+	}.URL()
+}
+
+// ErrNoLoginButton is returned, if the start page does not contain the login button.
+var ErrNoLoginButton = errors.New("unable to find login button on STiNE page")
+
+// ErrNoAuthenticationToken is returned, if the login form does not contain the antiforgery token.
+var ErrNoAuthenticationToken = errors.New("unable to find authentication token")
 
+// ErrNoCnscCookie is returned, if the response to the login does not set the cnsc cookie e.g. because the credentials are wrong.
+var ErrNoCnscCookie = errors.New("auth failed, re-check user credentials")
+
+// FindLinkToAuthForm returns the link of the login button on the start page
+func FindLinkToAuthForm(doc *goquery.Document) (string, error) {
 	authURL, onPage := doc.Find("#logIn_btn").First().Attr("href")
 	if !onPage {
-		return "", errors.New("unable to find login button on STiNE page")
+		return "", ErrNoLoginButton
 	}
 
 	return authURL, nil
 }
 
+func getLoginHrefValue(resp *http.Response) (string, error) {
+	doc, err := goquery.NewDocumentFromReader(resp.Body)
+	if err != nil {
+		return "", err
+	}
+
+	return FindLinkToAuthForm(doc)
+}
+
 func GetLinkToAuthForm(startPageURL string, client *http.Client) (string, error) {
 	resp, err := client.Get(startPageURL)
 	if err != nil {
@@ -42,23 +66,31 @@ func GetLinkToAuthForm(startPageURL string, client *http.Client) (string, error)
 	return authURL, nil
 }
 
-func GetAuthenticationToken(authPageRes *http.Response) (string, error) {
-	doc, err := goquery.NewDocumentFromReader(authPageRes.Body)
-	if err != nil {
-		return "", err
-	}
-
+// FindAuthenticationToken returns the antiforgery token of the login form
+func FindAuthenticationToken(doc *goquery.Document) (string, error) {
 	selection := doc.Find("input[name='__RequestVerificationToken']").First()
 	authToken, onPage := selection.Attr("value")
 
 	if !onPage {
-		return "", errors.New("unable to find authentication token")
+		return "", ErrNoAuthenticationToken
 	}
 
 	return authToken, nil
 }
 
+func GetAuthenticationToken(authPageRes *http.Response) (string, error) {
+	doc, err := goquery.NewDocumentFromReader(authPageRes.Body)
+	if err != nil {
+		return "", err
+	}
+
+	return FindAuthenticationToken(doc)
+}
+
 func GetReturnURL(authPageRes *http.Response) (string, error) {
+	if authPageRes.Request == nil || authPageRes.Request.URL == nil {
+		return "", errors.New("unable to find return url, the response has no request")
+	}
 	returnUrl := authPageRes.Request.URL.RawQuery
 	indexOfFirstEquals := strings.IndexByte(returnUrl, '=')
 	returnURLWithoutName := returnUrl[indexOfFirstEquals+1:]
@@ -71,22 +103,27 @@ func GetReturnURL(authPageRes *http.Response) (string, error) {
 
 // GetMalformattedCnscCookie extracts a cookie, which is sent malformed by the STiNE server, which the Go Client would not parse
 func GetMalformattedCnscCookie(respWithCookie *http.Response) (*http.Cookie, error) {
-	setCookieHeader := respWithCookie.Header.Get("Set-Cookie")
-	// no auth cookie response from server => could be wrong password
-	if setCookieHeader == "" {
-		return nil, errors.New("auth failed, re-check user credentials")
+	// the server may set other cookies as well, the name of the cnsc cookie is followed by a space
+	for _, setCookieHeader := range respWithCookie.Header.Values("Set-Cookie") {
+		name, cookieWithoutName, found := strings.Cut(setCookieHeader, "=")
+		if !found || strings.TrimSpace(name) != "cnsc" {
+			continue
+		}
+		cookieValue, _, _ := strings.Cut(cookieWithoutName, ";")
+		cookieValue = strings.TrimSpace(cookieValue)
+		if cookieValue == "" {
+			continue
+		}
+
+		return &http.Cookie{
+			Name:     "cnsc",
+			Value:    cookieValue,
+			Domain:   "stine.uni-hamburg.de",
+			Path:     "/scripts",
+			HttpOnly: true,
+		}, nil
 	}
 
-	keyValue := strings.Split(setCookieHeader, "=")
-	cookieWithoutName := keyValue[1]
-	cookieValueAndAttributes := strings.Split(cookieWithoutName, ";")
-	cookieValue := cookieValueAndAttributes[0]
-
-	return &http.Cookie{
-		Name:     "cnsc",
-		Value:    cookieValue,
-		Domain:   "stine.uni-hamburg.de",
-		Path:     "/scripts",
-		HttpOnly: true,
-	}, nil
+	// no auth cookie response from server => could be wrong password
+	return nil, ErrNoCnscCookie
 }
@@ -123,3 +123,26 @@ func TestGetMalformattedCNSCCookie(t *testing.T) {
 		t.Errorf("Function should return error, as no cnsc cookies was returned")
 	}
 }
+
+func TestGetMalformattedCNSCCookieUnexpectedHeaders(t *testing.T) {
+	headers := [][]string{
+		{"no equals sign"},
+		{"cnsc"},
+		{"cnsc =; HttpOnly"},
+		{"idsrv=abc; path=/"},
+		{"idsrv=abc; path=/", "cnsc =DWFWDF; HttpOnly"},
+	}
+
+	for i, header := range headers {
+		fakeResponse := &http.Response{Header: http.Header{"Set-Cookie": header}}
+		cnscCookie, err := GetMalformattedCnscCookie(fakeResponse)
+
+		// only the last header contains a cnsc cookie
+		if i < len(headers)-1 && err == nil {
+			t.Errorf("WANT: error for %q, GOT: %+v", header, cnscCookie)
+		}
+		if i == len(headers)-1 && (err != nil || cnscCookie.Value != "DWFWDF") {
+			t.Errorf("WANT: DWFWDF for %q, GOT: %+v, %v", header, cnscCookie, err)
+		}
+	}
+}
@@ -0,0 +1,232 @@
+/*
+Package campusnet parses and builds URLs of the CampusNet dispatcher, which serves every page of STiNE.
+
+Dispatcher URLs are from the following format:
+
+	dispatcher + "?APPNAME=" + applicationName + "&PRGNAME=" + programName + "&ARGUMENTS=-N" + sessionNo + ",-N" + menuId + further arguments
+
+Every argument starts with -N, if it is numeric, or with -A, if it is a string.
+*/
+package campusnet
+
+import (
+	"errors"
+	"fmt"
+	"github.com/martenmatrix/stine-api/cmd/internal/stineURL"
+	"net/url"
+	"strings"
+)
+
+const (
+	Dispatcher     = stineURL.Url + "/scripts/mgrqispi.dll"
+	AppName        = "CampusNet"
+	EmptySessionNo = "000000000000000" // session number of a user, who is not authenticated
+)
+
+// ErrNoArguments is returned by Parse, if the URL does not contain any arguments.
+var ErrNoArguments = errors.New("url does not contain campusnet arguments")
+
+// ArgType represents the type of an argument.
+type ArgType byte
+
+const (
+	Numeric ArgType = 'N'
+	String  ArgType = 'A'
+)
+
+// Arg represents a single argument of a dispatcher URL.
+type Arg struct {
+	Type  ArgType
+	Value string
+}
+
+// N creates a numeric argument.
+func N(value string) Arg {
+	return Arg{Type: Numeric, Value: value}
+}
+
+// A creates a string argument.
+func A(value string) Arg {
+	return Arg{Type: String, Value: value}
+}
+
+func (arg Arg) String() string {
+	return "-" + string(arg.Type) + arg.Value
+}
+
+// Request represents a request to the CampusNet dispatcher.
+type Request struct {
+	Base      string // Dispatcher the request is sent to, defaults to the STiNE dispatcher
+	AppName   string // Defaults to CampusNet
+	PrgName   string // Program, which renders the page e.g. REGISTRATION
+	SessionNo string // First argument, defaults to the session number of a user, who is not authenticated
+	MenuId    string // Second argument, identifies the selected menu entry
+	Args      []Arg  // Arguments following the menu id
+}
+
+// parseArg parses a single argument like -N000266 or -Astartseite
+func parseArg(rawArg string) (Arg, error) {
+	if len(rawArg) < 2 || rawArg[0] != '-' {
+		return Arg{}, errors.New(fmt.Sprintf("invalid campusnet argument %q", rawArg))
+	}
+
+	arg := Arg{Type: ArgType(rawArg[1]), Value: rawArg[2:]}
+	if arg.Type != Numeric && arg.Type != String {
+		return Arg{}, errors.New(fmt.Sprintf("unknown type of campusnet argument %q", rawArg))
+	}
+	return arg, nil
+}
+
+// Parse parses an absolute or relative dispatcher URL.
+func Parse(rawURL string) (Request, error) {
+	parsedURL, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil {
+		return Request{}, err
+	}
+
+	query := parsedURL.Query()
+	rawArgs := query.Get("ARGUMENTS")
+	if rawArgs == "" {
+		return Request{}, ErrNoArguments
+	}
+
+	var args []Arg
+	for _, rawArg := range strings.Split(rawArgs, ",") {
+		// urls often end with a comma
+		if rawArg == "" {
+			continue
+		}
+		arg, err := parseArg(rawArg)
+		if err != nil {
+			return Request{}, err
+		}
+		args = append(args, arg)
+	}
+
+	parsedURL.RawQuery = ""
+	parsedURL.Fragment = ""
+	req := Request{
+		Base:    parsedURL.String(),
+		AppName: query.Get("APPNAME"),
+		PrgName: query.Get("PRGNAME"),
+	}
+
+	if len(args) > 0 {
+		req.SessionNo = args[0].Value
+	}
+	if len(args) > 1 {
+		req.MenuId = args[1].Value
+	}
+	if len(args) > 2 {
+		req.Args = args[2:]
+	}
+	return req, nil
+}
+
+/*
+ParseRefresh parses the "Refresh" header STiNE returns after the login, which contains the URL of the start page of the user e.g.
+"0; URL=/scripts/mgrqispi.dll?APPNAME=CampusNet&PRGNAME=MLSSTART&ARGUMENTS=-N899462345432351,-N000266,".
+*/
+func ParseRefresh(header string) (Request, error) {
+	_, refreshURL, found := strings.Cut(header, "URL=")
+	if !found {
+		refreshURL = header
+	}
+	return Parse(refreshURL)
+}
+
+// URL builds the dispatcher URL of the request.
+func (req Request) URL() string {
+	base := req.Base
+	if base == "" {
+		base = Dispatcher
+	}
+	appName := req.AppName
+	if appName == "" {
+		appName = AppName
+	}
+	sessionNo := req.SessionNo
+	if sessionNo == "" {
+		sessionNo = EmptySessionNo
+	}
+
+	args := []string{N(sessionNo).String()}
+	if req.MenuId != "" || len(req.Args) > 0 {
+		args = append(args, N(req.MenuId).String())
+	}
+	for _, arg := range req.Args {
+		args = append(args, "-"+string(arg.Type)+url.QueryEscape(arg.Value))
+	}
+
+	return base + "?APPNAME=" + url.QueryEscape(appName) + "&PRGNAME=" + url.QueryEscape(req.PrgName) + "&ARGUMENTS=" + strings.Join(args, ",")
+}
+
+/*
+RefreshSessionNo replaces the session number in a STiNE url with the passed session number.
+The session number in the URL needs to correspond with a specific cookie to authenticate on STiNE.
+
+Only the value of the first argument is replaced, the rest of the URL is returned unchanged.
+URLs, which are not dispatcher URLs, are returned unchanged.
+*/
+func RefreshSessionNo(rawURL string, sessionNo string) string {
+	_, err := Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+
+	// the session number is the first argument, the arguments are a parameter of the query, so they follow ? or &
+	valueStart := -1
+	for i := strings.Index(rawURL, "?"); i >= 0 && i < len(rawURL) && rawURL[i] != '#'; i++ {
+		if (rawURL[i] == '?' || rawURL[i] == '&') && strings.HasPrefix(rawURL[i+1:], "ARGUMENTS=-N") {
+			valueStart = i + 1 + len("ARGUMENTS=-N")
+			break
+		}
+	}
+	if valueStart < 0 {
+		return rawURL
+	}
+
+	valueEnd := valueStart
+	for valueEnd < len(rawURL) && !strings.ContainsRune(",&#", rune(rawURL[valueEnd])) {
+		valueEnd++
+	}
+	return rawURL[:valueStart] + sessionNo + rawURL[valueEnd:]
+}
+
+/*
+idArgs lists for every program, which renders a category, module or course, the position of its id among the arguments following the menu id.
+The other arguments e.g. the semester or options of the page may be constant, so the id is only read from its position.
+*/
+var idArgs = map[string]int{
+	"REGISTRATION":  0, // -N<session>,-N<menu>,-N<category>,-N0,-N0,-N0
+	"MODULEDETAILS": 0, // -N<session>,-N<menu>,-N<module>,...
+	"REGCOURSEMOD":  0, // -N<session>,-N<menu>,-N<module>,-ADOFF,-N<semester>,...
+	"COURSEDETAILS": 1, // -N<session>,-N<menu>,-N0,-N<course>,-N<appointment>,...
+}
+
+/*
+Id returns the id of the category, module or course the request leads to, which does not change between sessions.
+It is read from the position of the argument listed for the program of the request. An empty string is returned,
+if the program does not lead to a category, module or course or the argument is missing.
+*/
+func (req Request) Id() string {
+	position, exists := idArgs[strings.ToUpper(req.PrgName)]
+	if !exists || position >= len(req.Args) {
+		return ""
+	}
+
+	arg := req.Args[position]
+	if arg.Type != Numeric || strings.Trim(arg.Value, "0") == "" {
+		return ""
+	}
+	return arg.Value
+}
+
+// ParseId returns the Id of the request of a dispatcher URL, an empty string is returned, if the URL cannot be parsed.
+func ParseId(rawURL string) string {
+	req, err := Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	return req.Id()
+}
@@ -0,0 +1,121 @@
+package campusnet
+
+import (
+	"github.com/google/go-cmp/cmp"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	req, err := Parse("https://stine.uni-hamburg.de/scripts/mgrqispi.dll?APPNAME=CampusNet&PRGNAME=REGCOURSEMOD&ARGUMENTS=-N232343443351119,-N343449,-N343424234011169,-ADOFF,-N0,")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := Request{
+		Base:      "https://stine.uni-hamburg.de/scripts/mgrqispi.dll",
+		AppName:   "CampusNet",
+		PrgName:   "REGCOURSEMOD",
+		SessionNo: "232343443351119",
+		MenuId:    "343449",
+		Args:      []Arg{N("343424234011169"), A("DOFF"), N("0")},
+	}
+	if !cmp.Equal(req, want) {
+		t.Error(cmp.Diff(want, req))
+	}
+
+	_, err = Parse("https://stine.uni-hamburg.de/scripts/mgrqispi.dll?APPNAME=CampusNet&PRGNAME=REGISTRATION&ARGUMENTS=-X0")
+	if err == nil {
+		t.Error("argument of an unknown type should be rejected")
+	}
+
+	_, err = Parse("http://127.0.0.1:4000")
+	if err != ErrNoArguments {
+		t.Errorf("WANT: %s, GOT: %s", ErrNoArguments, err)
+	}
+}
+
+func TestParseRefresh(t *testing.T) {
+	tests := []string{
+		"0; URL=/scripts/mgrqispi.dll?APPNAME=CampusNet&PRGNAME=MLSSTART&ARGUMENTS=-N899462345432351,-N000266,",
+		"https://stine.uni-hamburg.de/scripts/mgrqispi.dll?APPNAME=CampusNet&PRGNAME=MLSSTART&ARGUMENTS=-N899462345432351,-N000266,",
+	}
+
+	for _, header := range tests {
+		req, err := ParseRefresh(header)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if req.SessionNo != "899462345432351" {
+			t.Errorf("WANT: 899462345432351, GOT: %s", req.SessionNo)
+		}
+	}
+}
+
+func TestURL(t *testing.T) {
+	tests := []struct {
+		req  Request
+		want string
+	}{
+		{
+			Request{PrgName: "REGISTRATION", SessionNo: "232343443351119"},
+			Dispatcher + "?APPNAME=CampusNet&PRGNAME=REGISTRATION&ARGUMENTS=-N232343443351119",
+		},
+		{
+			Request{PrgName: "EXTERNALPAGES", SessionNo: "000000000000001", MenuId: "000265", Args: []Arg{A("startseite")}},
+			Dispatcher + "?APPNAME=CampusNet&PRGNAME=EXTERNALPAGES&ARGUMENTS=-N000000000000001,-N000265,-Astartseite",
+		},
+		{
+			Request{PrgName: "CHANGELANGUAGE", MenuId: "002"},
+			Dispatcher + "?APPNAME=CampusNet&PRGNAME=CHANGELANGUAGE&ARGUMENTS=-N000000000000000,-N002",
+		},
+	}
+
+	for _, test := range tests {
+		if got := test.req.URL(); got != test.want {
+			t.Errorf("WANT: %s, GOT: %s", test.want, got)
+		}
+	}
+}
+
+func TestRefreshSessionNumber(t *testing.T) {
+	fakeRegistrationLink := "https://stine.uni-hamburg.de/scripts/mgrqispi.dll?APPNAME=CampusNet&PRGNAME=REGCOURSEMOD&ARGUMENTS=-N232343443351119,-N343449,-N343424234011169,-ADOFF,-N343434342285453,-N344343434341730,-N0,-N0,-N0,-AN,-N0"
+	newSessionNo := "232343443351118"
+
+	urlWithRefreshedSessionNo := RefreshSessionNo(fakeRegistrationLink, newSessionNo)
+
+	if urlWithRefreshedSessionNo != "https://stine.uni-hamburg.de/scripts/mgrqispi.dll?APPNAME=CampusNet&PRGNAME=REGCOURSEMOD&ARGUMENTS=-N"+newSessionNo+",-N343449,-N343424234011169,-ADOFF,-N343434342285453,-N344343434341730,-N0,-N0,-N0,-AN,-N0" {
+		t.Error("session number is not being replaced in link")
+	}
+
+	// everything except the session number is kept as it is
+	link := "/scripts/mgrqispi.dll?APPNAME=CampusNet&PRGNAME=ACTION&ARGUMENTS=-N232343443351119,-N000309,-Amit%20Leerzeichen,,&tab=2#top"
+	want := "/scripts/mgrqispi.dll?APPNAME=CampusNet&PRGNAME=ACTION&ARGUMENTS=-N" + newSessionNo + ",-N000309,-Amit%20Leerzeichen,,&tab=2#top"
+	if got := RefreshSessionNo(link, newSessionNo); got != want {
+		t.Errorf("WANT: %s, GOT: %s", want, got)
+	}
+
+	if RefreshSessionNo("http://127.0.0.1:4000/register", newSessionNo) != "http://127.0.0.1:4000/register" {
+		t.Error("urls without arguments should not be changed")
+	}
+}
+
+func TestId(t *testing.T) {
+	tests := map[string]string{
+		"https://stine.uni-hamburg.de/scripts/mgrqispi.dll?APPNAME=CampusNet&PRGNAME=REGCOURSEMOD&ARGUMENTS=-N232343443351119,-N343449,-N343424234011169,-ADOFF,-N0,": "343424234011169",
+		"/scripts/mgrqispi.dll?APPNAME=CampusNet&PRGNAME=COURSEDETAILS&ARGUMENTS=-N232343443351119,-N000309,-N0,-N380123456789012,-N380123456789013":                  "380123456789012",
+		"/scripts/mgrqispi.dll?APPNAME=CampusNet&PRGNAME=REGISTRATION&ARGUMENTS=-N232343443351119,-N000309,":                                                          "",
+		"/scripts/mgrqispi.dll?APPNAME=CampusNet&PRGNAME=REGISTRATION&ARGUMENTS=-N232343443351119,-N000309,-N376333755785484,-N0,-N0,-N3":                             "376333755785484",
+		"/scripts/mgrqispi.dll?APPNAME=CampusNet&PRGNAME=MODULEDETAILS&ARGUMENTS=-N232343443351119,-N000309,-N388000000000001,-N0,-N0":                                "388000000000001",
+		// a constant argument before the course is not the id
+		"/scripts/mgrqispi.dll?APPNAME=CampusNet&PRGNAME=COURSEDETAILS&ARGUMENTS=-N232343443351119,-N000309,-N999,-N380123456789012": "380123456789012",
+		// programs, which do not lead to a category, module or course, have no id
+		"/scripts/mgrqispi.dll?APPNAME=CampusNet&PRGNAME=EXTERNALPAGES&ARGUMENTS=-N232343443351119,-N000265,-N388000000000001": "",
+		"http://127.0.0.1:4000": "",
+	}
+
+	for rawURL, want := range tests {
+		if got := ParseId(rawURL); got != want {
+			t.Errorf("WANT: %s, GOT: %s", want, got)
+		}
+	}
+}
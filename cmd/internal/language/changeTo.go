@@ -1,38 +1,49 @@
 package language
 
 import (
-	"github.com/martenmatrix/stine-api/cmd/internal/sessionNo"
-	"github.com/martenmatrix/stine-api/cmd/internal/stineURL"
+	"errors"
+	"fmt"
+	"github.com/PuerkitoBio/goquery"
+	"github.com/martenmatrix/stine-api/cmd/internal/campusnet"
 	"net/http"
 )
 
+// the second argument of the language links selects the language instead of a menu entry
 const (
-	englishLink = stineURL.Url + "/scripts/mgrqispi.dll?APPNAME=CampusNet&PRGNAME=CHANGELANGUAGE&ARGUMENTS=-N000000000000000,-N002"
-	germanLink  = stineURL.Url + "/scripts/mgrqispi.dll?APPNAME=CampusNet&PRGNAME=CHANGELANGUAGE&ARGUMENTS=-N000000000000000,-N001"
+	GermanId  = "001"
+	EnglishId = "002"
 )
 
-/*
-ChangeToEnglish changes the language to english on the STiNE website.
-*/
-func ChangeToEnglish(client *http.Client, sessionNumber string) error {
-	_, err := client.Get(sessionNo.Refresh(englishLink, sessionNumber))
+var (
+	englishLink = campusnet.Request{PrgName: "CHANGELANGUAGE", MenuId: EnglishId}.URL()
+	germanLink  = campusnet.Request{PrgName: "CHANGELANGUAGE", MenuId: GermanId}.URL()
+)
 
+// changeTo requests the language link and returns the page STiNE responds with
+func changeTo(client *http.Client, link string, sessionNumber string) (*goquery.Document, error) {
+	res, err := client.Get(campusnet.RefreshSessionNo(link, sessionNumber))
 	if err != nil {
-		return err
+		return nil, err
 	}
+	defer res.Body.Close()
 
-	return nil
+	if res.StatusCode != http.StatusOK {
+		return nil, errors.New(fmt.Sprintf("unable to change the language, stine responded with status %d", res.StatusCode))
+	}
+
+	return goquery.NewDocumentFromReader(res.Body)
 }
 
 /*
-ChangeToGerman changes the language to german on the STiNE website.
+ChangeToEnglish changes the language to english on the STiNE website and returns the page STiNE responded with.
 */
-func ChangeToGerman(client *http.Client, sessionNumber string) error {
-	_, err := client.Get(sessionNo.Refresh(germanLink, sessionNumber))
-
-	if err != nil {
-		return err
-	}
+func ChangeToEnglish(client *http.Client, sessionNumber string) (*goquery.Document, error) {
+	return changeTo(client, englishLink, sessionNumber)
+}
 
-	return nil
+/*
+ChangeToGerman changes the language to german on the STiNE website and returns the page STiNE responded with.
+*/
+func ChangeToGerman(client *http.Client, sessionNumber string) (*goquery.Document, error) {
+	return changeTo(client, germanLink, sessionNumber)
 }
@@ -7,19 +7,23 @@ import (
 	"net/http/httputil"
 )
 
+// LogResponse prints the response to stdout, the body of the response can still be read afterwards
 func LogResponse(response *http.Response) {
 	resDump, err := httputil.DumpResponse(response, true)
 	if err != nil {
-		log.Fatal(err)
+		log.Println("Unable to dump response:", err)
+		return
 	}
 
 	fmt.Printf("RESPONSE:\n%s\n", string(resDump))
 }
 
+// LogRequest prints the request to stdout, the body of the request can still be read afterwards
 func LogRequest(request *http.Request) {
 	reqDump, err := httputil.DumpRequest(request, true)
 	if err != nil {
-		log.Fatal(err)
+		log.Println("Unable to dump request:", err)
+		return
 	}
 
 	fmt.Printf("REQUEST:\n%s\n", string(reqDump))
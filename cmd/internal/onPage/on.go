@@ -5,9 +5,9 @@ import (
 	"log"
 )
 
-// OniTANPage checks, if the HTML of the response asks for an iTAN
+// OniTANPage checks, if the HTML of the response asks for an iTAN or another kind of TAN
 func OniTANPage(doc *goquery.Document) bool {
-	return doc.Find(".itan").Length() > 0
+	return doc.Find(`.itan, .mtan, .totp, input[name="tan_code"]`).Length() > 0
 }
 
 // OnSelectExamPage checks, if the HTML of the response asks the user to select an exam
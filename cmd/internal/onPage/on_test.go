@@ -48,4 +48,14 @@ func TestOniTANPage(t *testing.T) {
 	if res2 != true {
 		t.Error("Expected: true, Received: false")
 	}
+
+	fakeRes3, err3 := goquery.NewDocumentFromReader(io.NopCloser(bytes.NewBufferString(`<html><body><span class="totp">Enter the code of your app</span><input name="tan_code"></body></html>`)))
+	if err3 != nil {
+		t.Errorf(err3.Error())
+	}
+	res3 := OniTANPage(fakeRes3)
+
+	if res3 != true {
+		t.Error("Expected: true, Received: false")
+	}
 }
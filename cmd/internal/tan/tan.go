@@ -1,24 +1,68 @@
 package tan
 
 import (
-	"errors"
 	"fmt"
 	"github.com/PuerkitoBio/goquery"
 	"net/http"
 	"net/url"
+	"regexp"
+	"strconv"
 	"strings"
 )
 
-// CheckForTANError checks if there was an error after entering the iTAN by reading the HTML of the response
+// Error is returned, if STiNE rejected an iTAN
+type Error struct {
+	Message           string // error message displayed by STiNE
+	RemainingAttempts int    // attempts left before the iTAN list locks, -1 if STiNE did not display them
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("itan validation could not be completed: %s", e.Message)
+}
+
+// only numbers stated as remaining are matched, e.g. not "nach 3 Versuchen" or "after 3 attempts"
+var remainingAttemptsRegexes = []*regexp.Regexp{
+	// e.g. "noch 2 Versuche" or "noch 1 weiteren Versuch"
+	regexp.MustCompile(`(?i)noch\s+(\d+)\s+(?:weitere[n]?\s+)?versuch`),
+	// e.g. "2 verbleibende Versuche"
+	regexp.MustCompile(`(?i)(\d+)\s+verbleibende[n]?\s+versuch`),
+	// e.g. "Verbleibende Versuche: 2" or "Remaining attempts: 2"
+	regexp.MustCompile(`(?i)(?:verbleibende\s+versuche|remaining\s+attempts)\s*:\s*(\d+)`),
+	// e.g. "2 remaining attempts"
+	regexp.MustCompile(`(?i)(\d+)\s+remaining\s+(?:attempt|tries|try)`),
+	// e.g. "2 attempts remaining" or "1 more try left"
+	regexp.MustCompile(`(?i)(\d+)\s+(?:further\s+|more\s+)?(?:attempts?|tries|try)\s+(?:remaining|left)`),
+}
+
+// parseRemainingAttempts extracts the number of remaining attempts from the error message, -1 if they are not listed
+func parseRemainingAttempts(errorMsg string) int {
+	for _, regex := range remainingAttemptsRegexes {
+		match := regex.FindStringSubmatch(errorMsg)
+		if match == nil {
+			continue
+		}
+		remaining, err := strconv.Atoi(match[1])
+		if err != nil {
+			return -1
+		}
+		return remaining
+	}
+	return -1
+}
+
+// CheckForTANError checks if there was an error after entering the iTAN by reading the HTML of the response, the error is an *Error
 func CheckForTANError(res *http.Response) error {
 	doc, err := goquery.NewDocumentFromReader(res.Body)
 	if err != nil {
 		return err
 	}
 
-	errorMsg := doc.Find(".error").First().Text()
+	errorMsg := strings.TrimSpace(doc.Find(".error").First().Text())
 	if errorMsg != "" {
-		return errors.New(fmt.Sprintf("itan validation could not be completed: %s", errorMsg))
+		return &Error{
+			Message:           errorMsg,
+			RemainingAttempts: parseRemainingAttempts(errorMsg),
+		}
 	}
 	return nil
 }
@@ -30,23 +74,22 @@ func RemoveTanPrefix(itan string, prefix string) string {
 }
 
 // SendTAN does the request, which sends the iTAN to the STiNE servers, it returns an error, if the authentication was not successful
-func SendTAN(client *http.Client, reqURL string, itanWithoutPrefix string, sessionNumber string, registrationId string) error {
+func SendTAN(client *http.Client, reqURL string, program string, itanWithoutPrefix string, sessionNumber string, registrationId string) error {
 	formQuery := url.Values{
 		"campusnet_submit": {""},
 		"tan_code":         {itanWithoutPrefix},
 		"APPNAME":          {"CampusNet"},
-		"PRGNAME":          {"SAVEREGISTRATION"},
+		"PRGNAME":          {program},
 		"ARGUMENTS":        {"sessionno,menuid,rgtr_id,mode,timetable_id,location_id"},
 		"sessionno":        {sessionNumber},
 		"rgtr_id":          {registrationId},
 		"mode":             {"   0"},
 	}
 	res, err := client.PostForm(reqURL, formQuery)
-	defer res.Body.Close()
-
 	if err != nil {
 		return err
 	}
+	defer res.Body.Close()
 
 	tanErr := CheckForTANError(res)
 	if tanErr != nil {
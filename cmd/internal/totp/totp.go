@@ -0,0 +1,48 @@
+package totp
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	Period = 30 * time.Second // validity of a code, as defined in RFC 6238
+	Digits = 6                // length of a code
+)
+
+// DecodeSecret decodes a base32 encoded secret like it is displayed by authenticator apps, whitespace and padding are optional
+func DecodeSecret(secret string) ([]byte, error) {
+	cleaned := strings.ToUpper(strings.ReplaceAll(secret, " ", ""))
+	cleaned = strings.TrimRight(cleaned, "=")
+	return base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(cleaned)
+}
+
+// Step returns the number of the time step t belongs to
+func Step(t time.Time) uint64 {
+	return uint64(t.Unix()) / uint64(Period/time.Second)
+}
+
+// Generate computes the code for the time step with HMAC-SHA1 like described in RFC 4226 and RFC 6238
+func Generate(secret []byte, step uint64) string {
+	var counter [8]byte
+	binary.BigEndian.PutUint64(counter[:], step)
+
+	mac := hmac.New(sha1.New, secret)
+	mac.Write(counter[:])
+	sum := mac.Sum(nil)
+
+	// dynamic truncation
+	offset := sum[len(sum)-1] & 0x0f
+	code := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	modulo := uint32(1)
+	for i := 0; i < Digits; i++ {
+		modulo *= 10
+	}
+	return fmt.Sprintf("%0*d", Digits, code%modulo)
+}
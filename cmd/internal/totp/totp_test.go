@@ -0,0 +1,36 @@
+package totp
+
+import (
+	"testing"
+	"time"
+)
+
+func TestGenerate(t *testing.T) {
+	// test vectors of RFC 6238 for SHA1, truncated to 6 digits
+	secret := []byte("12345678901234567890")
+	vectors := map[int64]string{
+		59:          "287082",
+		1111111109:  "081804",
+		1111111111:  "050471",
+		1234567890:  "005924",
+		2000000000:  "279037",
+		20000000000: "353130",
+	}
+
+	for unix, want := range vectors {
+		got := Generate(secret, Step(time.Unix(unix, 0)))
+		if got != want {
+			t.Errorf("WANT: %s, GOT: %s (time %d)", want, got, unix)
+		}
+	}
+}
+
+func TestDecodeSecret(t *testing.T) {
+	secret, err := DecodeSecret("gezd gnbv gy3t qojq gezd gnbv gy3t qojq")
+	if err != nil {
+		t.Errorf(err.Error())
+	}
+	if string(secret) != "12345678901234567890" {
+		t.Errorf("WANT: 12345678901234567890, GOT: %s", secret)
+	}
+}
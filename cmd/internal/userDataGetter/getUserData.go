@@ -1,7 +1,10 @@
 package userDataGetter
 
 import (
-	"fmt"
+	"github.com/PuerkitoBio/goquery"
+	"github.com/martenmatrix/stine-api/cmd/internal/campusnet"
+	"net/http"
+	"strings"
 )
 
 type general struct {
@@ -34,10 +37,77 @@ type UserData struct {
 	Statistics statistics
 }
 
-func getUserAccountURL(sessionNo string) string {
-	return fmt.Sprintf("https://stine.uni-hamburg.de/scripts/mgrqispi.dll?APPNAME=CampusNet&PRGNAME=PERSADDRESS&ARGUMENTS=-N%s,-N000273,", sessionNo)
+// UserAccountMenuId is the default menu id of the "Benutzerkonto" tab, if it cannot be looked up in the menu
+const UserAccountMenuId = "000273"
+
+func getUserAccountURL(sessionNo string, menuId string) string {
+	return campusnet.Request{PrgName: "PERSADDRESS", SessionNo: sessionNo, MenuId: menuId}.URL()
+}
+
+// fieldValues maps the label of every row of the tables on the page to the text of its value
+func fieldValues(doc *goquery.Document) map[string]*goquery.Selection {
+	values := map[string]*goquery.Selection{}
+	doc.Find(".persaddrTbl tr.tbdata").Each(func(i int, row *goquery.Selection) {
+		cells := row.Find("td")
+		label := strings.TrimSpace(cells.Eq(0).Text())
+		if _, exists := values[label]; !exists {
+			values[label] = cells.Eq(1)
+		}
+	})
+	return values
+}
+
+// parseUserData reads the user data from the "Benutzerkonto" tab
+func parseUserData(doc *goquery.Document) UserData {
+	values := fieldValues(doc)
+	text := func(label string) string {
+		value, exists := values[label]
+		if !exists {
+			return ""
+		}
+		return strings.TrimSpace(value.Text())
+	}
+
+	var forward bool
+	if value, exists := values["Messages an Uni-Mail-Adresse weiterleiten?"]; exists {
+		_, forward = value.Find(`input[type="checkbox"]`).Attr("checked")
+	}
+
+	return UserData{
+		General: general{
+			MatriculationNumber: text("Matrikelnummer"),
+			Name:                strings.TrimSpace(text("Vorname") + " " + text("Nachname")),
+			ForwardToUniEmail:   forward,
+			SecondCitizenship:   text("Zweite Staatsangehörigkeit"),
+			Phone:               text("Telefon"),
+			Mobile:              text("Handy"),
+			Mail:                text("Email"),
+			UniMail:             text("Unimail"),
+		},
+		Address: address{
+			Street:          text("Straße"),
+			AddressAddition: text("Adresszusatz"),
+			Country:         text("Land"),
+			PostalCode:      text("PLZ"),
+			City:            text("Stadt"),
+		},
+		Statistics: statistics{
+			GermanState: text("Bundesland"),
+		},
+	}
 }
 
-func GetUserData() (UserData, error) {
-	return UserData{}, nil
+// GetUserData loads the "Benutzerkonto" tab with the passed menu id and reads the user data from it
+func GetUserData(client *http.Client, sessionNo string, menuId string) (UserData, error) {
+	res, err := client.Get(getUserAccountURL(sessionNo, menuId))
+	if err != nil {
+		return UserData{}, err
+	}
+	defer res.Body.Close()
+
+	doc, err := goquery.NewDocumentFromReader(res.Body)
+	if err != nil {
+		return UserData{}, err
+	}
+	return parseUserData(doc), nil
 }
@@ -1,5 +1,13 @@
 package userDataGetter
 
+import (
+	"fmt"
+	"github.com/PuerkitoBio/goquery"
+	"github.com/google/go-cmp/cmp"
+	"strings"
+	"testing"
+)
+
 const stineHTMLPageBenutzerkonto = `<div id="contentSpacer_IE" class="pageElementTop">
    <h1>Persönliche Daten</h1>
    <h2 personid="9999999">Peter Lustig</h2>
@@ -196,3 +204,45 @@ const (
 	city                = "Hamburg"
 	germanState         = "Hamburg"
 )
+
+func TestParseUserData(t *testing.T) {
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(stineHTMLPageBenutzerkonto))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := UserData{
+		General: general{
+			MatriculationNumber: matriculationNumber,
+			Name:                name + " " + surname,
+			ForwardToUniEmail:   emailSend,
+			SecondCitizenship:   citiznship2,
+			Phone:               telephone,
+			Mobile:              mobile,
+			Mail:                mail,
+			UniMail:             unimal,
+		},
+		Address: address{
+			Street:          street,
+			AddressAddition: addition,
+			Country:         country,
+			PostalCode:      plz,
+			City:            city,
+		},
+		Statistics: statistics{
+			GermanState: germanState,
+		},
+	}
+
+	got := parseUserData(doc)
+	if !cmp.Equal(got, want, cmp.AllowUnexported(UserData{})) {
+		t.Error(cmp.Diff(want, got, cmp.AllowUnexported(UserData{})))
+	}
+}
+
+func TestUserAccountURL(t *testing.T) {
+	got := getUserAccountURL("1234", "000500")
+	if !strings.Contains(got, "PRGNAME=PERSADDRESS") || !strings.Contains(got, "-N1234,-N000500") {
+		t.Error(fmt.Sprintf("unexpected url: %s", got))
+	}
+}
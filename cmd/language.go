@@ -0,0 +1,220 @@
+package stineapi
+
+import (
+	"bytes"
+	"errors"
+	"github.com/PuerkitoBio/goquery"
+	"github.com/martenmatrix/stine-api/cmd/internal/campusnet"
+	"github.com/martenmatrix/stine-api/cmd/internal/language"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// Language represents a language of the STiNE website.
+type Language string
+
+const (
+	German  Language = "de"
+	English Language = "en"
+)
+
+// ErrUnknownLanguage is returned, if the language of a STiNE page could not be detected.
+var ErrUnknownLanguage = errors.New("unable to detect the language of the stine page")
+
+// ErrUnsupportedLanguage is returned, if a language other than German or English is selected.
+var ErrUnsupportedLanguage = errors.New("stine only supports German and English")
+
+// ErrLanguageNotChanged is returned by ChangeLanguage, if STiNE still displays the previous language after the change.
+var ErrLanguageNotChanged = errors.New("stine did not change the language")
+
+// parseLanguage detects the language of a stine page
+func parseLanguage(doc *goquery.Document) (Language, error) {
+	lang, exists := doc.Find("html").First().Attr("lang")
+	lang = strings.ToLower(strings.TrimSpace(lang))
+	if exists && (strings.HasPrefix(lang, "de") || strings.HasPrefix(lang, "en")) {
+		return Language(lang[:2]), nil
+	}
+
+	// the page links to the language, which is not active
+	href, exists := doc.Find(`a[href*="PRGNAME=CHANGELANGUAGE"]`).First().Attr("href")
+	if exists {
+		req, err := campusnet.Parse(href)
+		if err == nil {
+			switch req.MenuId {
+			case language.GermanId:
+				return English, nil
+			case language.EnglishId:
+				return German, nil
+			}
+		}
+	}
+
+	return "", ErrUnknownLanguage
+}
+
+/*
+CurrentLanguage detects the language, which is active on the STiNE website for the current authenticated user.
+*/
+func (session *Session) CurrentLanguage() (Language, error) {
+	startPage := campusnet.Request{PrgName: "MLSSTART", SessionNo: session.SessionNo}.URL()
+	doc, err := getDocument(session.Client, startPage)
+	if err != nil {
+		return "", err
+	}
+	return parseLanguage(doc)
+}
+
+/*
+ChangeLanguage changes the language on the STiNE website for the current authenticated user.
+It checks the page STiNE responds with and returns [ErrLanguageNotChanged], if the language was not changed.
+
+If the session is pinned to a language, the session is pinned to the new language instead, see PinLanguage.
+*/
+func (session *Session) ChangeLanguage(newLanguage Language) error {
+	var doc *goquery.Document
+	var err error
+	switch newLanguage {
+	case English:
+		doc, err = language.ChangeToEnglish(session.Client, session.SessionNo)
+	case German:
+		doc, err = language.ChangeToGerman(session.Client, session.SessionNo)
+	default:
+		return ErrUnsupportedLanguage
+	}
+	if err != nil {
+		return err
+	}
+
+	active, err := parseLanguage(doc)
+	if errors.Is(err, ErrUnknownLanguage) {
+		// the response does not show the language, check it on the start page
+		active, err = session.CurrentLanguage()
+	}
+	if err != nil {
+		return err
+	}
+	if active != newLanguage {
+		return ErrLanguageNotChanged
+	}
+
+	if guard, pinned := session.Client.Transport.(*languageGuard); pinned {
+		guard.pin(newLanguage)
+	}
+	return nil
+}
+
+/*
+PinLanguage changes the language and pins the session to it. Afterward, the language is restored automatically,
+if it is changed e.g. in another tab while pages are requested, and after every Login.
+
+The language is pinned on the Transport of the Client of the session, replacing the Client removes the pin.
+An empty language removes the pin.
+*/
+func (session *Session) PinLanguage(lang Language) error {
+	guard, pinned := session.Client.Transport.(*languageGuard)
+	if lang == "" {
+		if pinned {
+			guard.pin("")
+		}
+		return nil
+	}
+
+	if !pinned {
+		guard = &languageGuard{base: session.Client.Transport}
+		session.Client.Transport = guard
+	}
+	guard.pin(lang)
+
+	return session.ChangeLanguage(lang)
+}
+
+// pinnedLanguage returns the language the session is pinned to, empty if it is not pinned
+func (session *Session) pinnedLanguage() Language {
+	if guard, pinned := session.Client.Transport.(*languageGuard); pinned {
+		return guard.pinned()
+	}
+	return ""
+}
+
+// languageGuard is a round tripper, which restores the pinned language, if a page of STiNE is displayed in another language
+type languageGuard struct {
+	base     http.RoundTripper // round tripper the requests are sent with, http.DefaultTransport if nil
+	language Language
+	mu       sync.Mutex
+}
+
+func (guard *languageGuard) pin(lang Language) {
+	guard.mu.Lock()
+	defer guard.mu.Unlock()
+
+	guard.language = lang
+}
+
+func (guard *languageGuard) pinned() Language {
+	guard.mu.Lock()
+	defer guard.mu.Unlock()
+
+	return guard.language
+}
+
+// RoundTrip sends the request, if the response is displayed in another language, the language is changed and the request is sent again.
+func (guard *languageGuard) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := guard.base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	res, err := base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	pinned := guard.pinned()
+	// only GET requests can be sent again without side effects
+	if pinned == "" || req.Method != http.MethodGet {
+		return res, nil
+	}
+	page, err := campusnet.Parse(req.URL.String())
+	if err != nil || page.PrgName == "CHANGELANGUAGE" || page.SessionNo == campusnet.EmptySessionNo {
+		return res, nil
+	}
+
+	body, err := io.ReadAll(res.Body)
+	res.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	res.Body = io.NopCloser(bytes.NewReader(body))
+
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(body))
+	if err != nil {
+		return res, nil
+	}
+	active, err := parseLanguage(doc)
+	if err != nil || active == pinned {
+		return res, nil
+	}
+
+	languageId := language.GermanId
+	if pinned == English {
+		languageId = language.EnglishId
+	}
+	changeURL := campusnet.Request{PrgName: "CHANGELANGUAGE", SessionNo: page.SessionNo, MenuId: languageId}.URL()
+	changeReq, err := http.NewRequestWithContext(req.Context(), http.MethodGet, changeURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	// the headers contain the cookies of the session
+	changeReq.Header = req.Header.Clone()
+
+	changeRes, err := base.RoundTrip(changeReq)
+	if err != nil {
+		return nil, err
+	}
+	io.Copy(io.Discard, changeRes.Body)
+	changeRes.Body.Close()
+
+	return base.RoundTrip(req.Clone(req.Context()))
+}
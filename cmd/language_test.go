@@ -0,0 +1,246 @@
+package stineapi
+
+import (
+	"fmt"
+	"github.com/PuerkitoBio/goquery"
+	"github.com/google/go-cmp/cmp"
+	"github.com/martenmatrix/stine-api/cmd/internal/campusnet"
+	"github.com/martenmatrix/stine-api/cmd/internal/tan"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// the same pages of STiNE in german and english
+var languageFixtures = map[string]struct {
+	examList    string
+	examOptions string
+	tanError    string
+}{
+	"de": {
+		examList: `<html lang="de"><body><table>
+			<tr>
+				<td>InfB-SE 2 Software Development II</td>
+				<td>Klausur</td>
+				<td>Mo, 24. Jul. 2023 10:00 - 12:00</td>
+				<td>10.07.2023</td>
+				<td><a class="register" href="/scripts/registerexam">Anmelden</a></td>
+			</tr>
+			<tr>
+				<td>InfB-VSS Distributed Systems and Systems Security</td>
+				<td>mündliche Prüfung</td>
+				<td>Mo, 2. Okt. 2023 09:30</td>
+				<td>25.09.2023 23:59</td>
+				<td><a class="deregister" href="/scripts/deregisterexam">Abmelden</a></td>
+			</tr>
+		</table></body></html>`,
+		examOptions: `<html lang="de"><body><table>
+			<tr><td><input type="radio" name="RB_1" value=" 1"></td><td>Klausur</td><td>Mo, 24. Jul. 2023</td><td>10:00 - 12:00</td><td>ESA A</td></tr>
+			<tr><td><input type="radio" name="RB_1" value=" 2"></td><td>Hausarbeit</td><td>Mi, 27. Dez. 2023</td><td>14:00 - 16:00</td><td>Audimax</td></tr>
+		</table></body></html>`,
+		tanError: `<div class="error">Die TAN ist ungültig. Sie haben noch 2 Versuche.</div>`,
+	},
+	"en": {
+		examList: `<html lang="en"><body><table>
+			<tr>
+				<td>InfB-SE 2 Software Development II</td>
+				<td>Written exam</td>
+				<td>Mon, 24. Jul. 2023 10:00 - 12:00</td>
+				<td>10.07.2023</td>
+				<td><a class="register" href="/scripts/registerexam">Register</a></td>
+			</tr>
+			<tr>
+				<td>InfB-VSS Distributed Systems and Systems Security</td>
+				<td>Oral exam</td>
+				<td>Mon, 2. Oct. 2023 09:30</td>
+				<td>25.09.2023 23:59</td>
+				<td><a class="deregister" href="/scripts/deregisterexam">Deregister</a></td>
+			</tr>
+		</table></body></html>`,
+		examOptions: `<html lang="en"><body><table>
+			<tr><td><input type="radio" name="RB_1" value=" 1"></td><td>Written exam</td><td>Mon, 24. Jul. 2023</td><td>10:00 - 12:00</td><td>ESA A</td></tr>
+			<tr><td><input type="radio" name="RB_1" value=" 2"></td><td>Term paper</td><td>Wed, 27. Dec. 2023</td><td>14:00 - 16:00</td><td>Audimax</td></tr>
+		</table></body></html>`,
+		tanError: `<div class="error">The TAN is invalid. 2 attempts remaining.</div>`,
+	},
+}
+
+// parseFixtures parses the fixtures of a language, the labels are removed as they are the only values, which depend on the language
+func parseFixtures(t *testing.T, language string) ([]Exam, []ExamOption, error) {
+	fixtures := languageFixtures[language]
+	fakeServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/exams":
+			w.Write([]byte(fixtures.examList))
+		case "/tan":
+			w.Write([]byte(fixtures.tanError))
+		}
+	}))
+	defer fakeServer.Close()
+
+	exams, err := getExams(&http.Client{}, fakeServer.URL+"/exams")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range exams {
+		exams[i].Title = ""
+	}
+
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(fixtures.examOptions))
+	if err != nil {
+		t.Fatal(err)
+	}
+	options := parseExamOptions(doc)
+	for i := range options {
+		options[i].Label = ""
+	}
+
+	res, err := http.Get(fakeServer.URL + "/tan")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	return exams, options, tan.CheckForTANError(res)
+}
+
+func TestParseLanguageIndependent(t *testing.T) {
+	germanExams, germanOptions, germanTanErr := parseFixtures(t, "de")
+	englishExams, englishOptions, englishTanErr := parseFixtures(t, "en")
+
+	if len(germanExams) != 2 || germanExams[0].Kind != WrittenExam || germanExams[1].Kind != OralExam {
+		t.Fatalf("exams were not parsed correctly: %+v", germanExams)
+	}
+	if diff := cmp.Diff(germanExams, englishExams); diff != "" {
+		t.Error(fmt.Sprintf("german and english exams differ: %s", diff))
+	}
+
+	if len(germanOptions) != 2 || germanOptions[1].Kind != TermPaper || germanOptions[1].Start.IsZero() {
+		t.Fatalf("exam options were not parsed correctly: %+v", germanOptions)
+	}
+	if diff := cmp.Diff(germanOptions, englishOptions); diff != "" {
+		t.Error(fmt.Sprintf("german and english exam options differ: %s", diff))
+	}
+
+	germanAttempts, englishAttempts := -1, -1
+	if tanErr, ok := germanTanErr.(*TanError); ok {
+		germanAttempts = tanErr.RemainingAttempts
+	}
+	if tanErr, ok := englishTanErr.(*TanError); ok {
+		englishAttempts = tanErr.RemainingAttempts
+	}
+	if germanAttempts != 2 || englishAttempts != 2 {
+		t.Error(fmt.Sprintf("WANT: 2 remaining attempts, GOT: %d (de), %d (en)", germanAttempts, englishAttempts))
+	}
+}
+
+func TestParseLanguage(t *testing.T) {
+	tests := []struct {
+		page string
+		want Language
+	}{
+		{`<html lang="de"><body></body></html>`, German},
+		{`<html lang="en-US"><body></body></html>`, English},
+		{`<html><body><a href="/scripts/mgrqispi.dll?APPNAME=CampusNet&PRGNAME=CHANGELANGUAGE&ARGUMENTS=-N000000000000000,-N002">English</a></body></html>`, German},
+		{`<html><body><a href="/scripts/mgrqispi.dll?APPNAME=CampusNet&PRGNAME=CHANGELANGUAGE&ARGUMENTS=-N000000000000000,-N001">Deutsch</a></body></html>`, English},
+		{`<html><body></body></html>`, ""},
+	}
+
+	for _, test := range tests {
+		doc, err := goquery.NewDocumentFromReader(strings.NewReader(test.page))
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := parseLanguage(doc)
+		if got != test.want {
+			t.Error(fmt.Sprintf("WANT: %s, GOT: %s", test.want, got))
+		}
+		if test.want == "" && err != ErrUnknownLanguage {
+			t.Error(fmt.Sprintf("WANT: %s, GOT: %s", ErrUnknownLanguage, err))
+		}
+	}
+}
+
+// roundTripFunc is a round tripper, which responds with the function
+type roundTripFunc func(req *http.Request) *http.Response
+
+func (fn roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return fn(req), nil
+}
+
+// fakeLanguageTransport serves pages in the active language, which is changed by the language links
+func fakeLanguageTransport(active *Language, requests *[]string) roundTripFunc {
+	return func(req *http.Request) *http.Response {
+		page, _ := campusnet.Parse(req.URL.String())
+		*requests = append(*requests, page.PrgName)
+		if page.PrgName == "CHANGELANGUAGE" && page.MenuId == "002" {
+			*active = English
+		} else if page.PrgName == "CHANGELANGUAGE" && page.MenuId == "001" {
+			*active = German
+		}
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Body:       io.NopCloser(strings.NewReader(fmt.Sprintf(`<html lang="%s"><body></body></html>`, *active))),
+			Request:    req,
+		}
+	}
+}
+
+func TestChangeLanguage(t *testing.T) {
+	active := German
+	var requests []string
+	session := Session{Client: &http.Client{Transport: fakeLanguageTransport(&active, &requests)}, SessionNo: "123456789012345"}
+
+	err := session.ChangeLanguage(English)
+	if err != nil || active != English {
+		t.Error(fmt.Sprintf("language should be changed to english, GOT: %s, %v", active, err))
+	}
+
+	err = session.ChangeLanguage("fr")
+	if err != ErrUnsupportedLanguage {
+		t.Error(fmt.Sprintf("WANT: %s, GOT: %v", ErrUnsupportedLanguage, err))
+	}
+
+	// stine ignores the language change
+	session.Client.Transport = roundTripFunc(func(req *http.Request) *http.Response {
+		return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader(`<html lang="en"></html>`)), Request: req}
+	})
+	err = session.ChangeLanguage(German)
+	if err != ErrLanguageNotChanged {
+		t.Error(fmt.Sprintf("WANT: %s, GOT: %v", ErrLanguageNotChanged, err))
+	}
+}
+
+func TestPinLanguage(t *testing.T) {
+	active := German
+	var requests []string
+	session := Session{Client: &http.Client{Transport: fakeLanguageTransport(&active, &requests)}, SessionNo: "123456789012345"}
+
+	err := session.PinLanguage(English)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// another tab changes the language
+	active = German
+	requests = nil
+	lang, err := session.CurrentLanguage()
+	if err != nil || lang != English {
+		t.Error(fmt.Sprintf("WANT: %s, GOT: %s, %v", English, lang, err))
+	}
+	if diff := cmp.Diff([]string{"MLSSTART", "CHANGELANGUAGE", "MLSSTART"}, requests); diff != "" {
+		t.Error(fmt.Sprintf("language should be restored before the page is requested again: %s", diff))
+	}
+
+	err = session.PinLanguage("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	active = German
+	lang, _ = session.CurrentLanguage()
+	if lang != German {
+		t.Error("language should not be restored after the pin was removed")
+	}
+}
@@ -0,0 +1,276 @@
+package stineapi
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// LimiterStats counts the requests sent through a [Limiter].
+type LimiterStats struct {
+	Requests  int           // Requests sent to STiNE, including retries
+	Throttled int           // Responses with the status 503 or 429, after which the limiter paused
+	Retries   int           // GET requests sent again after a 503 or 429 response
+	InFlight  int           // Requests currently waiting for a response
+	Waited    time.Duration // Total time requests waited for the limiter
+}
+
+/*
+Limiter limits how fast requests are sent to STiNE with a token bucket and how many requests wait for a response at the same time.
+If STiNE responds with 503 or 429, every request waits for the time listed in the Retry-After header or, if it is missing,
+for an exponentially growing backoff.
+
+A limiter can be set on multiple sessions with SetLimiter, the requests of all of them are limited together.
+The fields should not be changed after the first request was sent. A zero value Limiter neither limits the rate nor the requests
+waiting for a response and does not retry, use NewLimiter for the defaults.
+*/
+type Limiter struct {
+	RequestsPerSecond float64       // Rate the bucket is refilled with, 0 for no limit
+	Burst             int           // Maximum number of requests, which can be sent at once after a pause
+	MaxInFlight       int           // Maximum number of requests waiting for a response at the same time, 0 for no limit, NewLimiter sets 4
+	InitialBackoff    time.Duration // Pause after a 503 or 429 response without Retry-After header, doubles with every further one, NewLimiter sets 1 second
+	MaxBackoff        time.Duration // Maximum pause after a 503 or 429 response, 0 for no maximum, NewLimiter sets 1 minute
+	MaxRetries        int           // Number of times GET requests are sent again after a 503 or 429 response, other requests are never sent again, NewLimiter sets 3
+	tokens            float64
+	refilled          time.Time
+	inFlight          int
+	released          chan struct{} // closed, whenever a request stops waiting for a response, created by the first request waiting for it
+	pausedUntil       time.Time
+	backoffs          int // consecutive 503 or 429 responses
+	stats             LimiterStats
+	mu                sync.Mutex
+}
+
+// NewLimiter creates a new [Limiter], which sends at most requestsPerSecond requests per second with a burst of burst requests.
+func NewLimiter(requestsPerSecond float64, burst int) *Limiter {
+	return &Limiter{
+		RequestsPerSecond: requestsPerSecond,
+		Burst:             burst,
+		MaxInFlight:       4,
+		InitialBackoff:    time.Second,
+		MaxBackoff:        time.Minute,
+		MaxRetries:        3,
+		tokens:            float64(burst),
+		refilled:          time.Now(),
+	}
+}
+
+// Stats returns the counters of the limiter.
+func (limiter *Limiter) Stats() LimiterStats {
+	limiter.mu.Lock()
+	defer limiter.mu.Unlock()
+
+	stats := limiter.stats
+	stats.InFlight = limiter.inFlight
+	return stats
+}
+
+// acquire blocks until a request can be sent, every call needs to be followed by a call of release
+func (limiter *Limiter) acquire(ctx context.Context) error {
+	start := time.Now()
+	defer func() {
+		limiter.mu.Lock()
+		limiter.stats.Waited += time.Since(start)
+		limiter.mu.Unlock()
+	}()
+
+	// wait for a free slot
+	for {
+		limiter.mu.Lock()
+		if limiter.MaxInFlight <= 0 || limiter.inFlight < limiter.MaxInFlight {
+			limiter.inFlight++
+			limiter.mu.Unlock()
+			break
+		}
+		if limiter.released == nil {
+			limiter.released = make(chan struct{})
+		}
+		released := limiter.released
+		limiter.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-released:
+		}
+	}
+
+	// wait, until the pause after a 503 or 429 response is over and a token is available
+	limiter.mu.Lock()
+	wait := time.Until(limiter.pausedUntil)
+	if limiter.RequestsPerSecond > 0 {
+		now := time.Now()
+		limiter.tokens += now.Sub(limiter.refilled).Seconds() * limiter.RequestsPerSecond
+		if limiter.tokens > float64(limiter.Burst) {
+			limiter.tokens = float64(limiter.Burst)
+		}
+		limiter.refilled = now
+
+		// the token is reserved now, so waiting requests are served in order
+		limiter.tokens--
+		if limiter.tokens < 0 {
+			tokenWait := time.Duration(-limiter.tokens / limiter.RequestsPerSecond * float64(time.Second))
+			if tokenWait > wait {
+				wait = tokenWait
+			}
+		}
+	}
+	limiter.stats.Requests++
+	limiter.mu.Unlock()
+
+	if wait > 0 {
+		err := sleep(ctx, wait)
+		if err != nil {
+			limiter.release()
+			return err
+		}
+	}
+	return nil
+}
+
+// release frees the slot of a request, which received a response
+func (limiter *Limiter) release() {
+	limiter.mu.Lock()
+	defer limiter.mu.Unlock()
+
+	limiter.inFlight--
+	// only requests waiting for a free slot need to be woken up
+	if limiter.released != nil {
+		close(limiter.released)
+		limiter.released = nil
+	}
+}
+
+// throttled pauses every request after a 503 or 429 response, retryAfter is 0, if the response did not contain the header
+func (limiter *Limiter) throttled(retryAfter time.Duration) {
+	limiter.mu.Lock()
+	defer limiter.mu.Unlock()
+
+	pause := retryAfter
+	if pause <= 0 {
+		pause = limiter.InitialBackoff
+		for i := 0; i < limiter.backoffs && pause < limiter.MaxBackoff; i++ {
+			pause *= 2
+		}
+		if limiter.MaxBackoff > 0 && pause > limiter.MaxBackoff {
+			pause = limiter.MaxBackoff
+		}
+	}
+	limiter.backoffs++
+	limiter.stats.Throttled++
+
+	if pausedUntil := time.Now().Add(pause); pausedUntil.After(limiter.pausedUntil) {
+		limiter.pausedUntil = pausedUntil
+	}
+}
+
+// succeeded resets the backoff after a response, which was not throttled
+func (limiter *Limiter) succeeded() {
+	limiter.mu.Lock()
+	defer limiter.mu.Unlock()
+
+	limiter.backoffs = 0
+}
+
+// parseRetryAfter returns the duration of a Retry-After header, which lists seconds or a date, 0 if it is missing or invalid
+func parseRetryAfter(header string) time.Duration {
+	if header == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(header); err == nil {
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(header); err == nil {
+		return time.Until(date)
+	}
+	return 0
+}
+
+// sleep blocks for the passed duration or until the context is cancelled
+func sleep(ctx context.Context, duration time.Duration) error {
+	timer := time.NewTimer(duration)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// limitedTransport is a round tripper, which sends the requests through a limiter
+type limitedTransport struct {
+	base    http.RoundTripper // round tripper the requests are sent with, http.DefaultTransport if nil
+	limiter *Limiter
+}
+
+// RoundTrip sends the request, once the limiter allows it. GET requests are sent again after a 503 or 429 response.
+func (transport *limitedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := transport.base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	limiter := transport.limiter
+
+	for attempt := 0; ; attempt++ {
+		err := limiter.acquire(req.Context())
+		if err != nil {
+			return nil, err
+		}
+		res, err := base.RoundTrip(req)
+		limiter.release()
+		if err != nil {
+			return nil, err
+		}
+
+		if !isThrottled(res) {
+			limiter.succeeded()
+			return res, nil
+		}
+		limiter.throttled(parseRetryAfter(res.Header.Get("Retry-After")))
+
+		// only requests without side effects are sent again
+		if (req.Method != http.MethodGet && req.Method != http.MethodHead) || attempt >= limiter.MaxRetries {
+			return res, nil
+		}
+		io.Copy(io.Discard, res.Body)
+		res.Body.Close()
+
+		limiter.mu.Lock()
+		limiter.stats.Retries++
+		limiter.mu.Unlock()
+		req = req.Clone(req.Context())
+	}
+}
+
+/*
+SetLimiter limits the requests of the session with the limiter, a limiter can be shared by multiple sessions.
+It should be set before the first request is sent. A nil limiter removes the limit.
+*/
+func (session *Session) SetLimiter(limiter *Limiter) {
+	// the limiter is placed below the language guard and retries, so the requests restoring the language and every retry are limited as well
+	transport := &session.Client.Transport
+	if guard, isGuard := (*transport).(*languageGuard); isGuard {
+		transport = &guard.base
+	}
+	// every attempt of a retried request is limited
+	if retrying, isRetrying := (*transport).(*retryTransport); isRetrying {
+		transport = &retrying.base
+	}
+
+	if limited, isLimited := (*transport).(*limitedTransport); isLimited {
+		if limiter == nil {
+			*transport = limited.base
+			return
+		}
+		limited.limiter = limiter
+		return
+	}
+	if limiter != nil {
+		*transport = &limitedTransport{base: *transport, limiter: limiter}
+	}
+}
@@ -0,0 +1,198 @@
+package stineapi
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func limitedSession(limiter *Limiter) Session {
+	session := Session{Client: &http.Client{}}
+	session.SetLimiter(limiter)
+	return session
+}
+
+func TestLimiterRate(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	limiter := NewLimiter(20, 1)
+	// both sessions share the limiter
+	sessions := []Session{limitedSession(limiter), limitedSession(limiter)}
+
+	start := time.Now()
+	for i := 0; i < 5; i++ {
+		res, err := sessions[i%2].Client.Get(server.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+	}
+
+	// the first request is sent right away, the others wait 50ms each
+	if elapsed := time.Since(start); elapsed < 190*time.Millisecond {
+		t.Error(fmt.Sprintf("requests were sent too fast: %s", elapsed))
+	}
+	if stats := limiter.Stats(); stats.Requests != 5 || stats.InFlight != 0 {
+		t.Error(fmt.Sprintf("requests were not counted correctly: %+v", stats))
+	}
+}
+
+func TestLimiterMaxInFlight(t *testing.T) {
+	var mu sync.Mutex
+	var inFlight, maxInFlight int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		inFlight++
+		if inFlight > maxInFlight {
+			maxInFlight = inFlight
+		}
+		mu.Unlock()
+
+		time.Sleep(20 * time.Millisecond)
+
+		mu.Lock()
+		inFlight--
+		mu.Unlock()
+	}))
+	defer server.Close()
+
+	limiter := NewLimiter(1000, 100)
+	limiter.MaxInFlight = 2
+	session := limitedSession(limiter)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 6; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			res, err := session.Client.Get(server.URL)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			res.Body.Close()
+		}()
+	}
+	wg.Wait()
+
+	if maxInFlight > 2 {
+		t.Error(fmt.Sprintf("WANT: at most 2 requests in flight, GOT: %d", maxInFlight))
+	}
+}
+
+func TestZeroValueLimiter(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(10 * time.Millisecond)
+	}))
+	defer server.Close()
+
+	// the zero value limits nothing but the requests in flight
+	session := limitedSession(&Limiter{MaxInFlight: 1})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			res, err := session.Client.Get(server.URL)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			res.Body.Close()
+		}()
+	}
+	wg.Wait()
+}
+
+func TestLimiterBackoff(t *testing.T) {
+	var mu sync.Mutex
+	responses := map[string]int{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		responses[r.Method]++
+		// every first request is rejected
+		if responses[r.Method] == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	limiter := NewLimiter(1000, 100)
+	limiter.InitialBackoff = 30 * time.Millisecond
+	session := limitedSession(limiter)
+
+	start := time.Now()
+	res, err := session.Client.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Error(fmt.Sprintf("GET request should be sent again, received status %d", res.StatusCode))
+	}
+	if elapsed := time.Since(start); elapsed < 30*time.Millisecond {
+		t.Error(fmt.Sprintf("request should be sent again after the backoff, was sent after %s", elapsed))
+	}
+
+	res, err = session.Client.PostForm(server.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusServiceUnavailable {
+		t.Error("POST requests should never be sent again")
+	}
+
+	if stats := limiter.Stats(); stats.Requests != 3 || stats.Throttled != 2 || stats.Retries != 1 {
+		t.Error(fmt.Sprintf("requests were not counted correctly: %+v", stats))
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	if got := parseRetryAfter("120"); got != 2*time.Minute {
+		t.Error(fmt.Sprintf("WANT: %s, GOT: %s", 2*time.Minute, got))
+	}
+	inAnHour := time.Now().Add(time.Hour).UTC().Format(http.TimeFormat)
+	if got := parseRetryAfter(inAnHour); got < 59*time.Minute || got > time.Hour {
+		t.Error(fmt.Sprintf("WANT: about an hour, GOT: %s", got))
+	}
+	if got := parseRetryAfter("soon"); got != 0 {
+		t.Error(fmt.Sprintf("WANT: 0, GOT: %s", got))
+	}
+}
+
+func TestLimiterAndRetryPolicy(t *testing.T) {
+	var mu sync.Mutex
+	var requests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests++
+		mu.Unlock()
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	limiter := NewLimiter(1000, 100)
+	limiter.InitialBackoff = time.Millisecond
+	limiter.MaxBackoff = time.Millisecond
+	session := retryingSession()
+	session.SetLimiter(limiter)
+
+	res, err := session.Client.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+
+	// only the limiter sends the request again after a 503 response
+	if requests != 1+limiter.MaxRetries {
+		t.Error(fmt.Sprintf("WANT: %d requests, GOT: %d", 1+limiter.MaxRetries, requests))
+	}
+}
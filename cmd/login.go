@@ -0,0 +1,294 @@
+package stineapi
+
+import (
+	"errors"
+	"fmt"
+	"github.com/PuerkitoBio/goquery"
+	"github.com/martenmatrix/stine-api/cmd/internal/auth"
+	"github.com/martenmatrix/stine-api/cmd/internal/campusnet"
+	"github.com/martenmatrix/stine-api/cmd/internal/stineURL"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// ErrWrongCredentials is returned by Login, if STiNE rejected the username or password.
+var ErrWrongCredentials = errors.New("stine rejected the username or password")
+
+// ErrAccountLocked is returned by Login, if the account is locked e.g. after too many failed logins.
+var ErrAccountLocked = errors.New("the account is locked")
+
+// ErrPasswordExpired is returned by Login, if the password expired and needs to be changed on the STiNE website.
+var ErrPasswordExpired = errors.New("the password expired, it needs to be changed on the stine website")
+
+// ErrTermsNotAccepted is returned by Login, if the terms of use need to be accepted on the STiNE website first.
+var ErrTermsNotAccepted = errors.New("the terms of use need to be accepted on the stine website")
+
+// ErrMaintenance is returned, if STiNE is down for maintenance, see [MaintenanceError] for the announced end.
+var ErrMaintenance = errors.New("stine is down for maintenance")
+
+// ErrUnexpectedLoginPage is returned by Login, if STiNE returned a page, which is not part of the login.
+var ErrUnexpectedLoginPage = errors.New("stine returned an unexpected page during the login")
+
+// LoginStep represents a step of the login.
+type LoginStep int
+
+const (
+	LoginStepStartPage   LoginStep = iota // The link to the login form is read from the start page of STiNE
+	LoginStepLoginForm                    // The antiforgery token is read from the login form
+	LoginStepCredentials                  // The credentials are submitted and the session number is read from the response
+	loginStepDone
+)
+
+func (step LoginStep) String() string {
+	switch step {
+	case LoginStepStartPage:
+		return "start page"
+	case LoginStepLoginForm:
+		return "login form"
+	case LoginStepCredentials:
+		return "credentials"
+	default:
+		return "done"
+	}
+}
+
+/*
+LoginError is returned by Login, if a step of the login failed. Err is one of the errors of the login like [ErrWrongCredentials],
+which can be checked with errors.Is, or the error of the request.
+*/
+type LoginError struct {
+	Step    LoginStep // Step, which failed
+	Message string    // Message displayed by STiNE, empty if the page did not contain one
+	Err     error
+}
+
+func (loginErr *LoginError) Error() string {
+	if loginErr.Message != "" {
+		return fmt.Sprintf("login failed at %s: %s: %s", loginErr.Step, loginErr.Err, loginErr.Message)
+	}
+	return fmt.Sprintf("login failed at %s: %s", loginErr.Step, loginErr.Err)
+}
+
+func (loginErr *LoginError) Unwrap() error {
+	return loginErr.Err
+}
+
+// loginPage describes a page displayed instead of the expected one during the login
+type loginPage struct {
+	err      error
+	keywords []string // lower case phrases, of which at least one is contained in the text of the page
+	form     bool     // whether the page needs to contain a form, which the user has to submit
+}
+
+// pages are checked in order, the first match wins, maintenance notices are recognized by detectMaintenance beforehand
+var loginPages = []loginPage{
+	// warnings of a wrong password page, that the account "wird gesperrt", do not match
+	{err: ErrAccountLocked, keywords: []string{"ist gesperrt", "wurde gesperrt", "is locked", "has been locked"}},
+	{err: ErrPasswordExpired, keywords: []string{"passwort ist abgelaufen", "kennwort ist abgelaufen", "passwort abgelaufen", "password has expired", "password expired"}},
+	{err: ErrTermsNotAccepted, keywords: []string{"nutzungsbedingungen", "terms of use"}, form: true},
+	{err: ErrWrongCredentials, keywords: []string{"benutzername oder passwort", "benutzername oder kennwort", "username or password"}},
+}
+
+// messageSelector matches elements, which contain messages of STiNE or its identity server
+const messageSelector = ".alert-danger, .validation-summary-errors, .error, .danger, .alert"
+
+/*
+identifyLoginPage explains, why the expected content is missing from the page of the step. It is only called, if the content is missing,
+so news on the start page mentioning e.g. maintenance do not interrupt the login.
+*/
+func identifyLoginPage(step LoginStep, doc *goquery.Document, fallback error) *LoginError {
+	loginErr := &LoginError{
+		Step:    step,
+		Message: strings.Join(strings.Fields(doc.Find(messageSelector).First().Text()), " "),
+		Err:     fallback,
+	}
+
+	if maintenanceErr, isMaintenance := detectMaintenance(doc, time.Now()); isMaintenance {
+		loginErr.Err = maintenanceErr
+		return loginErr
+	}
+
+	// the message is checked first, as e.g. a wrong password page may warn, that the account will be locked
+	for _, text := range []string{loginErr.Message, doc.Text()} {
+		text = strings.ToLower(text)
+		for _, page := range loginPages {
+			if page.form && doc.Find("form").Length() == 0 {
+				continue
+			}
+			for _, keyword := range page.keywords {
+				if strings.Contains(text, keyword) {
+					loginErr.Err = page.err
+					return loginErr
+				}
+			}
+		}
+	}
+	return loginErr
+}
+
+// loginFlow authenticates a session step by step, every step fetches a page and decides on the next step
+type loginFlow struct {
+	session   *Session
+	username  string
+	password  string
+	step      LoginStep
+	formURL   string // link to the login form on the identity server
+	authToken string // antiforgery token of the login form
+	returnURL string // url the identity server returns to after the login
+}
+
+// fetch loads the page at the url
+func (flow *loginFlow) fetch(url string) (*http.Response, *goquery.Document, error) {
+	res, err := flow.session.Client.Get(url)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer res.Body.Close()
+
+	doc, err := goquery.NewDocumentFromReader(res.Body)
+	if err != nil {
+		return nil, nil, err
+	}
+	return res, doc, nil
+}
+
+// startPage reads the link to the login form from the start page
+func (flow *loginFlow) startPage() error {
+	_, doc, err := flow.fetch(auth.StartPage(flow.session.menu.menuId(MenuStartPage)))
+	if err != nil {
+		return err
+	}
+
+	flow.formURL, err = auth.FindLinkToAuthForm(doc)
+	if err != nil {
+		return identifyLoginPage(flow.step, doc, ErrUnexpectedLoginPage)
+	}
+	flow.step = LoginStepLoginForm
+	return nil
+}
+
+// loginForm creates the initial antiforgery cookie in the jar and reads the token and return url from the login form
+func (flow *loginFlow) loginForm() error {
+	res, doc, err := flow.fetch(flow.formURL)
+	if err != nil {
+		return err
+	}
+
+	flow.authToken, err = auth.FindAuthenticationToken(doc)
+	if err != nil {
+		return identifyLoginPage(flow.step, doc, ErrUnexpectedLoginPage)
+	}
+	flow.returnURL, err = auth.GetReturnURL(res)
+	if err != nil {
+		return err
+	}
+	flow.step = LoginStepCredentials
+	return nil
+}
+
+// credentials submits the credentials
+func (flow *loginFlow) credentials() error {
+	err := flow.session.makeSession(flow.returnURL, flow.username, flow.password, flow.authToken, auth.AuthenticationForm)
+	if err != nil {
+		return err
+	}
+	flow.step = loginStepDone
+	return nil
+}
+
+// run executes the steps until the session is authenticated or a step failed
+func (flow *loginFlow) run() error {
+	for flow.step != loginStepDone {
+		var err error
+		switch flow.step {
+		case LoginStepStartPage:
+			err = flow.startPage()
+		case LoginStepLoginForm:
+			err = flow.loginForm()
+		case LoginStepCredentials:
+			err = flow.credentials()
+		}
+
+		if err != nil {
+			var loginErr *LoginError
+			if errors.As(err, &loginErr) {
+				return err
+			}
+			return &LoginError{Step: flow.step, Err: err}
+		}
+	}
+	return nil
+}
+
+/*
+startOfSession returns the start page of the new session from the response to the login. STiNE links to it in the "Refresh" header,
+which the http library does not follow, as it is not part of the http specification. A meta refresh and redirects are accepted as well.
+*/
+func startOfSession(res *http.Response, doc *goquery.Document) (campusnet.Request, bool) {
+	candidates := []string{res.Header.Get("Refresh")}
+	doc.Find("meta[http-equiv][content]").Each(func(i int, meta *goquery.Selection) {
+		if strings.EqualFold(meta.AttrOr("http-equiv", ""), "refresh") {
+			candidates = append(candidates, meta.AttrOr("content", ""))
+		}
+	})
+	if res.Request != nil && res.Request.URL != nil {
+		candidates = append(candidates, res.Request.URL.String())
+	}
+
+	for _, candidate := range candidates {
+		startPage, err := campusnet.ParseRefresh(candidate)
+		if err == nil && startPage.SessionNo != "" && startPage.SessionNo != campusnet.EmptySessionNo {
+			return startPage, true
+		}
+	}
+	return campusnet.Request{}, false
+}
+
+// creates idsrv, idsrv.session and cnsc cookie in jar
+// the cnsc cookie needs to be added manually to the jar because the server sends it malformatted
+func (session *Session) makeSession(returnURL string, username string, password string, authToken string, authenticationFormURL string) error {
+	formQuery := url.Values{
+		"ReturnUrl":                  {returnURL},
+		"CancelUrl":                  {},
+		"Username":                   {username},
+		"Password":                   {password},
+		"RememberLogin":              {"true"},
+		"button":                     {"login"},
+		"__RequestVerificationToken": {authToken},
+	}
+	res, resErr := session.Client.PostForm(authenticationFormURL, formQuery)
+	if resErr != nil {
+		return resErr
+	}
+	defer res.Body.Close()
+
+	doc, docErr := goquery.NewDocumentFromReader(res.Body)
+	if docErr != nil {
+		return docErr
+	}
+
+	if res.StatusCode != http.StatusOK {
+		return identifyLoginPage(LoginStepCredentials, doc, errors.New(fmt.Sprintf("authentication with username/password failed with status %d", res.StatusCode)))
+	}
+
+	// cnsc cookie is returned malformatted, set manually on Client
+	cnscCookie, cookieErr := auth.GetMalformattedCnscCookie(res)
+	if cookieErr != nil {
+		return identifyLoginPage(LoginStepCredentials, doc, ErrWrongCredentials)
+	}
+	authUrl, authUrlErr := url.Parse(stineURL.Url + "/scripts")
+	if authUrlErr != nil {
+		return authUrlErr
+	}
+	session.Client.Jar.SetCookies(authUrl, []*http.Cookie{cnscCookie})
+
+	startPage, found := startOfSession(res, doc)
+	if !found {
+		return identifyLoginPage(LoginStepCredentials, doc, ErrUnexpectedLoginPage)
+	}
+	session.SessionNo = startPage.SessionNo
+
+	return nil
+}
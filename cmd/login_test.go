@@ -0,0 +1,82 @@
+package stineapi
+
+import (
+	"errors"
+	"fmt"
+	"github.com/PuerkitoBio/goquery"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestIdentifyLoginPage(t *testing.T) {
+	tests := []struct {
+		name    string
+		html    string
+		want    error
+		message string
+	}{
+		{
+			"wrong password warning about lock",
+			`<div class="alert-danger">Ungültiger Benutzername oder Passwort</div><p>Nach 5 Fehlversuchen wird Ihr Konto gesperrt.</p>`,
+			ErrWrongCredentials,
+			"Ungültiger Benutzername oder Passwort",
+		},
+		{
+			"single alert warning about lock",
+			`<div class="alert-danger">Benutzername oder Passwort falsch. Nach 3 Fehlversuchen wird Ihr Konto gesperrt.</div>`,
+			ErrWrongCredentials,
+			"Benutzername oder Passwort falsch. Nach 3 Fehlversuchen wird Ihr Konto gesperrt.",
+		},
+		{"locked", `<div class="validation-summary-errors">Your account is locked.</div>`, ErrAccountLocked, "Your account is locked."},
+		{"expired", `<h1>Passwort ändern</h1><p>Ihr Passwort ist abgelaufen.</p>`, ErrPasswordExpired, ""},
+		{"terms", `<p>Please accept the terms of use.</p><form><button>Accept</button></form>`, ErrTermsNotAccepted, ""},
+		{"terms link without form", `<a href="/terms">Terms of use</a>`, ErrUnexpectedLoginPage, ""},
+		{"maintenance", `<h1>Wartungsarbeiten</h1>`, ErrMaintenance, ""},
+		{"login form announcing maintenance", `<p>Scheduled maintenance on Sunday.</p><form><input name="Username"></form>`, ErrUnexpectedLoginPage, ""},
+		{"unknown", `<html></html>`, ErrUnexpectedLoginPage, ""},
+	}
+
+	for _, test := range tests {
+		doc, err := goquery.NewDocumentFromReader(strings.NewReader(test.html))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		loginErr := identifyLoginPage(LoginStepCredentials, doc, ErrUnexpectedLoginPage)
+		if !errors.Is(loginErr, test.want) || loginErr.Message != test.message {
+			t.Error(fmt.Sprintf("%s: WANT: %s %q, GOT: %s %q", test.name, test.want, test.message, loginErr.Err, loginErr.Message))
+		}
+	}
+}
+
+func TestStartOfSession(t *testing.T) {
+	startPage := "/scripts/mgrqispi.dll?APPNAME=CampusNet&PRGNAME=MLSSTART&ARGUMENTS=-N899462345432351,-N000266,"
+	redirected, _ := url.Parse("https://www.stine.uni-hamburg.de" + startPage)
+
+	tests := []struct {
+		name  string
+		res   *http.Response
+		html  string
+		found bool
+	}{
+		{"refresh header", &http.Response{Header: http.Header{"Refresh": {"0; URL=" + startPage}}}, "", true},
+		{"meta refresh", &http.Response{Header: http.Header{}}, `<meta http-equiv="Refresh" content="0; URL=` + startPage + `">`, true},
+		{"redirect", &http.Response{Header: http.Header{}, Request: &http.Request{URL: redirected}}, "", true},
+		{"missing", &http.Response{Header: http.Header{}}, "", false},
+		{"session of a user, who is not authenticated", &http.Response{Header: http.Header{"Refresh": {"0; URL=/scripts/mgrqispi.dll?ARGUMENTS=-N000000000000000"}}}, "", false},
+	}
+
+	for _, test := range tests {
+		doc, err := goquery.NewDocumentFromReader(strings.NewReader(test.html))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req, found := startOfSession(test.res, doc)
+		if found != test.found || (found && req.SessionNo != "899462345432351") {
+			t.Error(fmt.Sprintf("%s: WANT: %t, GOT: %t %s", test.name, test.found, found, req.SessionNo))
+		}
+	}
+}
@@ -0,0 +1,164 @@
+package stineapi
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/PuerkitoBio/goquery"
+	"io"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/*
+MaintenanceError is returned instead of the page, if STiNE displayed a maintenance notice.
+It matches [ErrMaintenance] with errors.Is, use errors.As to read the announced end of the maintenance.
+*/
+type MaintenanceError struct {
+	Until   time.Time // Announced end of the maintenance, zero if the notice did not contain one
+	Message string    // Text of the maintenance notice
+}
+
+func (maintenanceErr *MaintenanceError) Error() string {
+	if maintenanceErr.Until.IsZero() {
+		return ErrMaintenance.Error()
+	}
+	return fmt.Sprintf("%s until %s", ErrMaintenance, maintenanceErr.Until.Format("2006-01-02 15:04 MST"))
+}
+
+func (maintenanceErr *MaintenanceError) Is(target error) bool {
+	return target == ErrMaintenance
+}
+
+var (
+	// e.g. "bis 20.10.2026 06:00 Uhr" or "until 20.10.2026, 6:00"
+	maintenanceDateTime = regexp.MustCompile(`(\d{1,2})\.(\d{1,2})\.(\d{4}),?\s*(?:um\s+|at\s+)?(\d{1,2})[:.](\d{2})`)
+	// e.g. "bis voraussichtlich 06:00 Uhr" or "until 6:00 am"
+	maintenanceTime = regexp.MustCompile(`(?i)(?:bis|until)\s+(?:ca\.\s+|voraussichtlich\s+|approximately\s+|about\s+)?(\d{1,2})[:.](\d{2})\s*(am|pm)?`)
+)
+
+// parseMaintenanceEnd returns the end of the maintenance announced in the text, zero if it does not contain one. Times without a date refer to their next occurrence after now.
+func parseMaintenanceEnd(text string, now time.Time) time.Time {
+	if match := maintenanceDateTime.FindStringSubmatch(text); match != nil {
+		day, _ := strconv.Atoi(match[1])
+		month, _ := strconv.Atoi(match[2])
+		year, _ := strconv.Atoi(match[3])
+		hour, _ := strconv.Atoi(match[4])
+		minute, _ := strconv.Atoi(match[5])
+		return time.Date(year, time.Month(month), day, hour, minute, 0, 0, stineLocation())
+	}
+
+	if match := maintenanceTime.FindStringSubmatch(text); match != nil {
+		hour, _ := strconv.Atoi(match[1])
+		minute, _ := strconv.Atoi(match[2])
+		switch strings.ToLower(match[3]) {
+		case "am":
+			hour %= 12
+		case "pm":
+			hour = hour%12 + 12
+		}
+
+		now = now.In(stineLocation())
+		end := time.Date(now.Year(), now.Month(), now.Day(), hour, minute, 0, 0, stineLocation())
+		if !end.After(now) {
+			end = end.AddDate(0, 0, 1)
+		}
+		return end
+	}
+
+	return time.Time{}
+}
+
+/*
+detectMaintenance checks, if the page is a maintenance notice. The notice replaces the whole page, so regular pages mentioning
+a maintenance e.g. in the news on the start page are not mistaken for one.
+*/
+func detectMaintenance(doc *goquery.Document, now time.Time) (*MaintenanceError, bool) {
+	if doc.Find("#pageContent, #pageTopNavi, form").Length() > 0 {
+		return nil, false
+	}
+
+	text := strings.Join(strings.Fields(doc.Text()), " ")
+	lowerText := strings.ToLower(text)
+	if !strings.Contains(lowerText, "wartungsarbeiten") && !strings.Contains(lowerText, "wartungsmodus") && !strings.Contains(lowerText, "maintenance") {
+		return nil, false
+	}
+
+	return &MaintenanceError{
+		Until:   parseMaintenanceEnd(text, now),
+		Message: text,
+	}, true
+}
+
+// maintenanceTransport is a round tripper, which returns a MaintenanceError instead of maintenance notices
+type maintenanceTransport struct {
+	base http.RoundTripper // round tripper the requests are sent with, http.DefaultTransport if nil
+}
+
+// RoundTrip sends the request and checks, if the returned page is a maintenance notice.
+func (transport *maintenanceTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := transport.base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	res, err := base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	contentType := res.Header.Get("Content-Type")
+	if contentType != "" && !strings.Contains(contentType, "html") {
+		return res, nil
+	}
+
+	// the body is read to check it and replaced, so it can be read again by the caller
+	body, err := io.ReadAll(res.Body)
+	res.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	res.Body = io.NopCloser(bytes.NewReader(body))
+
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(body))
+	if err != nil {
+		return res, nil
+	}
+	if maintenanceErr, isMaintenance := detectMaintenance(doc, time.Now()); isMaintenance {
+		return nil, maintenanceErr
+	}
+	return res, nil
+}
+
+/*
+SetMaintenanceDetection enables or disables the detection of maintenance notices. If it is enabled, every request of the session,
+which STiNE answers with a maintenance notice, fails with a [MaintenanceError] instead of returning the notice as an empty page.
+It is enabled by NewSession, a Client set on the session afterwards needs to enable it again.
+*/
+func (session *Session) SetMaintenanceDetection(enabled bool) {
+	// the detection is placed below every other round tripper of the session, so every response is checked
+	transport := &session.Client.Transport
+	for {
+		switch wrapper := (*transport).(type) {
+		case *languageGuard:
+			transport = &wrapper.base
+			continue
+		case *retryTransport:
+			transport = &wrapper.base
+			continue
+		case *limitedTransport:
+			transport = &wrapper.base
+			continue
+		}
+		break
+	}
+
+	detecting, isDetecting := (*transport).(*maintenanceTransport)
+	if isDetecting && !enabled {
+		*transport = detecting.base
+	}
+	if !isDetecting && enabled {
+		*transport = &maintenanceTransport{base: *transport}
+	}
+}
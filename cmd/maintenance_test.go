@@ -0,0 +1,105 @@
+package stineapi
+
+import (
+	"errors"
+	"fmt"
+	"github.com/PuerkitoBio/goquery"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseMaintenanceEnd(t *testing.T) {
+	berlin := stineLocation()
+	now := time.Date(2026, time.October, 19, 22, 30, 0, 0, berlin)
+
+	tests := []struct {
+		text string
+		want time.Time
+	}{
+		{"STiNE ist wegen Wartungsarbeiten bis 20.10.2026 06:00 Uhr nicht erreichbar.", time.Date(2026, time.October, 20, 6, 0, 0, 0, berlin)},
+		{"Due to maintenance STiNE is unavailable until 20.10.2026, 6:30.", time.Date(2026, time.October, 20, 6, 30, 0, 0, berlin)},
+		{"Wartungsarbeiten bis voraussichtlich 23:45 Uhr", time.Date(2026, time.October, 19, 23, 45, 0, 0, berlin)},
+		{"Maintenance until 6:00 am", time.Date(2026, time.October, 20, 6, 0, 0, 0, berlin)},
+		{"Maintenance until 11:15 pm", time.Date(2026, time.October, 19, 23, 15, 0, 0, berlin)},
+		{"STiNE ist wegen Wartungsarbeiten nicht erreichbar.", time.Time{}},
+	}
+
+	for _, test := range tests {
+		if got := parseMaintenanceEnd(test.text, now); !got.Equal(test.want) {
+			t.Error(fmt.Sprintf("%q: WANT: %s, GOT: %s", test.text, test.want, got))
+		}
+	}
+}
+
+func TestDetectMaintenance(t *testing.T) {
+	tests := []struct {
+		name string
+		html string
+		want bool
+	}{
+		{"notice", `<html><body><h1>Wartungsarbeiten</h1><p>STiNE ist nicht erreichbar.</p></body></html>`, true},
+		{"english notice", `<html><body><p>STiNE is down for maintenance.</p></body></html>`, true},
+		{"news on a regular page", `<div id="pageContent"><p>Am Wochenende finden Wartungsarbeiten statt.</p></div>`, false},
+		{"login form", `<form><p>Scheduled maintenance on sunday</p><input name="Username"></form>`, false},
+		{"empty page", `<html></html>`, false},
+	}
+
+	for _, test := range tests {
+		doc, err := goquery.NewDocumentFromReader(strings.NewReader(test.html))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, got := detectMaintenance(doc, time.Now()); got != test.want {
+			t.Error(fmt.Sprintf("%s: WANT: %t, GOT: %t", test.name, test.want, got))
+		}
+	}
+}
+
+func TestMaintenanceDetection(t *testing.T) {
+	var requests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.URL.Path == "/maintenance" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write([]byte(`<html><body>STiNE ist wegen Wartungsarbeiten bis 20.10.2026 06:00 Uhr nicht erreichbar.</body></html>`))
+			return
+		}
+		w.Write([]byte(`<html><body><div id="pageContent">Modules</div></body></html>`))
+	}))
+	defer server.Close()
+
+	session := Session{Client: &http.Client{}}
+	session.SetRetryPolicy(&RetryPolicy{MaxAttempts: 3, InitialDelay: time.Millisecond})
+	session.SetMaintenanceDetection(true)
+
+	_, err := session.Client.Get(server.URL + "/maintenance")
+	var maintenanceErr *MaintenanceError
+	if !errors.Is(err, ErrMaintenance) || !errors.As(err, &maintenanceErr) {
+		t.Fatal(fmt.Sprintf("WANT: %s, GOT: %v", ErrMaintenance, err))
+	}
+	if want := time.Date(2026, time.October, 20, 6, 0, 0, 0, stineLocation()); !maintenanceErr.Until.Equal(want) {
+		t.Error(fmt.Sprintf("WANT: %s, GOT: %s", want, maintenanceErr.Until))
+	}
+	if requests != 1 {
+		t.Error(fmt.Sprintf("requests during a maintenance should not be retried, GOT: %d requests", requests))
+	}
+
+	// regular pages can still be read
+	res, err := session.Client.Get(server.URL + "/modules")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	doc, err := goquery.NewDocumentFromReader(res.Body)
+	if err != nil || doc.Find("#pageContent").Text() != "Modules" {
+		t.Error(fmt.Sprintf("body of a regular page should be returned, GOT: %v", err))
+	}
+
+	session.SetMaintenanceDetection(false)
+	if _, isDetecting := session.Client.Transport.(*retryTransport).base.(*maintenanceTransport); isDetecting {
+		t.Error("detection should be removed")
+	}
+}
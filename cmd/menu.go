@@ -0,0 +1,143 @@
+package stineapi
+
+import (
+	"github.com/PuerkitoBio/goquery"
+	"github.com/martenmatrix/stine-api/cmd/internal/auth"
+	"github.com/martenmatrix/stine-api/cmd/internal/campusnet"
+	"github.com/martenmatrix/stine-api/cmd/internal/userDataGetter"
+	"strings"
+)
+
+// MenuKey identifies an entry of the STiNE menu independent of its menu id, which differs between accounts and semesters.
+type MenuKey string
+
+const (
+	MenuModuleRegistration MenuKey = "moduleRegistration" // "Studium" > "Anmeldung zu Veranstaltungen"
+	MenuExamRegistration   MenuKey = "examRegistration"   // "Studium" > "Prüfungen" > "Anmeldung zu Prüfungen"
+	MenuUserAccount        MenuKey = "userAccount"        // "Service" > "Persönliche Daten"
+	MenuStartPage          MenuKey = "startPage"          // "Startseite", the page the login starts on
+)
+
+// menuKeyEntry describes how the entry of a menu key is found in the menu
+type menuKeyEntry struct {
+	programs []string // program names of the entry, the first match in the menu is used
+	argument string   // string argument the url of the entry has to contain, empty if the program names are sufficient
+	fallback string   // menu id used, if the menu was not loaded or does not contain the entry
+}
+
+var menuKeys = map[MenuKey]menuKeyEntry{
+	MenuModuleRegistration: {programs: []string{"REGISTRATION"}, fallback: "000309"},
+	MenuExamRegistration:   {programs: []string{"EXAMREGISTRATION"}, fallback: examMenuId},
+	MenuUserAccount:        {programs: []string{"PERSADDRESS"}, fallback: userDataGetter.UserAccountMenuId},
+	// other pages of the navigation are rendered by EXTERNALPAGES as well
+	MenuStartPage: {programs: []string{"EXTERNALPAGES"}, argument: "startseite", fallback: auth.StartPageMenuId},
+}
+
+// hasArgument checks, if the url of the entry contains the string argument
+func hasArgument(entry MenuEntry, argument string) bool {
+	req, err := campusnet.Parse(entry.URL)
+	if err != nil {
+		return false
+	}
+	for _, arg := range req.Args {
+		if arg == campusnet.A(argument) {
+			return true
+		}
+	}
+	return false
+}
+
+// MenuEntry represents an entry of the navigation on the STiNE page.
+type MenuEntry struct {
+	Title    string      // Title of the entry as displayed on the STiNE page
+	MenuId   string      // Menu id of the entry, which is sent with every request made from the page of the entry
+	PrgName  string      // Name of the program, which renders the page of the entry e.g. REGISTRATION
+	URL      string      // URL of the page of the entry
+	Children []MenuEntry // Entries nested under this entry
+}
+
+// Menu represents the navigation on the STiNE page of the authenticated user.
+type Menu struct {
+	Entries []MenuEntry
+}
+
+// find returns the first entry, which satisfies matches, searching depth first
+func findEntry(entries []MenuEntry, matches func(entry MenuEntry) bool) (MenuEntry, bool) {
+	for _, entry := range entries {
+		if matches(entry) {
+			return entry, true
+		}
+		if child, found := findEntry(entry.Children, matches); found {
+			return child, true
+		}
+	}
+	return MenuEntry{}, false
+}
+
+// Find returns the entry of the menu, which belongs to the passed key. The second return value is false, if the menu does not contain it.
+func (menu Menu) Find(key MenuKey) (MenuEntry, bool) {
+	keyEntry, exists := menuKeys[key]
+	if !exists {
+		return MenuEntry{}, false
+	}
+
+	return findEntry(menu.Entries, func(entry MenuEntry) bool {
+		for _, program := range keyEntry.programs {
+			if strings.EqualFold(entry.PrgName, program) {
+				return keyEntry.argument == "" || hasArgument(entry, keyEntry.argument)
+			}
+		}
+		return false
+	})
+}
+
+// menuId returns the menu id of the passed key, the default menu id is returned if the menu does not contain the key
+func (menu Menu) menuId(key MenuKey) string {
+	entry, found := menu.Find(key)
+	if found && entry.MenuId != "" {
+		return entry.MenuId
+	}
+	return menuKeys[key].fallback
+}
+
+// menuURL returns the absolute url of a link of the navigation, links to other websites are kept
+func menuURL(href string) string {
+	if strings.Contains(href, "://") {
+		return href
+	}
+	return addSTiNEPrefix(href)
+}
+
+// extractMenuEntries extracts the entries of a navigation list and the entries nested in them
+func extractMenuEntries(list *goquery.Selection) []MenuEntry {
+	var entries []MenuEntry
+
+	list.ChildrenFiltered("li").Each(func(i int, item *goquery.Selection) {
+		link := item.ChildrenFiltered("a").First()
+		href, _ := link.Attr("href")
+
+		entry := MenuEntry{
+			Title: strings.TrimSpace(link.Text()),
+			URL:   menuURL(href),
+		}
+		req, err := campusnet.Parse(href)
+		if err == nil {
+			entry.MenuId = req.MenuId
+			entry.PrgName = req.PrgName
+		}
+		entry.Children = extractMenuEntries(item.ChildrenFiltered("ul"))
+
+		entries = append(entries, entry)
+	})
+
+	return entries
+}
+
+// parseMenu parses the navigation of a STiNE page
+func parseMenu(doc *goquery.Document) Menu {
+	var menu Menu
+	doc.Find("#pageTopNavi > ul, #pageLeftNavi > ul").Each(func(i int, list *goquery.Selection) {
+		menu.Entries = append(menu.Entries, extractMenuEntries(list)...)
+	})
+	return menu
+}
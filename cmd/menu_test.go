@@ -0,0 +1,102 @@
+package stineapi
+
+import (
+	"fmt"
+	"github.com/PuerkitoBio/goquery"
+	"github.com/google/go-cmp/cmp"
+	"github.com/martenmatrix/stine-api/cmd/internal/campusnet"
+	"github.com/martenmatrix/stine-api/cmd/internal/stineURL"
+	"strings"
+	"testing"
+)
+
+const stineHTMLNavigation = `<div id="pageTopNavi">
+	<ul class="nav depth_1 linkItemContainer">
+		<li class="intern depth_1 linkItem" id="link000266"><a class="depth_1 link000266 navLink" href="/scripts/mgrqispi.dll?APPNAME=CampusNet&PRGNAME=MLSSTART&ARGUMENTS=-N123456789012345,-N000266,">Studium</a>
+			<ul class="nav depth_2 linkItemContainer">
+				<li class="intern depth_2 linkItem" id="link000412"><a class="depth_2 link000412 navLink" href="/scripts/mgrqispi.dll?APPNAME=CampusNet&PRGNAME=REGISTRATION&ARGUMENTS=-N123456789012345,-N000412,-Avvz">Anmeldung zu Veranstaltungen</a></li>
+				<li class="intern depth_2 linkItem" id="link000413"><a class="depth_2 link000413 navLink" href="/scripts/mgrqispi.dll?APPNAME=CampusNet&PRGNAME=EXAMREGISTRATION&ARGUMENTS=-N123456789012345,-N000413,">Anmeldung zu Prüfungen</a></li>
+			</ul>
+		</li>
+		<li class="extern depth_1 linkItem"><a class="depth_1 navLink" href="https://www.uni-hamburg.de">Universität</a></li>
+	</ul>
+</div>`
+
+func TestParseMenu(t *testing.T) {
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(stineHTMLNavigation))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	menu := parseMenu(doc)
+	want := Menu{
+		Entries: []MenuEntry{
+			{
+				Title:   "Studium",
+				MenuId:  "000266",
+				PrgName: "MLSSTART",
+				URL:     stineURL.Url + "/scripts/mgrqispi.dll?APPNAME=CampusNet&PRGNAME=MLSSTART&ARGUMENTS=-N123456789012345,-N000266,",
+				Children: []MenuEntry{
+					{
+						Title:   "Anmeldung zu Veranstaltungen",
+						MenuId:  "000412",
+						PrgName: "REGISTRATION",
+						URL:     stineURL.Url + "/scripts/mgrqispi.dll?APPNAME=CampusNet&PRGNAME=REGISTRATION&ARGUMENTS=-N123456789012345,-N000412,-Avvz",
+					},
+					{
+						Title:   "Anmeldung zu Prüfungen",
+						MenuId:  "000413",
+						PrgName: "EXAMREGISTRATION",
+						URL:     stineURL.Url + "/scripts/mgrqispi.dll?APPNAME=CampusNet&PRGNAME=EXAMREGISTRATION&ARGUMENTS=-N123456789012345,-N000413,",
+					},
+				},
+			},
+			{
+				Title: "Universität",
+				URL:   "https://www.uni-hamburg.de",
+			},
+		},
+	}
+
+	if !cmp.Equal(menu, want) {
+		t.Error(cmp.Diff(want, menu))
+	}
+}
+
+func TestMenuId(t *testing.T) {
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(stineHTMLNavigation))
+	if err != nil {
+		t.Fatal(err)
+	}
+	menu := parseMenu(doc)
+	linksMenu := Menu{Entries: []MenuEntry{
+		{PrgName: "EXTERNALPAGES", MenuId: "000499", URL: campusnet.Request{PrgName: "EXTERNALPAGES", SessionNo: "1", MenuId: "000499", Args: []campusnet.Arg{campusnet.A("hilfe")}}.URL()},
+		{PrgName: "EXTERNALPAGES", MenuId: "000501", URL: campusnet.Request{PrgName: "EXTERNALPAGES", SessionNo: "1", MenuId: "000501", Args: []campusnet.Arg{campusnet.A("startseite")}}.URL()},
+		{PrgName: "PERSADDRESS", MenuId: "000500"},
+	}}
+
+	tests := []struct {
+		menu Menu
+		key  MenuKey
+		want string
+	}{
+		{menu, MenuModuleRegistration, "000412"},
+		{menu, MenuExamRegistration, "000413"},
+		// not listed in the menu
+		{menu, MenuUserAccount, "000273"},
+		{linksMenu, MenuUserAccount, "000500"},
+		// only the external page with the start page argument is the start page
+		{linksMenu, MenuStartPage, "000501"},
+		// menu could not be loaded
+		{Menu{}, MenuModuleRegistration, "000309"},
+		{Menu{}, MenuStartPage, "000265"},
+		{Menu{}, MenuExamRegistration, examMenuId},
+	}
+
+	for _, test := range tests {
+		got := test.menu.menuId(test.key)
+		if got != test.want {
+			t.Error(fmt.Sprintf("%s: WANT: %s, GOT: %s", test.key, test.want, got))
+		}
+	}
+}
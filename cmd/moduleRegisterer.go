@@ -2,20 +2,37 @@ package stineapi
 
 import (
 	"errors"
-	"fmt"
 	"github.com/PuerkitoBio/goquery"
+	"github.com/martenmatrix/stine-api/cmd/internal/campusnet"
 	"github.com/martenmatrix/stine-api/cmd/internal/onPage"
-	"github.com/martenmatrix/stine-api/cmd/internal/sessionNo"
-	"log"
 	"net/http"
 	"net/url"
 	"strings"
 )
 
+// nextButtons are the labels of the submit button of the registration forms, STiNE sends the label of the active language
+var nextButtons = map[Language]string{
+	German:  " Weiter",
+	English: " Next",
+}
+
+// nextButton returns the label of the submit button of the form on the page, if the page contains none the label of its language is used
+func nextButton(doc *goquery.Document) string {
+	label, exists := doc.Find(`input[name="Next"]`).First().Attr("value")
+	if exists {
+		return label
+	}
+	lang, err := parseLanguage(doc)
+	if err != nil {
+		return nextButtons[German]
+	}
+	return nextButtons[lang]
+}
+
 // DoRegistrationRequest initiates the registration request on the STiNE servers
-func doRegistrationRequest(client *http.Client, reqUrl string, sessionNo string, menuId string, registrationId string) (*http.Response, error) {
+func doRegistrationRequest(client *http.Client, reqUrl string, sessionNo string, menuId string, registrationId string, next string) (*http.Response, error) {
 	formQuery := url.Values{
-		"Next":      {" Weiter"},
+		"Next":      {next},
 		"APPNAME":   {"CampusNet"},
 		"PRGNAME":   {"SAVEREGISTRATIONDETAILS"},
 		"ARGUMENTS": {"sessionno,menuid,rgtr_id"},
@@ -42,23 +59,23 @@ func getRBCode(doc *goquery.Document) (string, error) {
 }
 
 // converts the selected exam to the stine exam date types
-func getExamMode(examDate int) string {
+func getExamMode(examDate ExamDate) string {
 	switch examDate {
-	case 0:
+	case FirstExamDate:
 		return " 1"
-	case 1:
+	case SecondExamDate:
 		return " 2"
-	case 2:
+	case OtherSemester:
 		return "99"
 	}
 	return " 1"
 }
 
 // DoExamRegistrationRequest sends the exam selection to the servers, this only works after DoRegistrationRequest was executed
-func doExamRegistrationRequest(client *http.Client, reqUrl string, rbCode string, sessionNo string, menuId string, registrationId string, examDate int) (*http.Response, error) {
+func doExamRegistrationRequest(client *http.Client, reqUrl string, rbCode string, sessionNo string, menuId string, registrationId string, examMode string, next string) (*http.Response, error) {
 	formQuery := url.Values{
-		"Next":      {" Next"},
-		rbCode:      {getExamMode(examDate)},
+		"Next":      {next},
+		rbCode:      {examMode},
 		"APPNAME":   {"CAMPUSNET"},
 		"PRGNAME":   {"SAVEEXAMDETAILS"},
 		"ARGUMENTS": {"sessionno,menuid,rgtr_id,mode"},
@@ -77,22 +94,29 @@ func doExamRegistrationRequest(client *http.Client, reqUrl string, rbCode string
 	return res, nil
 }
 
-// GetRegistrationId extracts the registrationId from the HTML, which the registrationLink links to
-func getRegistrationId(client *http.Client, registrationLink string) (string, error) {
-	res, _ := client.Get(registrationLink)
+// ErrRegistrationNotOpen is returned, if STiNE does not offer a registration form for the module (yet).
+var ErrRegistrationNotOpen = errors.New("registration is not open yet, unable to find registration id in response")
+
+// GetRegistrationId extracts the registrationId and the label of the submit button from the HTML, which the registrationLink links to
+func getRegistrationId(client *http.Client, registrationLink string) (string, string, error) {
+	res, err := client.Get(registrationLink)
+	if err != nil {
+		return "", "", err
+	}
 	defer res.Body.Close()
 
 	doc, err := goquery.NewDocumentFromReader(res.Body)
 	if err != nil {
-		return "", err
+		return "", "", err
 	}
 
+	// the registration form is only rendered, while the registration window of the module is open
 	regId, onPage := doc.Find(`input[name="rgtr_id"]`).First().Attr("value")
 	if !onPage {
-		return "", errors.New("unable to find registration id in response")
+		return "", "", ErrRegistrationNotOpen
 	}
 
-	return regId, nil
+	return regId, nextButton(doc), nil
 }
 
 /*
@@ -100,50 +124,105 @@ ModuleRegistration represents a running registration for a module on the STiNE p
 */
 type ModuleRegistration struct {
 	registrationLink string
-	registrationId   string // id from a hidden input field, which is returned after requesting the registrationLink
-	menuId           string // menu id represents, which option is selected on the menu to the left on the stine page
-	ExamDate         int    // The selected exam date, 0 - first exam, 1 - second exam, or 2 - another semester
+	registrationId   string       // id from a hidden input field, which is returned after requesting the registrationLink
+	nextButton       string       // label of the submit button of the registration form, which is returned with the registrationId
+	menuId           string       // menu id represents, which option is selected on the menu to the left on the stine page
+	tanSettings      tanSettings  // used to enter the itan, if one is required
+	ExamDate         ExamDate     // The selected exam date, only used if no exam selector is set
+	examSelector     ExamSelector // selects one of the exam options offered by stine, overrides ExamDate
 	sessionNumber    string
 	client           *http.Client
 }
 
 // creates a TanRequired struct for the required iTAN
 func (modReg *ModuleRegistration) getTanRequiredStruct(doc *goquery.Document) *TanRequired {
-	itanStart := doc.Find(".itan").First().Text()
+	return newTanRequired(doc, modReg.client, modReg.sessionNumber, modReg.registrationLink, modReg.registrationId, "SAVEREGISTRATION")
+}
 
-	iTANWithLeadingZero := strings.ReplaceAll(itanStart, " ", "0")
+/*
+SetExamDate allows you to choose a specific exam date for the initial registration. If this function is not executed, the first exam date is selected by default.
+
+The exam date will not be changed, if the user is already registered for the module.
+If an invalid exam date is passed, [ErrInvalidExamDate] is returned and the exam date is not changed.
 
-	return &TanRequired{
-		client:         modReg.client,
-		sessionNo:      modReg.sessionNumber,
-		url:            modReg.registrationLink,
-		registrationId: modReg.registrationId,
-		TanStartsWith:  iTANWithLeadingZero,
+If the selected exam date is not offered by STiNE, the registration fails with [ErrInvalidExamOption].
+Use SetExamSelector to choose from the exam dates actually offered.
+*/
+func (modReg *ModuleRegistration) SetExamDate(examDate ExamDate) error {
+	if examDate < FirstExamDate || examDate > OtherSemester {
+		return ErrInvalidExamDate
 	}
+	modReg.ExamDate = examDate
+	return nil
 }
 
 /*
-SetExamDate allows you to choose a specific exam date for the initial registration. If this function is not executed, the first exam date is selected by default.
+SetExamSelector sets a function, which is called with the exam options offered by STiNE, if the user needs to select an exam during the registration.
+The returned option is selected. If it is not one of the offered options, the registration fails with [ErrInvalidExamOption].
 
-The exam date will not be changed, if the user is already registered for the module.
+The selector overrides the exam date set with SetExamDate.
+*/
+func (modReg *ModuleRegistration) SetExamSelector(selector ExamSelector) {
+	modReg.examSelector = selector
+}
+
+// returns the name of the radio group and the value, which need to be sent to select the exam on the current page
+func (modReg *ModuleRegistration) selectExam(doc *goquery.Document) (string, string, error) {
+	options := parseExamOptions(doc)
+
+	if modReg.examSelector != nil {
+		selected, err := modReg.examSelector(options)
+		if err != nil {
+			return "", "", err
+		}
+		for _, option := range options {
+			if option.Group == selected.Group && option.Value == selected.Value {
+				return option.Group, option.Value, nil
+			}
+		}
+		return "", "", ErrInvalidExamOption
+	}
 
-0 - Selects the first exam date (default choice).
+	rbCode, err := getRBCode(doc)
+	if err != nil {
+		return "", "", err
+	}
+	examMode := getExamMode(modReg.ExamDate)
+	for _, option := range options {
+		// stine pads the values inconsistently
+		if option.Group == rbCode && strings.TrimSpace(option.Value) == strings.TrimSpace(examMode) {
+			return rbCode, examMode, nil
+		}
+	}
+	return "", "", ErrInvalidExamOption
+}
 
-1 - Selects the second exam date.
+/*
+Prepare fetches the registration form of the module in advance, so a following call of Register only needs to submit it.
+Calling Prepare regularly also keeps the session alive.
 
-2 - Opts for writing the exam in a different semester (exact date not specified).
+If the registration window of the module is not open yet, [ErrRegistrationNotOpen] is returned.
 */
-func (modReg *ModuleRegistration) SetExamDate(examDate int) {
-	if examDate < 0 || examDate > 2 {
-		log.Println(fmt.Sprintf("SetExamDate only accepts the integers from 1 to 2. The exam date (current value: %d) will not be changed.", examDate))
-	} else {
-		modReg.ExamDate = examDate
+func (modReg *ModuleRegistration) Prepare() error {
+	modReg.registrationLink = campusnet.RefreshSessionNo(modReg.registrationLink, modReg.sessionNumber)
+	regId, next, err := getRegistrationId(modReg.client, modReg.registrationLink)
+	if err != nil {
+		return err
 	}
+	modReg.registrationId = regId
+	modReg.nextButton = next
+	return nil
 }
 
 /*
 Register sends the registration to the STiNE servers.
 If an iTAN is required, instead of nil a [TanRequired] is returned.
+
+If a [TanProvider] is set on the session, the iTAN is entered automatically and nil is returned.
+If the provider fails, the [TanRequired] is returned together with the error.
+
+If the registration window of the module is not open yet, [ErrRegistrationNotOpen] is returned.
+If STiNE rejects the registration e.g. because the event is fully booked, a [RejectedError] is returned.
 */
 func (modReg *ModuleRegistration) Register() (*TanRequired, error) {
 
@@ -151,13 +230,20 @@ func (modReg *ModuleRegistration) Register() (*TanRequired, error) {
 	var currentDocument *goquery.Document
 	var err error
 
-	modReg.registrationLink = sessionNo.Refresh(modReg.registrationLink, modReg.sessionNumber)
-	regId, err := getRegistrationId(modReg.client, modReg.registrationLink)
-	if err != nil {
-		return nil, err
+	// registration form could have already been fetched with Prepare
+	if modReg.registrationId == "" {
+		err = modReg.Prepare()
+		if err != nil {
+			return nil, err
+		}
 	}
+	regId := modReg.registrationId
+	// a registration id can only be submitted once
+	defer func() {
+		modReg.registrationId = ""
+	}()
 
-	currentResponse, err = doRegistrationRequest(modReg.client, modReg.registrationLink, modReg.sessionNumber, modReg.menuId, regId)
+	currentResponse, err = doRegistrationRequest(modReg.client, modReg.registrationLink, modReg.sessionNumber, modReg.menuId, regId, modReg.nextButton)
 	if err != nil {
 		return nil, err
 	}
@@ -171,23 +257,30 @@ func (modReg *ModuleRegistration) Register() (*TanRequired, error) {
 	// only some modules require an exam registration, before the module registration can be completed
 	// for some modules the exam needs to be booked, after registering for the module
 	if onPage.OnSelectExamPage(currentDocument) {
-		rbCode, rbErr := getRBCode(currentDocument)
-		if rbErr != nil {
-			return nil, rbErr
+		rbCode, examMode, selectErr := modReg.selectExam(currentDocument)
+		if selectErr != nil {
+			return nil, selectErr
 		}
-		currentResponse, err = doExamRegistrationRequest(modReg.client, modReg.registrationLink, rbCode, modReg.sessionNumber, modReg.menuId, regId, modReg.ExamDate)
+		currentResponse, err = doExamRegistrationRequest(modReg.client, modReg.registrationLink, rbCode, modReg.sessionNumber, modReg.menuId, regId, examMode, nextButton(currentDocument))
 		if err != nil {
 			return nil, err
 		}
+		defer currentResponse.Body.Close()
 		currentDocument, err = goquery.NewDocumentFromReader(currentResponse.Body)
 		if err != nil {
 			return nil, err
 		}
 	}
 
+	// e.g. a fully booked event is reported on the page instead of completing the registration
+	err = checkForError(currentDocument)
+	if err != nil {
+		return nil, err
+	}
+
 	if onPage.OniTANPage(currentDocument) {
 		tan := modReg.getTanRequiredStruct(currentDocument)
-		return tan, nil
+		return completeTan(modReg.tanSettings, tan, nil)
 	}
 
 	return nil, nil
@@ -203,6 +296,6 @@ func createModuleRegistration(registrationLink string, sessionNumber string, cli
 		registrationLink: registrationLink,
 		sessionNumber:    sessionNumber,
 		client:           client,
-		menuId:           "000309",
+		menuId:           menuKeys[MenuModuleRegistration].fallback,
 	}
 }
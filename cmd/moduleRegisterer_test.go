@@ -8,6 +8,7 @@ import (
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 )
 
@@ -18,7 +19,7 @@ func TestGetRegistrationId(t *testing.T) {
 	}),
 	)
 
-	regId, err := getRegistrationId(&http.Client{}, fakeServer.URL)
+	regId, next, err := getRegistrationId(&http.Client{}, fakeServer.URL)
 
 	if err != nil {
 		t.Error(err)
@@ -26,6 +27,87 @@ func TestGetRegistrationId(t *testing.T) {
 	if regId != fakeRegistrationId {
 		t.Error(fmt.Sprintf("EXPECTED: %s, RECEIVED: %s", fakeRegistrationId, regId))
 	}
+	if next != " Weiter" {
+		t.Error(fmt.Sprintf("EXPECTED: %q, RECEIVED: %q", " Weiter", next))
+	}
+}
+
+func TestNextButton(t *testing.T) {
+	tests := []struct {
+		page string
+		want string
+	}{
+		// label of the button on the page is preferred
+		{`<html lang="de"><form><input type="submit" name="Next" value=" Fortfahren"></form></html>`, " Fortfahren"},
+		{`<html lang="de"><p>Anmeldung</p></html>`, " Weiter"},
+		{`<html lang="en"><p>Registration</p></html>`, " Next"},
+		// language could not be detected
+		{`<p>Anmeldung</p>`, " Weiter"},
+	}
+
+	for _, test := range tests {
+		doc, err := goquery.NewDocumentFromReader(strings.NewReader(test.page))
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := nextButton(doc)
+		if got != test.want {
+			t.Error(fmt.Sprintf("WANT: %q, GOT: %q", test.want, got))
+		}
+	}
+}
+
+func TestGetRegistrationIdNotOpen(t *testing.T) {
+	fakeServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`<p>no registration form</p>`))
+	}),
+	)
+	defer fakeServer.Close()
+
+	_, _, err := getRegistrationId(&http.Client{}, fakeServer.URL)
+
+	if err != ErrRegistrationNotOpen {
+		t.Error(fmt.Sprintf("EXPECTED: %s, RECEIVED: %s", ErrRegistrationNotOpen, err))
+	}
+}
+
+func TestPrepare(t *testing.T) {
+	var requestCounter int
+	fakeRegistrationId := "2132134"
+
+	fakeServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestCounter++
+		if r.Method == http.MethodGet {
+			w.Write([]byte(`<input name="rgtr_id" value="` + fakeRegistrationId + `"/>`))
+			return
+		}
+
+		err := r.ParseForm()
+		if err != nil {
+			t.Errorf("ERROR: %s", err)
+		}
+		if r.Form.Get("rgtr_id") != fakeRegistrationId {
+			t.Error(fmt.Sprintf("expected prepared registration id %s, received %s", fakeRegistrationId, r.Form.Get("rgtr_id")))
+		}
+	}),
+	)
+	defer fakeServer.Close()
+
+	modReg := createModuleRegistration(fakeServer.URL, "342424", &http.Client{})
+	err := modReg.Prepare()
+	if err != nil {
+		t.Errorf(err.Error())
+	}
+
+	_, err = modReg.Register()
+	if err != nil {
+		t.Errorf(err.Error())
+	}
+
+	// registration form should not be fetched a second time
+	if requestCounter != 2 {
+		t.Error(fmt.Sprintf("expected 2 requests, however received %d", requestCounter))
+	}
 }
 
 func TestGetRbCode(t *testing.T) {
@@ -73,7 +155,7 @@ func TestDoExamRegistrationRequest(t *testing.T) {
 	)
 	defer formRequestMock.Close()
 
-	_, err := doExamRegistrationRequest(&http.Client{}, formRequestMock.URL, "RBCODE23244", "222", "333", "444", 1)
+	_, err := doExamRegistrationRequest(&http.Client{}, formRequestMock.URL, "RBCODE23244", "222", "333", "444", getExamMode(SecondExamDate), " Next")
 
 	if err != nil {
 		t.Errorf(err.Error())
@@ -95,21 +177,21 @@ func TestSetExamDate(t *testing.T) {
 		t.Error("default value for examDate should be 0")
 	}
 
-	moduleReg.SetExamDate(1)
+	err := moduleReg.SetExamDate(SecondExamDate)
 
-	if moduleReg.ExamDate != 1 {
+	if moduleReg.ExamDate != 1 || err != nil {
 		t.Error("unable to change exam date")
 	}
 
-	moduleReg.SetExamDate(3)
+	err = moduleReg.SetExamDate(3)
 
-	if moduleReg.ExamDate == 3 {
+	if moduleReg.ExamDate == 3 || err != ErrInvalidExamDate {
 		t.Error("able to pass invalid arguments (>2)")
 	}
 
-	moduleReg.SetExamDate(-1)
+	err = moduleReg.SetExamDate(-1)
 
-	if moduleReg.ExamDate == -1 {
+	if moduleReg.ExamDate == -1 || err != ErrInvalidExamDate {
 		t.Error("able to pass invalid arguments (<0)")
 	}
 }
@@ -139,7 +221,7 @@ func TestDoRegistrationRequest(t *testing.T) {
 	reg := createModuleRegistration("https://stine.uni-hamburg.de/", "232323", &http.Client{})
 	reg.menuId = menuId
 	reg.registrationId = rgtrId
-	res, err := doRegistrationRequest(&http.Client{}, fakeServer.URL, sessionNo, menuId, rgtrId)
+	res, err := doRegistrationRequest(&http.Client{}, fakeServer.URL, sessionNo, menuId, rgtrId, " Weiter")
 	defer res.Body.Close()
 
 	if err != nil {
@@ -0,0 +1,89 @@
+package stineapi
+
+import (
+	"fmt"
+	"github.com/martenmatrix/stine-api/cmd/internal/campusnet"
+	"strings"
+)
+
+// CrawlError represents a category, which could not be fetched during a partial crawl.
+type CrawlError struct {
+	Path     []string // Titles of the categories leading to the failed category, including its own title
+	Category Category // The failed category, only containing its id, title and url, can be fetched again with Refresh
+	Err      error    // Error the category failed with
+}
+
+func (crawlErr CrawlError) Error() string {
+	return fmt.Sprintf("unable to crawl %s: %s", strings.Join(crawlErr.Path, " > "), crawlErr.Err)
+}
+
+func (crawlErr CrawlError) Unwrap() error {
+	return crawlErr.Err
+}
+
+// partialCrawl collects the categories, which could not be fetched during a crawl
+type partialCrawl struct {
+	path   []string      // titles of the categories leading to the current category
+	errors *[]CrawlError // shared by all categories of the crawl
+}
+
+func newPartialCrawl() *partialCrawl {
+	return &partialCrawl{
+		errors: &[]CrawlError{},
+	}
+}
+
+// child returns the partial crawl of a child category of the current category, nil if the crawl is not partial
+func (partial *partialCrawl) child(title string) *partialCrawl {
+	if partial == nil {
+		return nil
+	}
+	return &partialCrawl{
+		path:   append(append([]string{}, partial.path...), title),
+		errors: partial.errors,
+	}
+}
+
+// failed records a child category of the current category, which could not be fetched
+func (partial *partialCrawl) failed(category Category, err error) {
+	*partial.errors = append(*partial.errors, CrawlError{
+		Path:     append(append([]string{}, partial.path...), category.Title),
+		Category: category,
+		Err:      err,
+	})
+}
+
+/*
+GetCategoriesPartial works like GetCategories, but categories, which cannot be fetched, do not abort the crawl.
+They are listed without their content in the returned category and in the returned errors instead.
+An error is only returned, if the initial page cannot be fetched.
+
+Transient errors are retried according to the [RetryPolicy] set with SetRetryPolicy, before a category is counted as failed.
+*/
+func (session *Session) GetCategoriesPartial(depth int) (Category, []CrawlError, error) {
+	registrationURL := campusnet.Request{PrgName: "REGISTRATION", SessionNo: session.SessionNo, MenuId: session.menu.menuId(MenuModuleRegistration)}.URL()
+	partial := newPartialCrawl()
+	initialCategory, err := getAvailableModules(depth, registrationURL, session.Client, session.cacheSettings(), partial)
+	if err != nil {
+		return Category{}, nil, err
+	}
+
+	return initialCategory, *partial.errors, nil
+}
+
+/*
+RefreshPartial works like Refresh, but child categories, which cannot be fetched, do not abort the refresh.
+They are listed without their content in the returned category and in the returned errors instead.
+*/
+func (category *Category) RefreshPartial(depth int) (Category, []CrawlError, error) {
+	if category.clientUsed == nil {
+		return Category{}, nil, ErrNotAttached
+	}
+
+	partial := newPartialCrawl()
+	refreshed, err := crawl(category.clientUsed, category.cacheUsed, category.Title, category.Url, depth, true, partial)
+	if err != nil {
+		return Category{}, nil, err
+	}
+	return refreshed, *partial.errors, nil
+}
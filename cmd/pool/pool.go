@@ -0,0 +1,319 @@
+/*
+Package pool manages the sessions of multiple STiNE accounts e.g. of several tutors.
+
+Sessions are logged in the first time they are used and kept alive afterwards. Operations can be run across
+all accounts with a bounded number of concurrent operations, a failing account does not affect the others.
+*/
+package pool
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/martenmatrix/stine-api/cmd"
+	"log"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ErrUnknownAccount is returned, if an operation is run for a username, which was not added to the [Pool].
+var ErrUnknownAccount = errors.New("the account was not added to the pool")
+
+// Result represents the outcome of an operation run for a single account.
+type Result struct {
+	Username string
+	Err      error // Error returned by the operation or the login, nil if successful
+}
+
+// account is a STiNE account of the pool
+type account struct {
+	username string
+	provider stineapi.CredentialProvider // asked for the credentials on every login
+	session  *stineapi.Session           // nil, until the account is used for the first time
+	loggedIn bool
+	loginErr error      // error of the last failed login, nil after a successful one
+	failures int        // consecutive failed logins
+	retryAt  time.Time  // no login is attempted before
+	used     string     // hash of the credentials last returned by the provider
+	rejected string     // hash of the credentials STiNE rejected, empty if the last login was not rejected
+	mu       sync.Mutex // only a single operation uses the session at a time
+}
+
+// credentialsHash returns a hash of the credentials, so rejected passwords are not kept in memory
+func credentialsHash(credentials stineapi.Credentials) string {
+	hash := sha256.Sum256([]byte(credentials.Username + "\x00" + credentials.Password))
+	return hex.EncodeToString(hash[:])
+}
+
+// Lookup looks up the credentials with the provider of the account and remembers, which credentials were used for the login
+func (acc *account) Lookup(username string) (stineapi.Credentials, error) {
+	credentials, err := acc.provider.Lookup(username)
+	if err == nil {
+		acc.used = credentialsHash(credentials)
+	}
+	return credentials, err
+}
+
+/*
+Pool holds a [stineapi.Session] for every added account.
+The exported fields can be changed before the first operation is run.
+*/
+type Pool struct {
+	MaxConcurrency int                     // Maximum number of operations running at the same time, 0 for no limit, defaults to 4
+	KeepAlive      time.Duration           // Interval the sessions are kept alive in by Run, defaults to 5 minutes
+	NewSession     func() stineapi.Session // Creates the sessions of the accounts e.g. to set a shared limiter, defaults to stineapi.NewSession
+	LoginBackoff   time.Duration           // Time no login is attempted after a failed one, doubles with every further one, defaults to 1 minute
+	MaxBackoff     time.Duration           // Maximum time no login is attempted after a failed one, defaults to 30 minutes
+	accounts       map[string]*account
+	mu             sync.Mutex
+}
+
+// New creates a new empty [Pool].
+func New() *Pool {
+	return &Pool{
+		MaxConcurrency: 4,
+		KeepAlive:      5 * time.Minute,
+		NewSession:     stineapi.NewSession,
+		LoginBackoff:   time.Minute,
+		MaxBackoff:     30 * time.Minute,
+		accounts:       map[string]*account{},
+	}
+}
+
+/*
+Add adds an account to the pool, it is logged in the first time it is used. An account with the same username is replaced,
+which forgets its failed logins.
+*/
+func (pool *Pool) Add(username string, password string) {
+	pool.AddProvider(username, stineapi.Credentials{Username: username, Password: password})
+}
+
+/*
+AddProvider adds an account, whose credentials are looked up with the provider on every login, including the logins
+after the session expired. An account with the same username is replaced.
+*/
+func (pool *Pool) AddProvider(username string, provider stineapi.CredentialProvider) {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+
+	pool.accounts[username] = &account{
+		username: username,
+		provider: provider,
+	}
+}
+
+// Remove removes the account with the username from the pool, running operations of the account are completed.
+func (pool *Pool) Remove(username string) {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+
+	delete(pool.accounts, username)
+}
+
+// Usernames returns the usernames of every account in the pool in alphabetical order.
+func (pool *Pool) Usernames() []string {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+
+	var usernames []string
+	for username := range pool.accounts {
+		usernames = append(usernames, username)
+	}
+	sort.Strings(usernames)
+	return usernames
+}
+
+// account returns the account with the username
+func (pool *Pool) account(username string) (*account, error) {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+
+	acc, exists := pool.accounts[username]
+	if !exists {
+		return nil, ErrUnknownAccount
+	}
+	return acc, nil
+}
+
+/*
+login logs the account in with a new session, if it is not logged in yet, the account needs to be locked.
+After a failed login, its error is returned without contacting STiNE until the backoff is over, so the account is not locked by
+repeated attempts. Rejected credentials and locked accounts are only attempted again, once the provider returns different credentials.
+*/
+func (pool *Pool) login(acc *account) error {
+	if acc.loggedIn {
+		return nil
+	}
+	if acc.loginErr != nil && time.Now().Before(acc.retryAt) {
+		return acc.loginErr
+	}
+	if acc.rejected != "" {
+		credentials, err := acc.provider.Lookup(acc.username)
+		if err != nil {
+			return err
+		}
+		// another attempt with the same credentials would be rejected as well or lock the account
+		if credentialsHash(credentials) == acc.rejected {
+			return acc.loginErr
+		}
+	}
+
+	session := pool.NewSession()
+	err := session.LoginWithProvider(acc, acc.username)
+	if err != nil {
+		pool.loginFailed(acc, err)
+		return err
+	}
+	acc.session = &session
+	acc.loggedIn = true
+	acc.loginErr = nil
+	acc.failures = 0
+	acc.rejected = ""
+	return nil
+}
+
+// loginFailed remembers the failed login of the account and when the next login may be attempted
+func (pool *Pool) loginFailed(acc *account, err error) {
+	acc.loginErr = err
+	acc.failures++
+
+	acc.rejected = ""
+	if errors.Is(err, stineapi.ErrWrongCredentials) || errors.Is(err, stineapi.ErrAccountLocked) {
+		acc.rejected = acc.used
+	}
+
+	backoff := pool.LoginBackoff
+	for i := 1; i < acc.failures && backoff < pool.MaxBackoff; i++ {
+		backoff *= 2
+	}
+	if pool.MaxBackoff > 0 && backoff > pool.MaxBackoff {
+		backoff = pool.MaxBackoff
+	}
+	acc.retryAt = time.Now().Add(backoff)
+}
+
+/*
+With runs the operation with the session of the account, which is logged in first, if required.
+Operations of the same account never run at the same time, the session must not be used after the operation returned.
+*/
+func (pool *Pool) With(username string, operation func(session *stineapi.Session) error) error {
+	acc, err := pool.account(username)
+	if err != nil {
+		return err
+	}
+
+	acc.mu.Lock()
+	defer acc.mu.Unlock()
+
+	err = pool.login(acc)
+	if err != nil {
+		return err
+	}
+	return run(acc, operation)
+}
+
+// run executes the operation, a panic is returned as an error, so it does not affect other accounts
+func run(acc *account, operation func(session *stineapi.Session) error) (err error) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			err = errors.New(fmt.Sprintf("operation for %s panicked: %v", acc.username, recovered))
+		}
+	}()
+
+	return operation(acc.session)
+}
+
+/*
+Do runs the operation for the accounts with the usernames or for every account, if no usernames are passed.
+At most MaxConcurrency operations run at the same time. A result is returned for every account in the order of the usernames,
+accounts, whose operation did not start before the context was cancelled, contain the error of the context.
+*/
+func (pool *Pool) Do(ctx context.Context, operation func(username string, session *stineapi.Session) error, usernames ...string) []Result {
+	if len(usernames) == 0 {
+		usernames = pool.Usernames()
+	}
+
+	var slots chan struct{}
+	if pool.MaxConcurrency > 0 {
+		slots = make(chan struct{}, pool.MaxConcurrency)
+	}
+
+	results := make([]Result, len(usernames))
+	var wg sync.WaitGroup
+	for i, username := range usernames {
+		results[i].Username = username
+
+		if slots != nil {
+			select {
+			case <-ctx.Done():
+				results[i].Err = ctx.Err()
+				continue
+			case slots <- struct{}{}:
+			}
+		}
+
+		wg.Add(1)
+		go func(i int, username string) {
+			defer wg.Done()
+			if slots != nil {
+				defer func() { <-slots }()
+			}
+
+			if ctx.Err() != nil {
+				results[i].Err = ctx.Err()
+				return
+			}
+			results[i].Err = pool.With(username, func(session *stineapi.Session) error {
+				return operation(username, session)
+			})
+		}(i, username)
+	}
+	wg.Wait()
+
+	return results
+}
+
+// keepAlive checks every logged in session, expired sessions are logged in again the next time they are used
+func (pool *Pool) keepAlive() {
+	pool.mu.Lock()
+	var accounts []*account
+	for _, acc := range pool.accounts {
+		accounts = append(accounts, acc)
+	}
+	pool.mu.Unlock()
+
+	for _, acc := range accounts {
+		acc.mu.Lock()
+		if acc.loggedIn {
+			alive, err := acc.session.Alive()
+			if err != nil {
+				log.Println("Unable to keep the session of", acc.username, "alive:", err)
+			}
+			if err == nil && !alive {
+				acc.loggedIn = false
+			}
+		}
+		acc.mu.Unlock()
+	}
+}
+
+/*
+Run keeps the logged in sessions alive every KeepAlive until the context is cancelled, which is returned as the error.
+Sessions, which expired anyway, are logged in again the next time they are used.
+*/
+func (pool *Pool) Run(ctx context.Context) error {
+	ticker := time.NewTicker(pool.KeepAlive)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+			pool.keepAlive()
+		}
+	}
+}
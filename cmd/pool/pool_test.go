@@ -0,0 +1,256 @@
+package pool
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/martenmatrix/stine-api/cmd"
+	"github.com/martenmatrix/stine-api/cmd/stinetest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newPool(server *stinetest.Server) *Pool {
+	pool := New()
+	pool.NewSession = func() stineapi.Session {
+		session := stineapi.NewSession()
+		session.Client = server.Client()
+		return session
+	}
+	return pool
+}
+
+func TestDo(t *testing.T) {
+	server := stinetest.NewServer(stinetest.Config{Username: "BBB1234", Password: "password"})
+	defer server.Close()
+
+	pool := newPool(server)
+	pool.Add("BBB1234", "password")
+	pool.Add("BBB9999", "wrong password")
+	pool.Add("BBB5678", "password")
+
+	var mu sync.Mutex
+	sessionNos := map[string]string{}
+	results := pool.Do(context.Background(), func(username string, session *stineapi.Session) error {
+		mu.Lock()
+		sessionNos[username] = session.SessionNo
+		mu.Unlock()
+		return nil
+	})
+
+	// the fake server only accepts BBB1234, the other accounts fail without affecting it
+	if len(results) != 3 || results[0].Username != "BBB1234" || results[0].Err != nil {
+		t.Fatal(fmt.Sprintf("operation should succeed for BBB1234, received: %+v", results))
+	}
+	if results[1].Err == nil || results[2].Err == nil || len(sessionNos) != 1 {
+		t.Error(fmt.Sprintf("accounts with wrong credentials should fail, received: %+v", results))
+	}
+
+	// the session is reused, if it is still logged in
+	var sessionNo string
+	err := pool.With("BBB1234", func(session *stineapi.Session) error {
+		sessionNo = session.SessionNo
+		return nil
+	})
+	if err != nil || sessionNo != sessionNos["BBB1234"] {
+		t.Error(fmt.Sprintf("WANT: session %s, GOT: %s, %v", sessionNos["BBB1234"], sessionNo, err))
+	}
+
+	if err := pool.With("unknown", func(session *stineapi.Session) error { return nil }); !errors.Is(err, ErrUnknownAccount) {
+		t.Error(fmt.Sprintf("WANT: %s, GOT: %v", ErrUnknownAccount, err))
+	}
+}
+
+func TestDoIsolatesFailures(t *testing.T) {
+	server := stinetest.NewServer(stinetest.Config{Username: "BBB1234", Password: "password"})
+	defer server.Close()
+
+	pool := newPool(server)
+	pool.MaxConcurrency = 1
+	pool.Add("BBB1234", "password")
+
+	operationErr := errors.New("registration failed")
+	results := pool.Do(context.Background(), func(username string, session *stineapi.Session) error {
+		panic("unexpected page")
+	})
+	if results[0].Err == nil {
+		t.Error("panicking operation should be returned as an error")
+	}
+
+	results = pool.Do(context.Background(), func(username string, session *stineapi.Session) error {
+		return operationErr
+	})
+	if !errors.Is(results[0].Err, operationErr) {
+		t.Error(fmt.Sprintf("WANT: %s, GOT: %v", operationErr, results[0].Err))
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	results = pool.Do(ctx, func(username string, session *stineapi.Session) error { return nil })
+	if !errors.Is(results[0].Err, context.Canceled) {
+		t.Error(fmt.Sprintf("WANT: %s, GOT: %v", context.Canceled, results[0].Err))
+	}
+}
+
+func TestMaxConcurrency(t *testing.T) {
+	pool := New()
+	pool.MaxConcurrency = 2
+	for _, username := range []string{"a", "b", "c", "d", "e"} {
+		pool.Add(username, "")
+		// accounts are already logged in, so the fake operation does not need a server
+		pool.accounts[username].loggedIn = true
+		pool.accounts[username].session = &stineapi.Session{}
+	}
+
+	var mu sync.Mutex
+	var running, maxRunning int
+	pool.Do(context.Background(), func(username string, session *stineapi.Session) error {
+		mu.Lock()
+		running++
+		if running > maxRunning {
+			maxRunning = running
+		}
+		mu.Unlock()
+
+		time.Sleep(20 * time.Millisecond)
+
+		mu.Lock()
+		running--
+		mu.Unlock()
+		return nil
+	})
+
+	if maxRunning != 2 {
+		t.Error(fmt.Sprintf("WANT: 2 operations at the same time, GOT: %d", maxRunning))
+	}
+}
+
+func TestKeepAlive(t *testing.T) {
+	server := stinetest.NewServer(stinetest.Config{Username: "BBB1234", Password: "password"})
+	defer server.Close()
+
+	pool := newPool(server)
+	pool.Add("BBB1234", "password")
+
+	var sessionNos []string
+	record := func(session *stineapi.Session) error {
+		sessionNos = append(sessionNos, session.SessionNo)
+		return nil
+	}
+	if err := pool.With("BBB1234", record); err != nil {
+		t.Fatal(err)
+	}
+
+	pool.keepAlive()
+	if err := pool.With("BBB1234", record); err != nil {
+		t.Fatal(err)
+	}
+
+	// an expired session is logged in again the next time it is used
+	server.ExpireSessions()
+	pool.keepAlive()
+	if err := pool.With("BBB1234", record); err != nil {
+		t.Fatal(err)
+	}
+
+	if sessionNos[0] != sessionNos[1] || sessionNos[1] == sessionNos[2] {
+		t.Error(fmt.Sprintf("expired session should be replaced, alive one kept, GOT: %v", sessionNos))
+	}
+}
+
+// countingProvider counts, how often the credentials were looked up for a login
+type countingProvider struct {
+	credentials stineapi.Credentials
+	lookups     int
+}
+
+func (provider *countingProvider) Lookup(username string) (stineapi.Credentials, error) {
+	provider.lookups++
+	return provider.credentials, nil
+}
+
+func TestFailedLoginIsRemembered(t *testing.T) {
+	server := stinetest.NewServer(stinetest.Config{Username: "BBB1234", Password: "password"})
+	defer server.Close()
+
+	pool := newPool(server)
+	wrongPassword := &countingProvider{credentials: stineapi.Credentials{Username: "BBB1234", Password: "wrong password"}}
+	pool.AddProvider("BBB1234", wrongPassword)
+
+	noop := func(session *stineapi.Session) error { return nil }
+	for i := 0; i < 3; i++ {
+		if err := pool.With("BBB1234", noop); !errors.Is(err, stineapi.ErrWrongCredentials) {
+			t.Error(fmt.Sprintf("WANT: %s, GOT: %v", stineapi.ErrWrongCredentials, err))
+		}
+	}
+	// rejected credentials are not sent again, so the account is not locked
+	if wrongPassword.lookups != 1 {
+		t.Error(fmt.Sprintf("WANT: 1 login, GOT: %d", wrongPassword.lookups))
+	}
+
+	// adding the account again forgets the failed login
+	pool.Add("BBB1234", "password")
+	if err := pool.With("BBB1234", noop); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestLoginBackoff(t *testing.T) {
+	server := stinetest.NewServer(stinetest.Config{Username: "BBB1234", Password: "password"})
+	defer server.Close()
+
+	pool := newPool(server)
+	pool.LoginBackoff = 30 * time.Millisecond
+	provider := &countingProvider{credentials: stineapi.Credentials{Username: "BBB1234", Password: "password"}}
+	pool.AddProvider("BBB1234", provider)
+
+	// stine is unreachable during the first login
+	loginErr := errors.New("connection refused")
+	pool.loginFailed(pool.accounts["BBB1234"], loginErr)
+
+	noop := func(session *stineapi.Session) error { return nil }
+	if err := pool.With("BBB1234", noop); err != loginErr {
+		t.Error(fmt.Sprintf("WANT: %s, GOT: %v", loginErr, err))
+	}
+	if provider.lookups != 0 {
+		t.Error("login should not be attempted during the backoff")
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	if err := pool.With("BBB1234", noop); err != nil {
+		t.Error(err)
+	}
+	if provider.lookups != 1 {
+		t.Error(fmt.Sprintf("WANT: 1 login after the backoff, GOT: %d", provider.lookups))
+	}
+}
+
+func TestChangedPasswordIsRetried(t *testing.T) {
+	server := stinetest.NewServer(stinetest.Config{Username: "BBB1234", Password: "password"})
+	defer server.Close()
+
+	pool := newPool(server)
+	pool.LoginBackoff = 30 * time.Millisecond
+	provider := &countingProvider{credentials: stineapi.Credentials{Username: "BBB1234", Password: "wrong password"}}
+	pool.AddProvider("BBB1234", provider)
+
+	noop := func(session *stineapi.Session) error { return nil }
+	if err := pool.With("BBB1234", noop); !errors.Is(err, stineapi.ErrWrongCredentials) {
+		t.Error(fmt.Sprintf("WANT: %s, GOT: %v", stineapi.ErrWrongCredentials, err))
+	}
+
+	// the unchanged password is looked up after the backoff, but not sent again
+	time.Sleep(30 * time.Millisecond)
+	if err := pool.With("BBB1234", noop); !errors.Is(err, stineapi.ErrWrongCredentials) {
+		t.Error(fmt.Sprintf("WANT: %s, GOT: %v", stineapi.ErrWrongCredentials, err))
+	}
+	if provider.lookups != 2 {
+		t.Error(fmt.Sprintf("WANT: 2 lookups without a second login, GOT: %d", provider.lookups))
+	}
+
+	provider.credentials.Password = "password"
+	if err := pool.With("BBB1234", noop); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,127 @@
+package stineapi
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"time"
+)
+
+/*
+RetryPolicy configures, how often requests are sent again after transient errors. Only GET and HEAD requests are sent again,
+every POST request of STiNE changes a registration, the language or the login and is never sent twice.
+
+If a [Limiter] is set on the session, 503 and 429 responses are only sent again by the limiter.
+*/
+type RetryPolicy struct {
+	MaxAttempts  int                                      // Maximum number of attempts including the first one
+	InitialDelay time.Duration                            // Delay before the second attempt, doubles with every further attempt
+	MaxDelay     time.Duration                            // Maximum delay between two attempts
+	Retryable    func(res *http.Response, err error) bool // Decides, if the request is sent again, defaults to network errors and 5xx responses outside of maintenances
+}
+
+// DefaultRetryPolicy returns a [RetryPolicy] with 3 attempts, which are 1 and 2 seconds apart.
+func DefaultRetryPolicy() *RetryPolicy {
+	return &RetryPolicy{
+		MaxAttempts:  3,
+		InitialDelay: time.Second,
+		MaxDelay:     30 * time.Second,
+	}
+}
+
+// retryable checks, if a request should be sent again after the response or error
+func (policy *RetryPolicy) retryable(res *http.Response, err error) bool {
+	if policy.Retryable != nil {
+		return policy.Retryable(res, err)
+	}
+	if err != nil {
+		// retries during a maintenance would fail as well
+		return !errors.Is(err, ErrMaintenance)
+	}
+	return res.StatusCode >= 500
+}
+
+// isThrottled checks, if STiNE asked to slow down with the response
+func isThrottled(res *http.Response) bool {
+	return res != nil && (res.StatusCode == http.StatusServiceUnavailable || res.StatusCode == http.StatusTooManyRequests)
+}
+
+// delay returns the delay before the attempt, the first attempt is 0
+func (policy *RetryPolicy) delay(attempt int) time.Duration {
+	delay := policy.InitialDelay
+	for i := 1; i < attempt && delay < policy.MaxDelay; i++ {
+		delay *= 2
+	}
+	if policy.MaxDelay > 0 && delay > policy.MaxDelay {
+		delay = policy.MaxDelay
+	}
+	return delay
+}
+
+// isIdempotent checks, if the request can be sent multiple times without side effects
+func isIdempotent(req *http.Request) bool {
+	return req.Method == http.MethodGet || req.Method == http.MethodHead
+}
+
+// retryTransport is a round tripper, which sends idempotent requests again after transient errors
+type retryTransport struct {
+	base   http.RoundTripper // round tripper the requests are sent with, http.DefaultTransport if nil
+	policy *RetryPolicy
+}
+
+// RoundTrip sends the request and sends it again, if it failed with a transient error and is idempotent.
+func (transport *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := transport.base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	policy := transport.policy
+
+	// a limiter below already sends requests again after 503 and 429 responses with the pause STiNE asked for
+	_, limited := base.(*limitedTransport)
+
+	for attempt := 1; ; attempt++ {
+		res, err := base.RoundTrip(req)
+		if attempt >= policy.MaxAttempts || !isIdempotent(req) || !policy.retryable(res, err) {
+			return res, err
+		}
+		if limited && isThrottled(res) {
+			return res, err
+		}
+		if res != nil {
+			io.Copy(io.Discard, res.Body)
+			res.Body.Close()
+		}
+
+		sleepErr := sleep(req.Context(), policy.delay(attempt))
+		if sleepErr != nil {
+			return nil, sleepErr
+		}
+
+		req = req.Clone(req.Context())
+	}
+}
+
+/*
+SetRetryPolicy sets the policy, after which idempotent requests of the session are sent again after transient errors.
+It should be set before the first request is sent. A nil policy disables retries.
+*/
+func (session *Session) SetRetryPolicy(policy *RetryPolicy) {
+	// the retries are placed below the language guard, so the requests restoring the language are sent again as well
+	transport := &session.Client.Transport
+	if guard, isGuard := (*transport).(*languageGuard); isGuard {
+		transport = &guard.base
+	}
+
+	if retrying, isRetrying := (*transport).(*retryTransport); isRetrying {
+		if policy == nil {
+			*transport = retrying.base
+			return
+		}
+		retrying.policy = policy
+		return
+	}
+	if policy != nil {
+		*transport = &retryTransport{base: *transport, policy: policy}
+	}
+}
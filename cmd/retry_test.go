@@ -0,0 +1,131 @@
+package stineapi
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func retryingSession() Session {
+	session := Session{Client: &http.Client{}}
+	session.SetRetryPolicy(&RetryPolicy{MaxAttempts: 3, InitialDelay: time.Millisecond, MaxDelay: 5 * time.Millisecond})
+	return session
+}
+
+// newFlakyServer responds with 500 to the first failures requests of every path and method
+func newFlakyServer(t *testing.T, failures int) (*httptest.Server, map[string]int) {
+	requests := map[string]int{}
+	var mu sync.Mutex
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		key := r.Method + " " + r.URL.Path
+		requests[key]++
+		count := requests[key]
+		mu.Unlock()
+
+		if count <= failures {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Write([]byte("<html></html>"))
+	}))
+	t.Cleanup(server.Close)
+
+	return server, requests
+}
+
+func TestRetryPolicy(t *testing.T) {
+	server, requests := newFlakyServer(t, 2)
+	session := retryingSession()
+
+	res, err := session.Client.Get(server.URL + "/get")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK || requests["GET /get"] != 3 {
+		t.Error(fmt.Sprintf("GET request should succeed on the third attempt, GOT: status %d after %d attempts", res.StatusCode, requests["GET /get"]))
+	}
+
+	// registrations are never sent twice
+	res, err = session.Client.Post(server.URL+"/register", "application/x-www-form-urlencoded", strings.NewReader("a=b"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusInternalServerError || requests["POST /register"] != 1 {
+		t.Error(fmt.Sprintf("POST request should not be sent again, GOT: status %d after %d attempts", res.StatusCode, requests["POST /register"]))
+	}
+}
+
+func TestRetryPolicyGivesUp(t *testing.T) {
+	server, requests := newFlakyServer(t, 5)
+	session := retryingSession()
+
+	res, err := session.Client.Get(server.URL + "/get")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusInternalServerError || requests["GET /get"] != 3 {
+		t.Error(fmt.Sprintf("WANT: 3 attempts, GOT: %d", requests["GET /get"]))
+	}
+
+	// removing the policy disables retries
+	session.SetRetryPolicy(nil)
+	res, err = session.Client.Get(server.URL + "/single")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if requests["GET /single"] != 1 {
+		t.Error(fmt.Sprintf("WANT: 1 attempt, GOT: %d", requests["GET /single"]))
+	}
+}
+
+func TestPartialCrawl(t *testing.T) {
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/initial":
+			fmt.Fprintf(w, `<ul><li><a href="%[1]s/informatics">Informatics</a></li><li><a href="%[1]s/broken">Broken</a></li></ul>`, server.URL)
+		case "/informatics":
+			fmt.Fprintf(w, `<ul><li><a href="%s/missing">Electives</a></li></ul>`, server.URL)
+		case "/broken", "/missing":
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer server.Close()
+
+	_, err := getAvailableModules(2, server.URL+"/initial", &http.Client{}, nil, nil)
+	if err == nil {
+		t.Error("failed category should abort the crawl")
+	}
+
+	partial := newPartialCrawl()
+	crawled, err := getAvailableModules(2, server.URL+"/initial", &http.Client{}, nil, partial)
+	if err != nil {
+		t.Fatal(err)
+	}
+	crawlErrors := *partial.errors
+
+	var paths []string
+	for _, crawlErr := range crawlErrors {
+		paths = append(paths, strings.Join(crawlErr.Path, " > "))
+	}
+	if strings.Join(paths, ", ") != "Informatics > Electives, Broken" {
+		t.Error(fmt.Sprintf("WANT: Informatics > Electives, Broken, GOT: %s", strings.Join(paths, ", ")))
+	}
+	if len(crawled.Categories) != 2 || crawled.Categories[1].Url != server.URL+"/broken" || len(crawled.Categories[0].Categories) != 1 {
+		t.Error(fmt.Sprintf("failed categories should be kept in the tree, received: %+v", crawled))
+	}
+
+	if crawlErrors[1].Category.Url != server.URL+"/broken" || !strings.Contains(crawlErrors[1].Error(), "status 500") {
+		t.Error(fmt.Sprintf("crawl error does not contain the failed category: %+v", crawlErrors[1]))
+	}
+}
@@ -0,0 +1,42 @@
+package scheduler
+
+import (
+	"errors"
+	"net/http"
+	"time"
+)
+
+// MeasureSkew estimates how far the clock of the server at url is ahead of the local clock, by reading the Date header of its response.
+// A negative value means the server clock is behind the local clock.
+func MeasureSkew(client *http.Client, url string) (time.Duration, error) {
+	start := time.Now()
+	res, err := client.Head(url)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+	end := time.Now()
+
+	dateHeader := res.Header.Get("Date")
+	if dateHeader == "" {
+		return 0, errors.New("server did not send a date header, unable to measure clock skew")
+	}
+	serverTime, err := http.ParseTime(dateHeader)
+	if err != nil {
+		return 0, err
+	}
+
+	// the date header is truncated to seconds, on average the server time is half a second later
+	serverTime = serverTime.Add(500 * time.Millisecond)
+	// assume the server created the date header in the middle of the round trip
+	localTime := start.Add(end.Sub(start) / 2)
+
+	return serverTime.Sub(localTime), nil
+}
+
+// sleepUntil blocks until the local clock reaches t
+func sleepUntil(t time.Time) {
+	if wait := time.Until(t); wait > 0 {
+		time.Sleep(wait)
+	}
+}
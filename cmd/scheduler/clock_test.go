@@ -0,0 +1,25 @@
+package scheduler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestMeasureSkew(t *testing.T) {
+	fakeServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// server clock is one hour ahead
+		w.Header().Set("Date", time.Now().Add(time.Hour).UTC().Format(http.TimeFormat))
+	}))
+	defer fakeServer.Close()
+
+	skew, err := MeasureSkew(&http.Client{}, fakeServer.URL)
+	if err != nil {
+		t.Errorf(err.Error())
+	}
+
+	if skew < time.Hour-time.Second || skew > time.Hour+time.Second {
+		t.Errorf("WANT: about 1h, GOT: %s", skew)
+	}
+}
@@ -0,0 +1,202 @@
+/*
+Package scheduler sends module registrations at the exact point in time a registration window on STiNE opens.
+
+The session is authenticated ahead of time and kept alive until the window opens, the registration forms are fetched in advance
+and the clock skew between the local machine and the STiNE servers is taken into account.
+*/
+package scheduler
+
+import (
+	"errors"
+	"github.com/martenmatrix/stine-api/cmd"
+	"github.com/martenmatrix/stine-api/cmd/internal/stineURL"
+	"log"
+	"sync"
+	"time"
+)
+
+// Registration represents a module registration, which should be sent as soon as the registration window opens.
+type Registration struct {
+	Module   stineapi.Module   // Module to register for, ideally retrieved with GetCategories
+	ExamDate stineapi.ExamDate // Exam date to select, see [stineapi.ModuleRegistration.SetExamDate]
+	At       time.Time         // Point in time the registration window opens, according to the STiNE servers
+}
+
+// Result represents the outcome of a scheduled [Registration].
+type Result struct {
+	Registration Registration
+	Tan          *stineapi.TanRequired // Not nil, if an iTAN is required to complete the registration
+	Attempts     int                   // Number of times the registration was sent
+	Err          error                 // Error, which occurred during the registration, nil if successful
+}
+
+/*
+Scheduler sends registrations at the point in time their registration window opens.
+The exported fields can be changed before calling Run.
+*/
+type Scheduler struct {
+	LoginAhead    time.Duration // How long before the first registration the session is authenticated, defaults to 5 minutes
+	KeepAlive     time.Duration // Interval the session is kept alive and the registration forms are re-fetched in, defaults to 1 minute
+	RetryInterval time.Duration // Interval a registration is re-sent in, if the registration window is not open yet, defaults to 200 milliseconds
+	RetryFor      time.Duration // How long after the registration window should have opened registrations are retried, defaults to 30 seconds
+	session       *stineapi.Session
+	username      string
+	password      string
+	clockURL      string        // url the clock skew is measured with
+	skew          time.Duration // how far the clock of the STiNE servers is ahead of the local clock
+	mu            sync.Mutex    // the session is logged in again by a single registration at a time
+}
+
+/*
+New creates a new [Scheduler], which sends registrations with the passed session.
+
+If the session is not authenticated yet, the username and password are used to log in before the first registration.
+If the session expires while waiting for a registration window, it is logged in again with them.
+A session logged in with LoginWithProvider is logged in again with its provider.
+*/
+func New(session *stineapi.Session, username string, password string) *Scheduler {
+	return &Scheduler{
+		LoginAhead:    5 * time.Minute,
+		KeepAlive:     time.Minute,
+		RetryInterval: 200 * time.Millisecond,
+		RetryFor:      30 * time.Second,
+		session:       session,
+		username:      username,
+		password:      password,
+		clockURL:      stineURL.Url,
+	}
+}
+
+// authenticates the session, if required, and measures the clock skew to the stine servers
+func (sched *Scheduler) prepareSession() error {
+	if sched.session.SessionNo == "" {
+		// the credentials are kept by the session, so it can be logged in again after it expired
+		credentials := stineapi.Credentials{Username: sched.username, Password: sched.password}
+		err := sched.session.LoginWithProvider(credentials, sched.username)
+		if err != nil {
+			return err
+		}
+	}
+
+	skew, err := MeasureSkew(sched.session.Client, sched.clockURL)
+	if err != nil {
+		log.Println("Unable to measure clock skew to the STiNE servers, assuming none:", err)
+		skew = 0
+	}
+	sched.skew = skew
+
+	return nil
+}
+
+// keepAlive logs the session in again, if it expired, and returns its current session number
+func (sched *Scheduler) keepAlive() (string, error) {
+	sched.mu.Lock()
+	defer sched.mu.Unlock()
+
+	_, err := sched.session.ReloginIfExpired()
+	return sched.session.SessionNo, err
+}
+
+// newRegistration creates the module registration with the current session number of the session, which is returned as well
+func (sched *Scheduler) newRegistration(registration Registration) (*stineapi.ModuleRegistration, string, error) {
+	sched.mu.Lock()
+	defer sched.mu.Unlock()
+
+	modReg := sched.session.RegisterForModule(registration.Module)
+	err := modReg.SetExamDate(registration.ExamDate)
+	return modReg, sched.session.SessionNo, err
+}
+
+// waits for the registration window to open and sends the registration, re-sends it until the window is open
+func (sched *Scheduler) register(registration Registration) Result {
+	result := Result{Registration: registration}
+
+	modReg, sessionNo, err := sched.newRegistration(registration)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+
+	// point in time the registration window opens according to the local clock
+	opensAt := registration.At.Add(-sched.skew)
+
+	// keeps the session alive and fetches the registration form in advance, if already available
+	for time.Until(opensAt) > sched.KeepAlive {
+		currentSessionNo, err := sched.keepAlive()
+		if err != nil {
+			log.Println("Unable to log in again:", err)
+		}
+		// the registration of the expired session would be rejected
+		if currentSessionNo != sessionNo {
+			modReg, sessionNo, err = sched.newRegistration(registration)
+			if err != nil {
+				result.Err = err
+				return result
+			}
+		}
+
+		err = modReg.Prepare()
+		if err != nil && !errors.Is(err, stineapi.ErrRegistrationNotOpen) {
+			log.Println("Unable to keep session alive:", err)
+		}
+		time.Sleep(sched.KeepAlive)
+	}
+
+	sleepUntil(opensAt)
+	retryUntil := opensAt.Add(sched.RetryFor)
+
+	for {
+		result.Attempts++
+		tanReq, err := modReg.Register()
+		if errors.Is(err, stineapi.ErrRegistrationNotOpen) && time.Now().Before(retryUntil) {
+			time.Sleep(sched.RetryInterval)
+			continue
+		}
+
+		result.Tan = tanReq
+		result.Err = err
+		return result
+	}
+}
+
+/*
+Run blocks until all passed registrations have been sent and returns their results in the order they were passed.
+
+The session is authenticated LoginAhead before the first registration window opens.
+Registrations, whose registration window opens at the same time, are sent concurrently.
+*/
+func (sched *Scheduler) Run(registrations []Registration) []Result {
+	results := make([]Result, len(registrations))
+	if len(registrations) == 0 {
+		return results
+	}
+
+	first := registrations[0].At
+	for _, registration := range registrations {
+		if registration.At.Before(first) {
+			first = registration.At
+		}
+	}
+
+	sleepUntil(first.Add(-sched.LoginAhead))
+	err := sched.prepareSession()
+	if err != nil {
+		for i, registration := range registrations {
+			results[i] = Result{Registration: registration, Err: err}
+		}
+		return results
+	}
+
+	// every registration waits for its own registration window
+	var wg sync.WaitGroup
+	for i := range registrations {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i] = sched.register(registrations[i])
+		}(i)
+	}
+	wg.Wait()
+
+	return results
+}
@@ -0,0 +1,131 @@
+package scheduler
+
+import (
+	"github.com/martenmatrix/stine-api/cmd"
+	"github.com/martenmatrix/stine-api/cmd/stinetest"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRun(t *testing.T) {
+	var mu sync.Mutex
+	var registrationRequests int
+	opensAt := time.Now().Add(300 * time.Millisecond)
+
+	fakeServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodHead:
+			// suppress date header, clock skew is not measured in this test
+			w.Header()["Date"] = nil
+		case http.MethodGet:
+			// registration form is only available, after the window opened
+			if time.Now().After(opensAt) {
+				w.Write([]byte(`<input name="rgtr_id" value="2132134"/>`))
+			}
+		case http.MethodPost:
+			mu.Lock()
+			registrationRequests++
+			mu.Unlock()
+			w.Write([]byte(`<html></html>`))
+		}
+	}))
+	defer fakeServer.Close()
+
+	session := stineapi.NewSession()
+	session.Client = &http.Client{}
+	session.SessionNo = "342424" // already authenticated
+
+	sched := New(&session, "", "")
+	sched.clockURL = fakeServer.URL
+	sched.KeepAlive = 100 * time.Millisecond
+	sched.RetryInterval = 20 * time.Millisecond
+	sched.RetryFor = 2 * time.Second
+
+	results := sched.Run([]Registration{{
+		Module: stineapi.Module{RegistrationLink: fakeServer.URL},
+		// window opens earlier than expected
+		At: opensAt.Add(-200 * time.Millisecond),
+	}})
+
+	if results[0].Err != nil {
+		t.Errorf(results[0].Err.Error())
+	}
+	if results[0].Attempts < 2 {
+		t.Errorf("registration should have been retried, as the window was not open yet, attempts: %d", results[0].Attempts)
+	}
+	if registrationRequests != 1 {
+		t.Errorf("expected exactly one registration request, received %d", registrationRequests)
+	}
+}
+
+func TestRunGivesUp(t *testing.T) {
+	fakeServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// registration window never opens
+		w.Header()["Date"] = nil
+	}))
+	defer fakeServer.Close()
+
+	session := stineapi.NewSession()
+	session.Client = &http.Client{}
+	session.SessionNo = "342424"
+
+	sched := New(&session, "", "")
+	sched.clockURL = fakeServer.URL
+	sched.RetryInterval = 10 * time.Millisecond
+	sched.RetryFor = 100 * time.Millisecond
+
+	results := sched.Run([]Registration{{
+		Module: stineapi.Module{RegistrationLink: fakeServer.URL},
+		At:     time.Now(),
+	}})
+
+	if results[0].Err != stineapi.ErrRegistrationNotOpen {
+		t.Errorf("WANT: %s, GOT: %s", stineapi.ErrRegistrationNotOpen, results[0].Err)
+	}
+}
+
+func TestRunLogsInAgain(t *testing.T) {
+	server := stinetest.NewServer(stinetest.Config{
+		Username: "BBB1234",
+		Password: "password",
+		Modules:  []stinetest.Module{{Title: "Software Development II", Events: []stinetest.Event{{Id: "64-010", Title: "Lecture"}}}},
+		Tan:      stinetest.TanConfig{Method: stinetest.IndexedTan, List: map[string]string{"054": "054233233"}},
+	})
+	defer server.Close()
+
+	browsing := stineapi.NewSession()
+	browsing.Client = server.Client()
+	if err := browsing.Login("BBB1234", "password"); err != nil {
+		t.Fatal(err)
+	}
+	category, err := browsing.GetCategories(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	session := stineapi.NewSession()
+	session.Client = server.Client()
+	sched := New(&session, "BBB1234", "password")
+	sched.KeepAlive = 50 * time.Millisecond
+
+	// the session expires, while the scheduler waits for the registration window
+	go func() {
+		time.Sleep(200 * time.Millisecond)
+		server.ExpireSessions()
+	}()
+	results := sched.Run([]Registration{{
+		Module: category.Modules[0],
+		// the clock skew is measured in seconds
+		At: time.Now().Add(1500 * time.Millisecond),
+	}})
+
+	if results[0].Err != nil {
+		t.Fatalf(results[0].Err.Error())
+	}
+	if results[0].Tan == nil {
+		t.Errorf("registration should have been sent with the new session and ask for an itan")
+	}
+}
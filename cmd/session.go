@@ -1,108 +1,154 @@
 package stineapi
 
 import (
-	"errors"
+	"github.com/PuerkitoBio/goquery"
 	"github.com/martenmatrix/stine-api/cmd/internal/auth"
-	"github.com/martenmatrix/stine-api/cmd/internal/language"
-	"github.com/martenmatrix/stine-api/cmd/internal/sessionNo"
-	"github.com/martenmatrix/stine-api/cmd/internal/stineURL"
+	"github.com/martenmatrix/stine-api/cmd/internal/campusnet"
+	"github.com/martenmatrix/stine-api/cmd/internal/userDataGetter"
+	"log"
 	"net/http"
-	"net/url"
+	"time"
 )
 
 // Session represent a STiNE session. Think of it like an isolated tab with STiNE open.
 type Session struct {
-	Client    *http.Client // Client is an HTTP client, which is authenticated on STiNE, if Login was successful
-	SessionNo string       // Identifier for the current session provided by STiNE, could be unique, empty string prior to successful Login
+	Client        *http.Client       // Client is an HTTP client, which is authenticated on STiNE, if Login was successful
+	SessionNo     string             // Identifier for the current session provided by STiNE, could be unique, empty string prior to successful Login
+	username      string             // username of the authenticated user
+	tanProvider   TanProvider        // provides itans for actions, which require one
+	tanAttempts   TanAttemptCounter  // counts failed itan attempts of the user
+	menu          Menu               // navigation of the authenticated user, empty if it could not be loaded
+	categoryCache *cacheSettings     // cache categories are read from, nil if categories are not cached
+	credentials   CredentialProvider // provides the credentials for Relogin, nil if the session was logged in with a password
+	lastUsed      time.Time          // last time the session was known to be authenticated
 }
 
-// NewSession creates a new [Session] and returns it.
+// NewSession creates a new [Session], which detects maintenance notices of STiNE, and returns it.
 func NewSession() Session {
-	return Session{
-		Client: auth.GetClient(),
+	session := Session{
+		Client:      auth.GetClient(),
+		tanAttempts: processTanAttempts,
 	}
+	session.SetMaintenanceDetection(true)
+	return session
 }
 
-// creates idsrv, idsrv.session and cnsc cookie in jar
-// the cnsc cookie needs to be added manually to the jar because the server sends it malformatted
-func (session *Session) makeSession(returnURL string, username string, password string, authToken string, authenticationFormURL string) error {
-	formQuery := url.Values{
-		"ReturnUrl":                  {returnURL},
-		"CancelUrl":                  {},
-		"Username":                   {username},
-		"Password":                   {password},
-		"RememberLogin":              {"true"},
-		"button":                     {"login"},
-		"__RequestVerificationToken": {authToken},
+// returns the settings used to enter itans for the authenticated user
+func (session *Session) tanSettings() tanSettings {
+	return tanSettings{
+		provider: session.tanProvider,
+		attempts: session.tanAttempts,
+		account:  session.username,
 	}
-	res, resErr := session.Client.PostForm(authenticationFormURL, formQuery)
-	if resErr != nil {
-		return resErr
-	}
-	defer res.Body.Close()
+}
 
-	if res.StatusCode != http.StatusOK {
-		return errors.New("authentication with username/password failed")
-	}
+/*
+Login authenticates a session on the STiNE website. If no error is returned, the user is logged in.
 
-	// cnsc cookie is returned malformatted, set manually on Client
-	cnscCookie, cookieErr := auth.GetMalformattedCnscCookie(res)
-	if cookieErr != nil {
-		return cookieErr
+Otherwise, a [LoginError] is returned, which wraps e.g. [ErrWrongCredentials], [ErrAccountLocked], [ErrPasswordExpired],
+[ErrTermsNotAccepted] or [ErrMaintenance], if STiNE displayed the corresponding page instead of logging the user in.
+*/
+func (session *Session) Login(username string, password string) error {
+	flow := loginFlow{
+		session:  session,
+		username: username,
+		password: password,
+	}
+	err := flow.run()
+	if err != nil {
+		return err
 	}
-	authUrl, authUrlErr := url.Parse(stineURL.Url + "/scripts")
-	if authUrlErr != nil {
-		return authUrlErr
+	session.username = username
+	session.lastUsed = time.Now()
+
+	// the language of a new session is the language stored for the user, restore the pinned one
+	if pinned := session.pinnedLanguage(); pinned != "" {
+		err := session.ChangeLanguage(pinned)
+		if err != nil {
+			return err
+		}
 	}
-	session.Client.Jar.SetCookies(authUrl, []*http.Cookie{cnscCookie})
 
-	// http library does not follow "Refresh"-Header, not in http specification
-	session.SessionNo = sessionNo.Get(res.Header.Get("Refresh"))
+	// entry points of features are looked up in the menu, default menu ids are used if it is unavailable
+	_, menuErr := session.Menu()
+	if menuErr != nil {
+		log.Println("Unable to load the menu, using default menu ids:", menuErr)
+	}
 
 	return nil
 }
 
 /*
-Login authenticates a session on the STiNE website. If no error is returned, the user is logged in.
+Menu loads the navigation of the authenticated user with the menu ids and program names of every entry.
+The entry points of the features of the session are looked up in the returned menu, see [Menu.Find].
+
+Login already loads the menu, calling Menu again is only required if the menu of the user changed.
 */
-func (session *Session) Login(username string, password string) error {
-	linkToAuthForm, linkToAuthFormErr := auth.GetLinkToAuthForm(auth.StartPage, session.Client)
-	if linkToAuthFormErr != nil {
-		return linkToAuthFormErr
+func (session *Session) Menu() (Menu, error) {
+	menu, err := session.fetchMenu()
+	if err != nil {
+		return Menu{}, err
 	}
 
-	// creates inital antiforgery cookie in jar
-	authFormRes, authFormResErr := session.Client.Get(linkToAuthForm)
-	if authFormResErr != nil {
-		return authFormResErr
+	session.menu = menu
+	return session.menu, nil
+}
+
+// fetchMenu loads the navigation from the start page of the session
+func (session *Session) fetchMenu() (Menu, error) {
+	startPage := campusnet.Request{PrgName: "MLSSTART", SessionNo: session.SessionNo}.URL()
+	res, err := session.Client.Get(startPage)
+	if err != nil {
+		return Menu{}, err
 	}
-	defer authFormRes.Body.Close()
+	defer res.Body.Close()
 
-	authToken, authTokenErr := auth.GetAuthenticationToken(authFormRes)
-	if authTokenErr != nil {
-		return authTokenErr
+	doc, err := goquery.NewDocumentFromReader(res.Body)
+	if err != nil {
+		return Menu{}, err
 	}
-	returnURL, returnURLErr := auth.GetReturnURL(authFormRes)
-	if returnURLErr != nil {
-		return returnURLErr
+
+	return parseMenu(doc), nil
+}
+
+/*
+Alive checks, if the session is still authenticated on STiNE, which also keeps it from expiring.
+A session, which was not logged in yet, is never alive.
+*/
+func (session *Session) Alive() (bool, error) {
+	if session.SessionNo == "" {
+		return false, nil
 	}
 
-	makeSessionError := session.makeSession(returnURL, username, password, authToken, auth.AuthenticationForm)
-	if makeSessionError != nil {
-		return makeSessionError
+	menu, err := session.fetchMenu()
+	if err != nil {
+		return false, err
 	}
 
-	return nil
+	// stine renders the menu of users, who are not authenticated, if the session expired, its links do not contain the session number
+	_, alive := findEntry(menu.Entries, func(entry MenuEntry) bool {
+		return sessionNoOf(entry.URL) == session.SessionNo
+	})
+	if alive {
+		session.menu = menu
+	}
+	return alive, nil
 }
 
 /*
 GetCategories returns the [moduleGetter.Category] with modules and nested categories the user can register for.
 
 The depth indicates how deep different categories are nested within a category - starting at 0, which returns the initial page.
+
+If a cache is set with SetCategoryCache, categories younger than its ttl are read from the cache instead of STiNE.
 */
 func (session *Session) GetCategories(depth int) (Category, error) {
-	registrationURL := sessionNo.Refresh("https://stine.uni-hamburg.de/scripts/mgrqispi.dll?APPNAME=CampusNet&PRGNAME=REGISTRATION&ARGUMENTS=-N000000000000000", session.SessionNo)
-	initialCategory, err := getAvailableModules(depth, registrationURL, session.Client)
+	err := session.autoRelogin()
+	if err != nil {
+		return Category{}, err
+	}
+	registrationURL := campusnet.Request{PrgName: "REGISTRATION", SessionNo: session.SessionNo, MenuId: session.menu.menuId(MenuModuleRegistration)}.URL()
+	initialCategory, err := getAvailableModules(depth, registrationURL, session.Client, session.cacheSettings(), nil)
 	if err != nil {
 		return Category{}, err
 	}
@@ -114,30 +160,101 @@ func (session *Session) GetCategories(depth int) (Category, error) {
 RegisterForModule registers the current authenticated user for the passed [moduleGetter.Module]. A [moduleRegisterer.ModuleRegistration] will be returned, which provides various functions for the registration.
 */
 func (session *Session) RegisterForModule(module Module) *ModuleRegistration {
-	return createModuleRegistration(module.RegistrationLink, session.SessionNo, session.Client)
+	// the registration reports its own error, if the session could not be logged in again
+	err := session.autoRelogin()
+	if err != nil {
+		log.Println("Unable to log in again:", err)
+	}
+	modReg := createModuleRegistration(module.RegistrationLink, session.SessionNo, session.Client)
+	modReg.menuId = session.menu.menuId(MenuModuleRegistration)
+	modReg.tanSettings = session.tanSettings()
+	return modReg
 }
 
 /*
-ChangeLanguage changes the language on the STiNE website for the current authenticated user.
-The language parameter accepts the following values:
+SetTanAttemptCounter sets the [TanAttemptCounter], which counts failed iTAN attempts of the authenticated user.
+By default, failed attempts are counted by every session of the program together, until the program exits.
+Use [NewFileTanAttemptCounter] to persist them across restarts.
+*/
+func (session *Session) SetTanAttemptCounter(counter TanAttemptCounter) {
+	session.tanAttempts = counter
+}
 
-"en" - english
+/*
+SetTanProvider sets the [TanProvider], which provides the iTANs for registrations started with this session.
+Actions, which require an iTAN, are completed automatically instead of returning a [TanRequired].
+Pass nil to enter iTANs manually again.
+*/
+func (session *Session) SetTanProvider(provider TanProvider) {
+	session.tanProvider = provider
+}
 
-"de" - german
+/*
+ListExamRegistrations returns every exam listed under "Exams" > "Exam registration", the user can register for or is registered for.
 */
-func (session *Session) ChangeLanguage(newLanguage string) error {
-	if newLanguage == "en" {
-		err := language.ChangeToEnglish(session.Client, session.SessionNo)
-		if err != nil {
-			return err
-		}
-	} else if newLanguage == "de" {
-		err := language.ChangeToGerman(session.Client, session.SessionNo)
-		if err != nil {
-			return err
-		}
-	} else {
-		return errors.New("ChangeLanguage only accepts \"de\" or \"en\" as values")
+func (session *Session) ListExamRegistrations() ([]Exam, error) {
+	err := session.autoRelogin()
+	if err != nil {
+		return nil, err
 	}
-	return nil
+	return getExams(session.Client, examRegistrationURL(session.SessionNo, session.menu.menuId(MenuExamRegistration)))
+}
+
+/*
+ExamOptions returns the exam dates offered for the passed [Exam], which can be passed to RegisterForExam.
+*/
+func (session *Session) ExamOptions(exam Exam) ([]ExamOption, error) {
+	err := session.autoRelogin()
+	if err != nil {
+		return nil, err
+	}
+	return getExamOptions(session.Client, session.SessionNo, exam)
+}
+
+/*
+RegisterForExam registers the current authenticated user for the passed [Exam] with the selected [ExamOption].
+If an iTAN is required, instead of nil a [TanRequired] is returned, unless a [TanProvider] is set.
+
+If the deadline of the exam has passed, [ErrDeadlinePassed] is returned.
+If the registration window of the exam is closed, [ErrRegistrationNotOpen] is returned.
+If the option is not offered for the exam, [ErrInvalidExamOption] is returned.
+*/
+func (session *Session) RegisterForExam(exam Exam, option ExamOption) (*TanRequired, error) {
+	err := session.autoRelogin()
+	if err != nil {
+		return nil, err
+	}
+	tanReq, err := registerForExam(session.Client, session.SessionNo, session.menu.menuId(MenuExamRegistration), exam, option)
+	return completeTan(session.tanSettings(), tanReq, err)
+}
+
+/*
+DeregisterFromExam deregisters the current authenticated user from the passed [Exam].
+If an iTAN is required, instead of nil a [TanRequired] is returned, unless a [TanProvider] is set.
+
+If the deadline of the exam has passed, [ErrDeadlinePassed] is returned.
+If STiNE does not offer a deregistration form for the exam, [ErrDeregistrationNotOpen] is returned.
+*/
+func (session *Session) DeregisterFromExam(exam Exam) (*TanRequired, error) {
+	err := session.autoRelogin()
+	if err != nil {
+		return nil, err
+	}
+	tanReq, err := deregisterFromExam(session.Client, session.SessionNo, exam)
+	return completeTan(session.tanSettings(), tanReq, err)
+}
+
+// UserData contains general information about the authenticated user, which is listed under "Service" > "Persönliche Daten".
+type UserData = userDataGetter.UserData
+
+/*
+GetUserData returns the personal data of the current authenticated user.
+The page is looked up in the menu of the session, see [MenuUserAccount].
+*/
+func (session *Session) GetUserData() (UserData, error) {
+	err := session.autoRelogin()
+	if err != nil {
+		return UserData{}, err
+	}
+	return userDataGetter.GetUserData(session.Client, session.SessionNo, session.menu.menuId(MenuUserAccount))
 }
@@ -1,9 +1,12 @@
 package stineapi
 
 import (
+	"fmt"
+	"github.com/martenmatrix/stine-api/cmd/stinetest"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 )
 
 func TestMakeSession(t *testing.T) {
@@ -38,3 +41,35 @@ func TestMakeSession(t *testing.T) {
 		t.Errorf("Did not receive expected form query input")
 	}
 }
+
+func TestOperationsLogInAgain(t *testing.T) {
+	server := stinetest.NewServer(stinetest.Config{
+		Username: "BBB1234",
+		Password: "password",
+		Modules:  []stinetest.Module{{Title: "Software Development II", Events: []stinetest.Event{{Id: "64-010", Title: "Lecture"}}}},
+	})
+	defer server.Close()
+
+	session := NewSession()
+	session.Client = server.Client()
+	err := session.LoginWithProvider(Credentials{Username: "BBB1234", Password: "password"}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expired := session.SessionNo
+
+	// the session expired after it was not used
+	server.ExpireSessions()
+	session.lastUsed = time.Now().Add(-reloginCheckAfter)
+
+	category, err := session.GetCategories(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if session.SessionNo == expired {
+		t.Error("expired session should be logged in again before the operation")
+	}
+	if len(category.Modules) != 1 {
+		t.Error(fmt.Sprintf("WANT: 1 module, GOT: %d", len(category.Modules)))
+	}
+}
@@ -0,0 +1,302 @@
+package stinetest
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/martenmatrix/stine-api/cmd/internal/campusnet"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const (
+	Redacted          = "REDACTED"
+	RedactedSessionNo = "999999999999999" // replaces every session number in a fixture
+)
+
+// form fields and inputs, whose values are always redacted
+var secretFormFields = []string{"Username", "Password", "__RequestVerificationToken", "tan_code"}
+
+var (
+	// matriculation numbers are only redacted, where they are labeled as such, other numbers are ids, capacities or dates
+	matriculationNumberRegex = regexp.MustCompile(`(?i)(<td name="matriculationNumber">\s*|(?:Matrikelnummer|Matrikel-Nr\.?|matriculation number):?\s*)\d{5,9}\b`)
+	personIdRegex            = regexp.MustCompile(`personid="\d+"`)
+	// elements, which contain the name of the user
+	nameElementRegex = regexp.MustCompile(`(?s)(<h2 personid="[^"]*">|<td name="(?:firstName|middleName|lastName)">|<span class="loginDataName"[^>]*>)(.*?)(</h2>|</td>|</span>)`)
+	cookieValueRegex = regexp.MustCompile(`^([^=]+=)[^;]*`)
+	inputRegex       = regexp.MustCompile(`<input\b[^>]*>`)
+	inputNameRegex   = regexp.MustCompile(`\bname="([^"]*)"`)
+	inputValueRegex  = regexp.MustCompile(`\bvalue="[^"]*"`)
+	// the session number is the first argument of every dispatcher link
+	sessionNoArgRegex = regexp.MustCompile(`(ARGUMENTS=-N)\d+`)
+)
+
+// fixture represents a recorded request and its response
+type fixture struct {
+	Method         string
+	URL            string
+	Form           url.Values `json:",omitempty"` // body of the request, if it is a form
+	RequestBody    string     `json:",omitempty"` // body of the request, if it is not a form
+	StatusCode     int
+	ResponseHeader http.Header
+	ResponseBody   string
+}
+
+// fixtureURL normalizes the url of a request, so it can be matched with a recorded request
+func fixtureURL(rawURL string) string {
+	return campusnet.RefreshSessionNo(rawURL, RedactedSessionNo)
+}
+
+/*
+Recorder is an [http.RoundTripper], which sends requests with another round tripper and saves every request and its response as a fixture,
+which can be served by a [Replayer] in tests.
+
+Credentials are redacted before a fixture is saved, only where they appear: usernames, passwords, the __RequestVerificationToken and TANs
+in forms and inputs, cookies, session numbers in the arguments of links and the Refresh header, labeled matriculation numbers and
+the name of the user on the personal data page. Further values e.g. the name of the user can be added to Redact.
+*/
+type Recorder struct {
+	Redact   []string // further values, which are replaced with REDACTED wherever they appear in a fixture
+	dir      string
+	base     http.RoundTripper
+	recorded int
+	mu       sync.Mutex
+}
+
+// NewRecorder creates a new [Recorder], which saves the fixtures to dir and sends the requests with base, [http.DefaultTransport] is used if base is nil.
+func NewRecorder(dir string, base http.RoundTripper) (*Recorder, error) {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	err := os.MkdirAll(dir, 0700)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Recorder{
+		dir:  dir,
+		base: base,
+	}, nil
+}
+
+// redactField returns the value, which replaces the value of a form field or input, false if the value is not secret
+func redactField(name string) (string, bool) {
+	if strings.EqualFold(name, "sessionno") {
+		return RedactedSessionNo, true
+	}
+	for _, field := range secretFormFields {
+		if strings.EqualFold(name, field) {
+			return Redacted, true
+		}
+	}
+	return "", false
+}
+
+// redactString replaces the values listed in Redact, secrets in inputs and links and personal data in text
+func (rec *Recorder) redactString(text string) string {
+	var secrets []string
+	for _, secret := range rec.Redact {
+		if secret != "" {
+			secrets = append(secrets, secret)
+		}
+	}
+	// replace longer secrets first, a secret may contain another one
+	sort.Slice(secrets, func(i, j int) bool {
+		return len(secrets[i]) > len(secrets[j])
+	})
+	for _, secret := range secrets {
+		text = strings.ReplaceAll(text, secret, Redacted)
+	}
+
+	text = inputRegex.ReplaceAllStringFunc(text, func(input string) string {
+		name := inputNameRegex.FindStringSubmatch(input)
+		if name == nil {
+			return input
+		}
+		replacement, secret := redactField(name[1])
+		if !secret {
+			return input
+		}
+		return inputValueRegex.ReplaceAllLiteralString(input, `value="`+replacement+`"`)
+	})
+	text = sessionNoArgRegex.ReplaceAllString(text, "${1}"+RedactedSessionNo)
+	text = nameElementRegex.ReplaceAllString(text, "${1}"+Redacted+"${3}")
+	text = personIdRegex.ReplaceAllString(text, `personid="0000000"`)
+	return matriculationNumberRegex.ReplaceAllString(text, "${1}0000000")
+}
+
+// redact removes credentials and personal data from the fixture
+func (rec *Recorder) redact(fix *fixture) {
+	for field, values := range fix.Form {
+		replacement, secret := redactField(field)
+		for i := range values {
+			if secret {
+				values[i] = replacement
+			}
+			values[i] = rec.redactString(values[i])
+		}
+		fix.Form[field] = values
+	}
+
+	for i, cookie := range fix.ResponseHeader.Values("Set-Cookie") {
+		fix.ResponseHeader["Set-Cookie"][i] = cookieValueRegex.ReplaceAllString(cookie, "${1}"+Redacted)
+	}
+	for header, values := range fix.ResponseHeader {
+		for i := range values {
+			values[i] = rec.redactString(values[i])
+		}
+		fix.ResponseHeader[header] = values
+	}
+
+	fix.URL = fixtureURL(rec.redactString(fix.URL))
+	fix.RequestBody = rec.redactString(fix.RequestBody)
+	fix.ResponseBody = rec.redactString(fix.ResponseBody)
+}
+
+// RoundTrip sends the request with the base round tripper and saves the request and its response as a fixture.
+func (rec *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	fix := fixture{
+		Method: req.Method,
+		URL:    req.URL.String(),
+	}
+
+	if req.Body != nil {
+		body, err := io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		req.Body = io.NopCloser(bytes.NewReader(body))
+
+		form, formErr := url.ParseQuery(string(body))
+		if strings.HasPrefix(req.Header.Get("Content-Type"), "application/x-www-form-urlencoded") && formErr == nil {
+			fix.Form = form
+		} else {
+			fix.RequestBody = string(body)
+		}
+	}
+
+	res, err := rec.base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := io.ReadAll(res.Body)
+	res.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	res.Body = io.NopCloser(bytes.NewReader(body))
+
+	fix.StatusCode = res.StatusCode
+	fix.ResponseHeader = res.Header.Clone()
+	fix.ResponseBody = string(body)
+
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+
+	rec.redact(&fix)
+
+	rec.recorded++
+	err = writeFixture(filepath.Join(rec.dir, fmt.Sprintf("%04d.json", rec.recorded)), fix)
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func writeFixture(path string, fix fixture) error {
+	data, err := json.MarshalIndent(fix, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0600)
+}
+
+// ErrNoFixture is returned by a [Replayer], if no fixture was recorded for a request.
+var ErrNoFixture = errors.New("no fixture was recorded for the request")
+
+/*
+Replayer is an [http.RoundTripper], which serves the fixtures saved by a [Recorder] instead of sending the requests.
+
+Requests are matched by their method and url, session numbers are ignored. If a request was recorded multiple times,
+the fixtures are served in the order they were recorded, the last one is served for every further request.
+*/
+type Replayer struct {
+	fixtures []fixture
+	served   []bool
+	mu       sync.Mutex
+}
+
+// NewReplayer creates a new [Replayer], which serves the fixtures saved in dir.
+func NewReplayer(dir string) (*Replayer, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(paths)
+
+	replayer := &Replayer{}
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		var fix fixture
+		err = json.Unmarshal(data, &fix)
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("unable to parse fixture %s: %s", path, err))
+		}
+		replayer.fixtures = append(replayer.fixtures, fix)
+	}
+	replayer.served = make([]bool, len(replayer.fixtures))
+
+	return replayer, nil
+}
+
+// RoundTrip serves the fixture recorded for the request.
+func (replayer *Replayer) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body != nil {
+		req.Body.Close()
+	}
+	reqURL := fixtureURL(req.URL.String())
+
+	replayer.mu.Lock()
+	defer replayer.mu.Unlock()
+
+	match := -1
+	for i, fix := range replayer.fixtures {
+		if fix.Method != req.Method || fix.URL != reqURL {
+			continue
+		}
+		match = i
+		if !replayer.served[i] {
+			break
+		}
+	}
+	if match == -1 {
+		return nil, errors.New(fmt.Sprintf("%s: %s %s", ErrNoFixture, req.Method, req.URL))
+	}
+	replayer.served[match] = true
+
+	fix := replayer.fixtures[match]
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", fix.StatusCode, http.StatusText(fix.StatusCode)),
+		StatusCode:    fix.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        fix.ResponseHeader.Clone(),
+		Body:          io.NopCloser(strings.NewReader(fix.ResponseBody)),
+		ContentLength: int64(len(fix.ResponseBody)),
+		Request:       req,
+	}, nil
+}
@@ -0,0 +1,152 @@
+package stinetest_test
+
+import (
+	"encoding/json"
+	"github.com/martenmatrix/stine-api/cmd"
+	"github.com/martenmatrix/stine-api/cmd/stinetest"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRecordAndReplay(t *testing.T) {
+	config := newConfig()
+	config.Password = "s3cr3t-passw0rd"
+	server := stinetest.NewServer(config)
+	defer server.Close()
+	dir := t.TempDir()
+
+	recorder, err := stinetest.NewRecorder(dir, server.Transport())
+	if err != nil {
+		t.Fatal(err)
+	}
+	recorder.Redact = []string{"Software Development II"}
+
+	session := stineapi.NewSession()
+	session.Client.Transport = recorder
+	err = session.Login("BBB1234", "s3cr3t-passw0rd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	recordedExams, err := session.ListExamRegistrations()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil || len(paths) == 0 {
+		t.Fatalf("expected fixtures to be recorded, error: %v", err)
+	}
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, secret := range []string{"BBB1234", "s3cr3t-passw0rd", "CfDJ8StinetestRequestVerificationToken", session.SessionNo, "Software Development II"} {
+			if strings.Contains(string(data), secret) {
+				t.Errorf("fixture %s contains %q", path, secret)
+			}
+		}
+	}
+
+	replayer, err := stinetest.NewReplayer(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jar, _ := cookiejar.New(nil)
+	replayed := stineapi.NewSession()
+	replayed.Client = &http.Client{Transport: replayer, Jar: jar}
+
+	// the password is not checked, as the server is not contacted
+	err = replayed.Login("BBB1234", "another password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if replayed.SessionNo != stinetest.RedactedSessionNo {
+		t.Errorf("WANT: %s, GOT: %s", stinetest.RedactedSessionNo, replayed.SessionNo)
+	}
+
+	exams, err := replayed.ListExamRegistrations()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(exams) != len(recordedExams) || exams[1].Module != recordedExams[1].Module || exams[0].Module != stinetest.Redacted {
+		t.Errorf("replayed exams do not match the recorded ones: %+v", exams)
+	}
+
+	_, err = replayed.Client.Get("https://www.stine.uni-hamburg.de/scripts/unknown")
+	if err == nil {
+		t.Error("requests, which were not recorded, should fail")
+	}
+}
+
+// roundTripFunc is a round tripper, which answers every request with the function
+type roundTripFunc func(req *http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestRedactOnlyWhereSecretsAppear(t *testing.T) {
+	page := `<a href="/scripts/mgrqispi.dll?APPNAME=CampusNet&PRGNAME=COURSEDETAILS&ARGUMENTS=-N123456789012345,-N000309,-N1234567">64-012</a>
+<td>1234 | 30</td><td>Termin: 12.04.2024 12:34</td><td>Raum 123456</td>
+<td name="matriculationNumber">
+	7654321
+</td>
+<input type="hidden" name="sessionno" value="123456789012345"><input type="text" name="tan_code" value="123456">`
+	want := `<a href="/scripts/mgrqispi.dll?APPNAME=CampusNet&PRGNAME=COURSEDETAILS&ARGUMENTS=-N999999999999999,-N000309,-N1234567">64-012</a>
+<td>1234 | 30</td><td>Termin: 12.04.2024 12:34</td><td>Raum 123456</td>
+<td name="matriculationNumber">
+	0000000
+</td>
+<input type="hidden" name="sessionno" value="999999999999999"><input type="text" name="tan_code" value="REDACTED">`
+
+	dir := t.TempDir()
+	recorder, err := stinetest.NewRecorder(dir, roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Header:     http.Header{"Refresh": {"0; URL=/scripts/mgrqispi.dll?APPNAME=CampusNet&PRGNAME=MLSSTART&ARGUMENTS=-N123456789012345,-N000266,"}},
+			Body:       io.NopCloser(strings.NewReader(page)),
+		}, nil
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the short password and the tan are only redacted in the form
+	client := &http.Client{Transport: recorder}
+	res, err := client.PostForm("https://www.stine.uni-hamburg.de/scripts/mgrqispi.dll", url.Values{"Password": {"1234"}, "tan_code": {"123456"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+
+	data, err := os.ReadFile(filepath.Join(dir, "0001.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fix struct {
+		Form           url.Values
+		ResponseHeader http.Header
+		ResponseBody   string
+	}
+	err = json.Unmarshal(data, &fix)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if fix.ResponseBody != want {
+		t.Errorf("WANT: %s, GOT: %s", want, fix.ResponseBody)
+	}
+	if fix.Form.Get("Password") != stinetest.Redacted || fix.Form.Get("tan_code") != stinetest.Redacted {
+		t.Errorf("form fields should be redacted, GOT: %s", fix.Form)
+	}
+	if refresh := fix.ResponseHeader.Get("Refresh"); !strings.Contains(refresh, "-N"+stinetest.RedactedSessionNo+",") {
+		t.Errorf("session number in the refresh header should be redacted, GOT: %s", refresh)
+	}
+}
@@ -0,0 +1,496 @@
+package stinetest
+
+import (
+	"fmt"
+	"github.com/martenmatrix/stine-api/cmd/internal/campusnet"
+	"github.com/martenmatrix/stine-api/cmd/internal/totp"
+	"html"
+	"io"
+	"math/rand"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// pendingKind represents what a pending registration does, once it is completed
+type pendingKind int
+
+const (
+	moduleRegistration pendingKind = iota
+	examRegistration
+	examDeregistration
+)
+
+// pending represents a registration, which was started but not completed yet
+type pending struct {
+	id         string // registration id, sent as rgtr_id
+	kind       pendingKind
+	moduleId   string // id of the module for module registrations
+	exam       int    // index of the exam for exam registrations
+	group      string // name of the radio buttons to select an exam date, stable for a module or exam
+	option     string // selected exam option
+	tanProgram string // program the tan is sent to
+	tanIndex   string // index of the requested itan
+}
+
+// index assigns an id to every category, module and event of the configuration
+func (server *Server) index() {
+	server.categories = map[string]*Category{}
+	server.categoryIds = map[*Category]string{}
+	server.modules = map[string]*Module{}
+	server.moduleIds = map[*Module]string{}
+	server.courseIds = map[*Event]string{}
+
+	var nextId int
+	var indexCategory func(categories []Category, modules []Module)
+	indexCategory = func(categories []Category, modules []Module) {
+		for i := range modules {
+			nextId++
+			id := fmt.Sprintf("%015d", 388000000000000+nextId)
+			server.modules[id] = &modules[i]
+			server.moduleIds[&modules[i]] = id
+			for j := range modules[i].Events {
+				nextId++
+				server.courseIds[&modules[i].Events[j]] = fmt.Sprintf("%015d", 387000000000000+nextId)
+			}
+		}
+		for i := range categories {
+			nextId++
+			id := fmt.Sprintf("%015d", 389000000000000+nextId)
+			server.categories[id] = &categories[i]
+			server.categoryIds[&categories[i]] = id
+			indexCategory(categories[i].Categories, categories[i].Modules)
+		}
+	}
+	indexCategory(server.config.Categories, server.config.Modules)
+}
+
+func (server *Server) categoryId(category *Category) string {
+	return server.categoryIds[category]
+}
+
+func (server *Server) moduleId(module *Module) string {
+	return server.moduleIds[module]
+}
+
+// nextRegistrationId returns a new registration id, which can only be submitted once
+func (server *Server) nextRegistrationId() string {
+	server.lastId++
+	return fmt.Sprintf("%015d", 390000000000000+server.lastId)
+}
+
+func (server *Server) handle(w http.ResponseWriter, r *http.Request) {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+
+	if strings.EqualFold(r.Host, "cndsf.ad.uni-hamburg.de") {
+		server.handleIdentityServer(w, r)
+		return
+	}
+
+	if r.URL.Path != "/scripts/mgrqispi.dll" {
+		http.NotFound(w, r)
+		return
+	}
+
+	if time.Now().Before(server.config.MaintenanceUntil) {
+		io.WriteString(w, maintenancePage(server.config.MaintenanceUntil))
+		return
+	}
+
+	req, err := campusnet.Parse(r.URL.String())
+	if err != nil {
+		io.WriteString(w, server.errorPage(campusnet.EmptySessionNo, server.text("Die Anfrage ist ungültig.", "The request is invalid.")))
+		return
+	}
+
+	if req.PrgName == "EXTERNALPAGES" {
+		io.WriteString(w, startPage())
+		return
+	}
+
+	if !server.authenticated(r, req.SessionNo) {
+		io.WriteString(w, server.errorPage(campusnet.EmptySessionNo, server.text("Zugang verweigert. Bitte melden Sie sich an.", "Access denied. Please log in.")))
+		return
+	}
+
+	program := req.PrgName
+	if r.Method == http.MethodPost {
+		err := r.ParseForm()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if r.PostForm.Has("tan_code") {
+			io.WriteString(w, server.handleTan(req.SessionNo, r))
+			return
+		}
+		if formProgram := r.PostForm.Get("PRGNAME"); formProgram != "" {
+			program = formProgram
+		}
+	}
+
+	io.WriteString(w, server.handleProgram(strings.ToUpper(program), req, r))
+}
+
+// handleProgram renders the page of the program
+func (server *Server) handleProgram(program string, req campusnet.Request, r *http.Request) string {
+	sessionNo := req.SessionNo
+
+	var firstArg string
+	if len(req.Args) > 0 {
+		firstArg = req.Args[0].Value
+	}
+
+	switch program {
+	case "MLSSTART":
+		return server.page(sessionNo, server.text("<h1>Willkommen</h1>", "<h1>Welcome</h1>"))
+	case "CHANGELANGUAGE":
+		switch req.MenuId {
+		case "001":
+			server.language = "de"
+		case "002":
+			server.language = "en"
+		}
+		return server.page(sessionNo, server.text("<h1>Willkommen</h1>", "<h1>Welcome</h1>"))
+	case "REGISTRATION":
+		if firstArg == "" {
+			return server.registrationPage(sessionNo, server.config.Categories, server.config.Modules)
+		}
+		category, exists := server.categories[firstArg]
+		if !exists {
+			return server.errorPage(sessionNo, server.text("Die Kategorie existiert nicht.", "The category does not exist."))
+		}
+		return server.registrationPage(sessionNo, category.Categories, category.Modules)
+	case "REGCOURSEMOD":
+		return server.moduleRegistrationPage(sessionNo, r.URL.String(), firstArg)
+	case "SAVEREGISTRATIONDETAILS":
+		return server.saveRegistrationDetails(sessionNo, r)
+	case "SAVEEXAMDETAILS":
+		return server.saveExamDetails(sessionNo, r)
+	case "EXAMREGISTRATION":
+		return server.examListPage(sessionNo)
+	case "REGEXAM":
+		return server.examRegistrationPage(sessionNo, r.URL.String(), firstArg, false)
+	case "DEREGEXAM":
+		return server.examRegistrationPage(sessionNo, r.URL.String(), firstArg, true)
+	case "CONFIRMEXAMDEREGISTRATION":
+		reg, errorPage := server.findPending(sessionNo, r)
+		if reg == nil {
+			return errorPage
+		}
+		return server.complete(sessionNo, r.URL.String(), reg)
+	}
+
+	return server.errorPage(sessionNo, server.text("Die angeforderte Seite existiert nicht.", "The requested page does not exist."))
+}
+
+// authenticated checks, if the cnsc cookie belongs to the session number
+func (server *Server) authenticated(r *http.Request, sessionNo string) bool {
+	cookie, err := r.Cookie("cnsc")
+	if err != nil {
+		return false
+	}
+	cnsc, exists := server.sessions[sessionNo]
+	return exists && cnsc == cookie.Value
+}
+
+const authToken = "CfDJ8StinetestRequestVerificationToken"
+
+// handleIdentityServer simulates the login form of the identity server
+func (server *Server) handleIdentityServer(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/IdentityServer/Account/Login" {
+		http.NotFound(w, r)
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		io.WriteString(w, loginForm(authToken, ""))
+		return
+	}
+
+	err := r.ParseForm()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if r.PostForm.Get("__RequestVerificationToken") != authToken {
+		http.Error(w, "invalid request verification token", http.StatusBadRequest)
+		return
+	}
+	if r.PostForm.Get("Username") != server.config.Username || r.PostForm.Get("Password") != server.config.Password {
+		io.WriteString(w, loginForm(authToken, "Ungültiger Benutzername oder Passwort"))
+		return
+	}
+
+	switch server.config.Account {
+	case AccountLocked:
+		io.WriteString(w, loginForm(authToken, "Ihr Benutzerkonto ist gesperrt. Bitte wenden Sie sich an den Service."))
+		return
+	case PasswordExpired:
+		io.WriteString(w, passwordExpiredPage(authToken))
+		return
+	case TermsNotAccepted:
+		io.WriteString(w, termsPage(authToken))
+		return
+	}
+
+	sessionNo := fmt.Sprintf("%015d", 100000000000000+rand.Int63n(900000000000000))
+	cnsc := fmt.Sprintf("%X", rand.Int63())
+	server.sessions[sessionNo] = cnsc
+
+	// the cookie is set by the identity server for the domain of stine, so http clients reject it
+	w.Header().Set("Set-Cookie", fmt.Sprintf("cnsc =%s; path=/scripts; domain=stine.uni-hamburg.de; HttpOnly", cnsc))
+	w.Header().Set("Refresh", "0; URL="+server.link(sessionNo, "MLSSTART", "MLSSTART"))
+	io.WriteString(w, "<html><body>Sie werden weitergeleitet.</body></html>")
+}
+
+// moduleRegistrationPage renders the registration form of the module, if its registration window is open
+func (server *Server) moduleRegistrationPage(sessionNo string, action string, moduleId string) string {
+	module, exists := server.modules[moduleId]
+	if !exists {
+		return server.errorPage(sessionNo, server.text("Das Modul existiert nicht.", "The module does not exist."))
+	}
+	if module.Registered {
+		return server.errorPage(sessionNo, server.text("Sie sind bereits zu diesem Modul angemeldet.", "You are already registered for this module."))
+	}
+	if module.Closed {
+		return server.page(sessionNo, server.text("<p>Die Anmeldung zu diesem Modul ist zurzeit nicht möglich.</p>", "<p>Registration for this module is currently not possible.</p>"))
+	}
+
+	reg := &pending{
+		id:         server.nextRegistrationId(),
+		kind:       moduleRegistration,
+		moduleId:   moduleId,
+		group:      "RB_" + moduleId,
+		tanProgram: "SAVEREGISTRATION",
+	}
+	server.pending[reg.id] = reg
+
+	return server.page(sessionNo, fmt.Sprintf("<h1>%s</h1>", html.EscapeString(module.Title))+form(action, map[string]string{
+		"PRGNAME": "SAVEREGISTRATIONDETAILS",
+		"rgtr_id": reg.id,
+	}, fmt.Sprintf(`<input type="submit" name="Next" value="%s">`, server.text(" Weiter", " Next"))))
+}
+
+// findPending returns the pending registration with the submitted registration id or an error page
+func (server *Server) findPending(sessionNo string, r *http.Request) (*pending, string) {
+	reg, exists := server.pending[r.PostForm.Get("rgtr_id")]
+	if !exists {
+		return nil, server.errorPage(sessionNo, server.text("Die Anmeldung ist abgelaufen oder wurde bereits abgeschlossen.", "The registration has expired or was already completed."))
+	}
+	return reg, ""
+}
+
+// saveRegistrationDetails asks for an exam date, if one needs to be selected, or completes the registration
+func (server *Server) saveRegistrationDetails(sessionNo string, r *http.Request) string {
+	reg, errorPage := server.findPending(sessionNo, r)
+	if reg == nil {
+		return errorPage
+	}
+	// the label of the submit button is sent in the active language
+	if r.PostForm.Get("Next") != server.text(" Weiter", " Next") {
+		return server.errorPage(sessionNo, server.text("Die Anfrage ist ungültig.", "The request is invalid."))
+	}
+	module, exists := server.modules[reg.moduleId]
+	if !exists {
+		delete(server.pending, reg.id)
+		return server.errorPage(sessionNo, server.text("Das Modul existiert nicht.", "The module does not exist."))
+	}
+
+	if len(module.ExamOptions) > 0 {
+		return server.page(sessionNo, form(r.URL.String(), map[string]string{
+			"PRGNAME": "SAVEEXAMDETAILS",
+			"rgtr_id": reg.id,
+		}, examOptionsTable(reg.group, module.ExamOptions)))
+	}
+	return server.complete(sessionNo, r.URL.String(), reg)
+}
+
+// examOptions returns the exam dates, which can be selected for the pending registration
+func (server *Server) examOptions(reg *pending) []ExamOption {
+	if reg.kind == moduleRegistration {
+		if module, exists := server.modules[reg.moduleId]; exists {
+			return module.ExamOptions
+		}
+		return nil
+	}
+	if reg.exam < len(server.config.Exams) {
+		return server.config.Exams[reg.exam].Options
+	}
+	return nil
+}
+
+// saveExamDetails stores the selected exam date and completes the registration
+func (server *Server) saveExamDetails(sessionNo string, r *http.Request) string {
+	reg, errorPage := server.findPending(sessionNo, r)
+	if reg == nil {
+		return errorPage
+	}
+
+	selected := r.PostForm.Get(reg.group)
+	for _, option := range server.examOptions(reg) {
+		if option.Value == selected {
+			reg.option = selected
+			return server.complete(sessionNo, r.URL.String(), reg)
+		}
+	}
+	return server.errorPage(sessionNo, server.text("Bitte wählen Sie einen der angebotenen Prüfungstermine aus.", "Please select one of the offered exam dates."))
+}
+
+// examRegistrationPage renders the registration or deregistration form of the exam
+func (server *Server) examRegistrationPage(sessionNo string, action string, examId string, deregister bool) string {
+	var index int
+	_, err := fmt.Sscanf(examId, "%d", &index)
+	if err != nil || index < 1 || index > len(server.config.Exams) {
+		return server.errorPage(sessionNo, server.text("Die Prüfung existiert nicht.", "The exam does not exist."))
+	}
+	exam := server.config.Exams[index-1]
+	if exam.Registered != deregister {
+		return server.errorPage(sessionNo, server.text("Die Aktion ist für diese Prüfung nicht möglich.", "The action is not possible for this exam."))
+	}
+
+	reg := &pending{
+		id:         server.nextRegistrationId(),
+		kind:       examRegistration,
+		exam:       index - 1,
+		group:      fmt.Sprintf("RB_%015d", 391000000000000+index),
+		tanProgram: "SAVEEXAMREGISTRATION",
+	}
+	server.pending[reg.id] = reg
+
+	if deregister {
+		reg.kind = examDeregistration
+		reg.tanProgram = "SAVEEXAMDEREGISTRATION"
+		return server.page(sessionNo, form(action, map[string]string{
+			"PRGNAME": "CONFIRMEXAMDEREGISTRATION",
+			"rgtr_id": reg.id,
+		}, fmt.Sprintf("<p>Möchten Sie sich von der Prüfung %s abmelden?</p>", html.EscapeString(exam.Title))))
+	}
+
+	return server.page(sessionNo, form(action, map[string]string{
+		"PRGNAME": "SAVEEXAMDETAILS",
+		"rgtr_id": reg.id,
+	}, examOptionsTable(reg.group, exam.Options)))
+}
+
+// nextTanIndex returns the index of the next unused itan
+func (server *Server) nextTanIndex() string {
+	var indices []string
+	for index := range server.config.Tan.List {
+		if !server.usedTans[index] {
+			indices = append(indices, index)
+		}
+	}
+	sort.Strings(indices)
+	if len(indices) == 0 {
+		return "001"
+	}
+	return indices[0]
+}
+
+// complete asks for the tan, if one is required, or finalizes the registration
+func (server *Server) complete(sessionNo string, action string, reg *pending) string {
+	if reg.kind == moduleRegistration {
+		if module, exists := server.modules[reg.moduleId]; exists && module.Error != "" {
+			delete(server.pending, reg.id)
+			return server.errorPage(sessionNo, module.Error)
+		}
+	}
+
+	if server.config.Tan.Method != NoTan {
+		reg.tanIndex = server.nextTanIndex()
+		return server.tanPage(sessionNo, action, reg, "")
+	}
+	return server.finalize(sessionNo, reg, "")
+}
+
+// finalize applies the registration to the configuration
+func (server *Server) finalize(sessionNo string, reg *pending, tan string) string {
+	delete(server.pending, reg.id)
+
+	registration := Registration{ExamOption: reg.option, Tan: tan}
+	switch reg.kind {
+	case moduleRegistration:
+		module, exists := server.modules[reg.moduleId]
+		if !exists {
+			return server.errorPage(sessionNo, server.text("Das Modul existiert nicht.", "The module does not exist."))
+		}
+		module.Registered = true
+		for i := range module.Events {
+			module.Events[i].CurrentCapacity++
+		}
+		registration.Module = module.Title
+	case examRegistration, examDeregistration:
+		exam := &server.config.Exams[reg.exam]
+		exam.Registered = reg.kind == examRegistration
+		registration.Module = exam.Module
+		registration.Exam = exam.Title
+		registration.Deregistration = reg.kind == examDeregistration
+	}
+	server.registrations = append(server.registrations, registration)
+
+	if reg.kind == examDeregistration {
+		return server.successPage(sessionNo, server.text("Sie wurden erfolgreich abgemeldet.", "You were deregistered successfully."))
+	}
+	return server.successPage(sessionNo, server.text("Ihre Anmeldung war erfolgreich.", "Your registration was successful."))
+}
+
+// validTan checks the tan sent for the pending registration
+func (server *Server) validTan(reg *pending, code string) bool {
+	switch server.config.Tan.Method {
+	case IndexedTan:
+		itan, exists := server.config.Tan.List[reg.tanIndex]
+		return exists && !server.usedTans[reg.tanIndex] && code != "" && code == strings.TrimPrefix(itan, reg.tanIndex)
+	case MobileTan:
+		return code != "" && code == server.config.Tan.MobileTan
+	case TotpTan:
+		secret, err := totp.DecodeSecret(server.config.Tan.TotpSecret)
+		if err != nil {
+			return false
+		}
+		// the previous code is accepted as well, as the clocks may differ
+		step := totp.Step(time.Now())
+		return code == totp.Generate(secret, step) || code == totp.Generate(secret, step-1)
+	}
+	return false
+}
+
+// handleTan checks the sent tan and completes the pending registration
+func (server *Server) handleTan(sessionNo string, r *http.Request) string {
+	reg, errorPage := server.findPending(sessionNo, r)
+	if reg == nil {
+		return errorPage
+	}
+
+	maxAttempts := server.config.Tan.MaxAttempts
+	if maxAttempts == 0 {
+		maxAttempts = 3
+	}
+	if server.tanFailures >= maxAttempts {
+		return server.errorPage(sessionNo, server.text("Ihre TAN-Liste ist gesperrt.", "Your TAN list is locked."))
+	}
+
+	code := r.PostForm.Get("tan_code")
+	if !server.validTan(reg, code) {
+		server.tanFailures++
+		remaining := maxAttempts - server.tanFailures
+		switch remaining {
+		case 0:
+			return server.tanPage(sessionNo, r.URL.String(), reg, server.text("Die TAN ist ungültig. Ihre TAN-Liste wurde gesperrt.", "The TAN is invalid. Your TAN list was locked."))
+		case 1:
+			return server.tanPage(sessionNo, r.URL.String(), reg, server.text("Die TAN ist ungültig. Sie haben noch 1 Versuch.", "The TAN is invalid. 1 attempt remaining."))
+		}
+		return server.tanPage(sessionNo, r.URL.String(), reg, fmt.Sprintf(server.text("Die TAN ist ungültig. Sie haben noch %d Versuche.", "The TAN is invalid. %d attempts remaining."), remaining))
+	}
+
+	server.tanFailures = 0
+	if server.config.Tan.Method == IndexedTan {
+		// every itan can only be used once
+		server.usedTans[reg.tanIndex] = true
+	}
+	return server.finalize(sessionNo, reg, code)
+}
@@ -0,0 +1,277 @@
+package stinetest
+
+import (
+	"fmt"
+	"github.com/martenmatrix/stine-api/cmd/internal/campusnet"
+	"html"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// default menu ids of a student account by program
+var defaultMenuIds = map[string]string{
+	"MLSSTART":         "000266",
+	"REGISTRATION":     "000309",
+	"EXAMREGISTRATION": "000310",
+	"PERSADDRESS":      "000273",
+}
+
+const identityServerLogin = "https://cndsf.ad.uni-hamburg.de/IdentityServer/Account/Login"
+
+// menuId returns the menu id of the entry, which is rendered by the program
+func (server *Server) menuId(program string) string {
+	if menuId, exists := server.config.MenuIds[program]; exists {
+		return menuId
+	}
+	return defaultMenuIds[program]
+}
+
+// link returns the url of a page of the program, the args follow the session number and menu id
+func (server *Server) link(sessionNo string, program string, menuProgram string, args ...campusnet.Arg) string {
+	return campusnet.Request{
+		Base:      "/scripts/mgrqispi.dll",
+		PrgName:   program,
+		SessionNo: sessionNo,
+		MenuId:    server.menuId(menuProgram),
+		Args:      args,
+	}.URL()
+}
+
+// text returns the german or english text depending on the language selected by the user
+func (server *Server) text(german string, english string) string {
+	if server.language == "en" {
+		return english
+	}
+	return german
+}
+
+func attr(value string) string {
+	return html.EscapeString(value)
+}
+
+// page wraps the content with the navigation of an authenticated user
+func (server *Server) page(sessionNo string, content string) string {
+	navEntry := func(depth int, href string, title string, children string) string {
+		return fmt.Sprintf(`<li class="intern depth_%d linkItem"><a class="depth_%d navLink" href="%s">%s</a>%s</li>`, depth, depth, attr(href), html.EscapeString(title), children)
+	}
+
+	studying := fmt.Sprintf(`<ul class="nav depth_2 linkItemContainer">%s%s</ul>`,
+		navEntry(2, server.link(sessionNo, "REGISTRATION", "REGISTRATION"), server.text("Anmeldung zu Veranstaltungen", "Register for modules and courses"), ""),
+		navEntry(2, server.link(sessionNo, "EXAMREGISTRATION", "EXAMREGISTRATION"), server.text("Anmeldung zu Prüfungen", "Exam registration"), ""),
+	)
+	service := fmt.Sprintf(`<ul class="nav depth_2 linkItemContainer">%s</ul>`,
+		navEntry(2, server.link(sessionNo, "PERSADDRESS", "PERSADDRESS"), server.text("Persönliche Daten", "Personal data"), ""),
+	)
+
+	// the page links to the language, which is not active
+	otherLanguage := campusnet.Request{Base: "/scripts/mgrqispi.dll", PrgName: "CHANGELANGUAGE", SessionNo: sessionNo, MenuId: server.text("002", "001")}.URL()
+
+	return fmt.Sprintf(`<html lang="%s"><body>
+<div id="pageHeader"><a id="languageSwitch" href="%s">%s</a></div>
+<div id="pageTopNavi"><ul class="nav depth_1 linkItemContainer">%s%s</ul></div>
+<div id="pageContent">%s</div>
+</body></html>`,
+		server.language, attr(otherLanguage), server.text("English", "Deutsch"),
+		navEntry(1, server.link(sessionNo, "MLSSTART", "MLSSTART"), server.text("Studium", "Studying"), studying),
+		navEntry(1, server.link(sessionNo, "MLSSTART", "PERSADDRESS"), "Service", service),
+		content,
+	)
+}
+
+// startPage is the page displayed to users, who are not authenticated
+func startPage() string {
+	returnURL := "/IdentityServer/connect/authorize/callback?client_id=ClassicWeb&response_type=code"
+	return fmt.Sprintf(`<html><body><a id="logIn_btn" class="img img_arrowSubmit" title="Anmelden" href="%s">Anmelden</a></body></html>`,
+		attr(identityServerLogin+"?ReturnUrl="+url.QueryEscape(returnURL)))
+}
+
+// loginForm is the login form of the identity server
+func loginForm(authToken string, errorMsg string) string {
+	return fmt.Sprintf(`<html><body>
+<form method="post" action="/IdentityServer/Account/Login">
+	<div class="alert-danger">%s</div>
+	<input name="Username" type="text">
+	<input name="Password" type="password">
+	<input name="__RequestVerificationToken" type="hidden" value="%s">
+</form>
+</body></html>`, html.EscapeString(errorMsg), attr(authToken))
+}
+
+// passwordExpiredPage asks the user to change the expired password
+func passwordExpiredPage(authToken string) string {
+	return fmt.Sprintf(`<html><body>
+<h1>Passwort ändern</h1>
+<div class="alert alert-warning">Ihr Passwort ist abgelaufen. Bitte vergeben Sie ein neues Passwort.</div>
+<form method="post" action="/IdentityServer/Account/ChangePassword">
+	<input name="NewPassword" type="password">
+	<input name="__RequestVerificationToken" type="hidden" value="%s">
+</form>
+</body></html>`, attr(authToken))
+}
+
+// termsPage asks the user to accept the terms of use
+func termsPage(authToken string) string {
+	return fmt.Sprintf(`<html><body>
+<h1>Nutzungsbedingungen</h1>
+<p>Bitte lesen und akzeptieren Sie die Nutzungsbedingungen, um fortzufahren.</p>
+<form method="post" action="/IdentityServer/Consent">
+	<input name="__RequestVerificationToken" type="hidden" value="%s">
+	<button name="button" value="yes">Akzeptieren</button>
+</form>
+</body></html>`, attr(authToken))
+}
+
+// maintenancePage replaces every page of stine during maintenance
+func maintenancePage(until time.Time) string {
+	return fmt.Sprintf(`<html><body>
+<h1>Wartungsarbeiten</h1>
+<div class="error">STiNE ist wegen Wartungsarbeiten bis %s Uhr nicht erreichbar.</div>
+</body></html>`, until.In(berlin()).Format("02.01.2006 15:04"))
+}
+
+// berlin returns the time zone the times on stine are listed in
+func berlin() *time.Location {
+	location, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		return time.Local
+	}
+	return location
+}
+
+// errorPage is displayed, if stine rejects a request
+func (server *Server) errorPage(sessionNo string, errorMsg string) string {
+	return server.page(sessionNo, fmt.Sprintf(`<div class="error">%s</div>`, html.EscapeString(errorMsg)))
+}
+
+func renderCapacity(capacity int) string {
+	if capacity <= 0 {
+		return "-"
+	}
+	return strconv.Itoa(capacity)
+}
+
+// registrationPage lists the categories and modules of a category
+func (server *Server) registrationPage(sessionNo string, categories []Category, modules []Module) string {
+	var content strings.Builder
+
+	content.WriteString("<ul>")
+	for i := range categories {
+		id := server.categoryId(&categories[i])
+		fmt.Fprintf(&content, `<li><a href="%s">%s</a></li>`, attr(server.link(sessionNo, "REGISTRATION", "REGISTRATION", campusnet.N(id), campusnet.N("0"), campusnet.N("0"), campusnet.N("3"))), html.EscapeString(categories[i].Title))
+	}
+	content.WriteString("</ul>")
+
+	content.WriteString(`<table class="tbcoursestatus"><tbody>`)
+	for i := range modules {
+		module := &modules[i]
+		id := server.moduleId(module)
+
+		registrationLink := ""
+		if !module.Registered {
+			registrationLink = fmt.Sprintf(`<a href="%s" class="img noFloat register">%s</a>`, attr(server.link(sessionNo, "REGCOURSEMOD", "REGISTRATION", campusnet.N(id))), server.text("Anmelden", "Register"))
+		}
+
+		fmt.Fprintf(&content, `<tr>
+	<td class="tbsubhead"></td>
+	<!-- MODULE -->
+	<td class="tbsubhead dl-inner">
+		<p><strong><a href="%s">%s <span class="eventTitle">%s</span></a></strong></p>
+		<p>%s</p>
+	</td>
+	<td class="tbsubhead rw-qbf">%s</td>
+	<!-- MODULE END-->
+</tr>`, attr(server.link(sessionNo, "MODULEDETAILS", "REGISTRATION", campusnet.N(id))), html.EscapeString(module.Number), html.EscapeString(module.Title), html.EscapeString(module.Teacher), registrationLink)
+
+		for j := range module.Events {
+			event := &module.Events[j]
+			fmt.Fprintf(&content, `<tr>
+	<!--logo column-->
+	<td class="tbdata"></td>
+	<td class="tbdata dl-inner">
+		<p><strong><a href="%s" name="eventLink">%s <span class="eventTitle">%s</span></a></strong></p>
+	</td>
+	<td class="tbdata">%s | %s<br></td>
+	<!--COURSE END -->
+</tr>`, attr(server.link(sessionNo, "COURSEDETAILS", "REGISTRATION", campusnet.N("0"), campusnet.N(server.courseIds[event]), campusnet.N("0"), campusnet.N("0"), campusnet.N("3"))), html.EscapeString(event.Id), html.EscapeString(event.Title), renderCapacity(event.MaxCapacity), renderCapacity(event.CurrentCapacity))
+		}
+	}
+	content.WriteString("</tbody></table>")
+
+	return server.page(sessionNo, content.String())
+}
+
+// form renders a form with hidden inputs, which is posted to action
+func form(action string, hidden map[string]string, content string) string {
+	var inputs strings.Builder
+	// stine renders PRGNAME first
+	if program, exists := hidden["PRGNAME"]; exists {
+		fmt.Fprintf(&inputs, `<input type="hidden" name="PRGNAME" value="%s">`, attr(program))
+	}
+	for name, value := range hidden {
+		if name != "PRGNAME" {
+			fmt.Fprintf(&inputs, `<input type="hidden" name="%s" value="%s">`, attr(name), attr(value))
+		}
+	}
+	return fmt.Sprintf(`<form method="post" action="%s">%s%s</form>`, attr(action), inputs.String(), content)
+}
+
+// examOptionsTable renders the radio buttons to select an exam date
+func examOptionsTable(group string, options []ExamOption) string {
+	var table strings.Builder
+	table.WriteString("<table>")
+	for _, option := range options {
+		fmt.Fprintf(&table, `<tr><td><input type="radio" name="%s" value="%s"></td><td>%s</td><td>%s</td><td>%s</td></tr>`,
+			attr(group), attr(option.Value), html.EscapeString(option.Label), html.EscapeString(option.Date), html.EscapeString(option.Room))
+	}
+	table.WriteString("</table>")
+	return table.String()
+}
+
+// examListPage lists every exam under "Exams" > "Exam registration"
+func (server *Server) examListPage(sessionNo string) string {
+	var content strings.Builder
+	content.WriteString("<table>")
+	for i, exam := range server.config.Exams {
+		id := fmt.Sprintf("%d", i+1)
+		link := fmt.Sprintf(`<a class="register" href="%s">%s</a>`, attr(server.link(sessionNo, "REGEXAM", "EXAMREGISTRATION", campusnet.N(id))), server.text("Anmelden", "Register"))
+		if exam.Registered {
+			link = fmt.Sprintf(`<a class="deregister" href="%s">%s</a>`, attr(server.link(sessionNo, "DEREGEXAM", "EXAMREGISTRATION", campusnet.N(id))), server.text("Abmelden", "Deregister"))
+		}
+		fmt.Fprintf(&content, `<tr><td>%s</td><td>%s</td><td>%s</td><td>%s</td><td>%s</td></tr>`,
+			html.EscapeString(exam.Module), html.EscapeString(exam.Title), html.EscapeString(exam.Date), html.EscapeString(exam.Deadline), link)
+	}
+	content.WriteString("</table>")
+	return server.page(sessionNo, content.String())
+}
+
+// tanPage asks for the tan of the pending registration
+func (server *Server) tanPage(sessionNo string, action string, reg *pending, errorMsg string) string {
+	var challenge string
+	switch server.config.Tan.Method {
+	case IndexedTan:
+		// stine pads the index with spaces instead of zeros
+		index, _ := strconv.Atoi(reg.tanIndex)
+		challenge = fmt.Sprintf(`<span class="itan">%3d</span>`, index)
+	case MobileTan:
+		challenge = fmt.Sprintf(`<span class="mtan">%s</span>`, server.text("Die TAN wurde an Ihr Mobiltelefon gesendet.", "The TAN was sent to your mobile phone."))
+	case TotpTan:
+		challenge = fmt.Sprintf(`<span class="totp">%s</span>`, server.text("Bitte geben Sie den Code Ihrer Authenticator-App ein.", "Please enter the code of your authenticator app."))
+	}
+
+	errorElement := ""
+	if errorMsg != "" {
+		errorElement = fmt.Sprintf(`<div class="error">%s</div>`, html.EscapeString(errorMsg))
+	}
+
+	return server.page(sessionNo, errorElement+form(action, map[string]string{
+		"PRGNAME": reg.tanProgram,
+		"rgtr_id": reg.id,
+	}, challenge+`<input type="text" name="tan_code">`))
+}
+
+// successPage is displayed after a registration was completed
+func (server *Server) successPage(sessionNo string, message string) string {
+	return server.page(sessionNo, fmt.Sprintf(`<div class="success">%s</div>`, html.EscapeString(message)))
+}
@@ -0,0 +1,211 @@
+/*
+Package stinetest provides a fake STiNE server, which simulates STiNE and its identity server, so programs using the stineapi package can be tested offline.
+
+The server is configured with a [Config] and reached through the client returned by [Server.Client], which sends every request
+to the STiNE and identity server hosts to the fake server instead:
+
+	server := stinetest.NewServer(stinetest.Config{
+		Username: "BBB1234",
+		Password: "password",
+		Modules: []stinetest.Module{
+			{Title: "Software Development II", Events: []stinetest.Event{{Id: "64-010", Title: "Lecture", MaxCapacity: 100}}},
+		},
+	})
+	defer server.Close()
+
+	session := stineapi.NewSession()
+	session.Client = server.Client()
+	err := session.Login("BBB1234", "password")
+
+The simulated pages only contain the markup, which is read by the stineapi package.
+*/
+package stinetest
+
+import (
+	"golang.org/x/net/publicsuffix"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"sync"
+	"time"
+)
+
+// TanMethod represents the kind of TAN the server asks for, before a registration is completed.
+type TanMethod int
+
+const (
+	NoTan      TanMethod = iota // Registrations are completed without a TAN
+	IndexedTan                  // An iTAN of a printed iTAN list is requested by its index
+	MobileTan                   // A TAN sent to the mobile phone of the user is requested
+	TotpTan                     // A code of an authenticator app is requested
+)
+
+// TanConfig configures the TAN, which is requested before a registration is completed.
+type TanConfig struct {
+	Method      TanMethod
+	List        map[string]string // iTAN list for IndexedTan, the index e.g. "054" mapped to the printed iTAN e.g. "054233233"
+	MobileTan   string            // TAN accepted for MobileTan
+	TotpSecret  string            // base32 encoded secret the codes for TotpTan are computed from
+	MaxAttempts int               // failed attempts, after which TANs are no longer accepted, defaults to 3
+}
+
+// AccountState represents the state of the account, which decides what the identity server displays after the credentials were submitted.
+type AccountState int
+
+const (
+	AccountActive    AccountState = iota // The user is logged in
+	AccountLocked                        // The login is rejected, as the account is locked
+	PasswordExpired                      // The user is asked to change the password
+	TermsNotAccepted                     // The user is asked to accept the terms of use
+)
+
+// Event represents an event of a [Module] like a lecture or an exercise group.
+type Event struct {
+	Id              string // ID in the following format 64-010
+	Title           string
+	MaxCapacity     int // Maximum student capacity, 0 is rendered as "-" like STiNE does for events without a limit
+	CurrentCapacity int // Currently registered students, increases with every registration for the module
+}
+
+// ExamOption represents an exam date, which can be selected during a registration.
+type ExamOption struct {
+	Value string // Value of the radio button, STiNE uses " 1", " 2" and "99"
+	Label string // e.g. "Klausur"
+	Date  string // Date and time as displayed by STiNE e.g. "Mo, 24. Jul. 2023 10:00 - 12:00"
+	Room  string
+}
+
+// Module represents a module listed on the registration pages.
+type Module struct {
+	Number      string // e.g. "InfB-SE 2"
+	Title       string
+	Teacher     string
+	Closed      bool   // The registration window is not open yet, no registration form is rendered
+	Registered  bool   // The user is registered, no registration link is rendered
+	Error       string // If set, registrations are rejected with this error message e.g. "Die Veranstaltung ist ausgebucht"
+	Events      []Event
+	ExamOptions []ExamOption // If set, an exam date needs to be selected during the registration
+}
+
+// Category represents a category listed on the registration pages.
+type Category struct {
+	Title      string
+	Categories []Category
+	Modules    []Module
+}
+
+// Exam represents an exam listed under "Exams" > "Exam registration".
+type Exam struct {
+	Module     string
+	Title      string
+	Date       string // Date and time as displayed by STiNE e.g. "Mo, 24. Jul. 2023 10:00 - 12:00"
+	Deadline   string // Deadline as displayed by STiNE e.g. "10.07.2023"
+	Registered bool
+	Options    []ExamOption
+}
+
+// Config configures the simulated STiNE.
+type Config struct {
+	Username         string
+	Password         string
+	Account          AccountState      // State of the account, which is checked after the credentials were accepted
+	MaintenanceUntil time.Time         // If in the future, every STiNE page is replaced by a maintenance notice listing this time
+	Categories       []Category        // Categories listed under "Studying" > "Register for modules and courses"
+	Modules          []Module          // Modules listed under "Studying" > "Register for modules and courses"
+	Exams            []Exam            // Exams listed under "Exams" > "Exam registration"
+	Tan              TanConfig         // TAN requested before registrations are completed
+	MenuIds          map[string]string // Menu id of the menu entry rendered by a program e.g. "REGISTRATION", defaults to the ids of a student account
+}
+
+// Registration represents a registration, which was completed on the server.
+type Registration struct {
+	Module         string // Title of the module or of the module of the exam
+	Exam           string // Title of the exam, empty for module registrations
+	ExamOption     string // Value of the selected exam option, empty if none was selected
+	Deregistration bool   // Whether the user deregistered
+	Tan            string // TAN the registration was confirmed with, empty if none was required
+}
+
+// Server is a fake STiNE server.
+type Server struct {
+	*httptest.Server
+	config        Config
+	categories    map[string]*Category // categories by id
+	categoryIds   map[*Category]string
+	modules       map[string]*Module // modules by id
+	moduleIds     map[*Module]string
+	courseIds     map[*Event]string
+	sessions      map[string]string   // session numbers mapped to the value of the cnsc cookie
+	pending       map[string]*pending // registrations waiting for an exam selection or tan by registration id
+	registrations []Registration
+	tanFailures   int
+	usedTans      map[string]bool // indices of used itans
+	language      string
+	lastId        int
+	mu            sync.Mutex
+}
+
+// NewServer starts a new [Server] with the passed configuration, it should be closed with Close after the test.
+func NewServer(config Config) *Server {
+	server := &Server{
+		config:   config,
+		sessions: map[string]string{},
+		pending:  map[string]*pending{},
+		usedTans: map[string]bool{},
+		language: "de",
+	}
+	server.index()
+	server.Server = httptest.NewServer(http.HandlerFunc(server.handle))
+	return server
+}
+
+// Client returns a new HTTP client with a cookie jar, which sends every request to STiNE or its identity server to the fake server.
+func (server *Server) Client() *http.Client {
+	jar, err := cookiejar.New(&cookiejar.Options{PublicSuffixList: publicsuffix.List})
+	if err != nil {
+		panic(err)
+	}
+
+	return &http.Client{
+		Transport: server.Transport(),
+		Jar:       jar,
+	}
+}
+
+// Transport returns a [Transport], which sends every request to STiNE or its identity server to the fake server.
+func (server *Server) Transport() *Transport {
+	return NewTransport(server.URL, nil)
+}
+
+// Update changes the configuration of the running server e.g. to open a registration window or free a seat.
+func (server *Server) Update(update func(config *Config)) {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+
+	update(&server.config)
+	server.index()
+}
+
+// ExpireSessions logs out every session, as if they expired.
+func (server *Server) ExpireSessions() {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+
+	server.sessions = map[string]string{}
+}
+
+// Registrations returns every registration completed on the server in the order they were completed.
+func (server *Server) Registrations() []Registration {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+
+	return append([]Registration(nil), server.registrations...)
+}
+
+// Language returns the language selected by the user, "de" or "en".
+func (server *Server) Language() string {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+
+	return server.language
+}
@@ -0,0 +1,478 @@
+package stinetest_test
+
+import (
+	"errors"
+	"fmt"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/martenmatrix/stine-api/cmd"
+	"github.com/martenmatrix/stine-api/cmd/stinetest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newConfig() stinetest.Config {
+	return stinetest.Config{
+		Username: "BBB1234",
+		Password: "password",
+		Categories: []stinetest.Category{
+			{
+				Title: "Informatik",
+				Modules: []stinetest.Module{
+					{
+						Title:   "Software Development II",
+						Teacher: "Peter Lustig",
+						Events:  []stinetest.Event{{Id: "64-010", Title: "Lecture", MaxCapacity: 550, CurrentCapacity: 162}},
+						ExamOptions: []stinetest.ExamOption{
+							{Value: " 1", Label: "Klausur", Date: "Mo, 24. Jul. 2023 10:00 - 12:00", Room: "ESA A"},
+							{Value: " 2", Label: "Klausur", Date: "Mi, 27. Sep. 2023 14:00 - 16:00", Room: "Audimax"},
+						},
+					},
+					{Title: "Distributed Systems", Closed: true, Events: []stinetest.Event{{Id: "64-090", Title: "Lecture"}}},
+				},
+			},
+		},
+		Exams: []stinetest.Exam{
+			{Module: "Software Development II", Title: "Klausur", Date: "24.07.2099", Deadline: "10.07.2099", Options: []stinetest.ExamOption{{Value: " 1", Label: "Klausur"}}},
+			{Module: "Distributed Systems", Title: "Klausur", Date: "02.10.2099", Deadline: "25.09.2099", Registered: true},
+		},
+		Tan: stinetest.TanConfig{
+			Method: stinetest.IndexedTan,
+			List:   map[string]string{"054": "054233233", "087": "087123123"},
+		},
+	}
+}
+
+func login(t *testing.T, server *stinetest.Server) stineapi.Session {
+	session := stineapi.NewSession()
+	session.Client = server.Client()
+	err := session.Login("BBB1234", "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return session
+}
+
+func TestLogin(t *testing.T) {
+	server := stinetest.NewServer(newConfig())
+	defer server.Close()
+
+	session := login(t, server)
+	if len(session.SessionNo) != 15 {
+		t.Error(fmt.Sprintf("expected a session number, received %q", session.SessionNo))
+	}
+
+	menu, err := session.Menu()
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry, found := menu.Find(stineapi.MenuExamRegistration)
+	if !found || entry.MenuId != "000310" {
+		t.Error(fmt.Sprintf("exam registration should be listed in the menu, found: %+v", entry))
+	}
+
+	wrongPassword := stineapi.NewSession()
+	wrongPassword.Client = server.Client()
+	err = wrongPassword.Login("BBB1234", "wrong")
+	if err == nil {
+		t.Error("login with a wrong password should fail")
+	}
+}
+
+func TestModuleRegistration(t *testing.T) {
+	server := stinetest.NewServer(newConfig())
+	defer server.Close()
+
+	session := login(t, server)
+	category, err := session.GetCategories(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(category.Categories) != 1 || len(category.Categories[0].Modules) != 2 {
+		t.Fatalf("expected one category with two modules, received: %+v", category)
+	}
+
+	se := category.Categories[0].Modules[0]
+	if se.Title != "Software Development II" || se.Events[0].MaxCapacity != 550 || se.Events[0].CurrentCapacity != 162 {
+		t.Error(fmt.Sprintf("module was not parsed correctly: %+v", se))
+	}
+
+	closed := session.RegisterForModule(category.Categories[0].Modules[1])
+	_, err = closed.Register()
+	if !errors.Is(err, stineapi.ErrRegistrationNotOpen) {
+		t.Error(fmt.Sprintf("WANT: %s, GOT: %s", stineapi.ErrRegistrationNotOpen, err))
+	}
+
+	modReg := session.RegisterForModule(se)
+	err = modReg.SetExamDate(stineapi.SecondExamDate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tanReq, err := modReg.Register()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tanReq == nil || tanReq.Challenge.Index != "054" {
+		t.Fatalf("expected itan 054 to be requested, received: %+v", tanReq)
+	}
+
+	err = tanReq.SetTan("000000")
+	var tanErr *stineapi.TanError
+	if !errors.As(err, &tanErr) || tanErr.RemainingAttempts != 2 {
+		t.Error(fmt.Sprintf("wrong itan should be rejected with 2 remaining attempts, received: %v", err))
+	}
+
+	err = tanReq.SetTan("054233233")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	registrations := server.Registrations()
+	if len(registrations) != 1 || registrations[0].Module != "Software Development II" || registrations[0].ExamOption != " 2" || registrations[0].Tan != "233233" {
+		t.Error(fmt.Sprintf("registration was not completed correctly: %+v", registrations))
+	}
+
+	refreshed, err := session.GetCategories(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	registered := refreshed.Categories[0].Modules[0]
+	if registered.RegistrationLink != "" || registered.Events[0].CurrentCapacity != 163 {
+		t.Error(fmt.Sprintf("module should be registered and the capacity increased: %+v", registered))
+	}
+}
+
+func TestExamRegistration(t *testing.T) {
+	config := newConfig()
+	config.Tan = stinetest.TanConfig{Method: stinetest.MobileTan, MobileTan: "424242"}
+	server := stinetest.NewServer(config)
+	defer server.Close()
+
+	session := login(t, server)
+	exams, err := session.ListExamRegistrations()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(exams) != 2 || exams[0].Registered || !exams[1].Registered {
+		t.Fatalf("exams were not listed correctly: %+v", exams)
+	}
+
+	options, err := session.ExamOptions(exams[0])
+	if err != nil || len(options) != 1 {
+		t.Fatalf("expected one exam option, received: %+v, %v", options, err)
+	}
+	tanReq, err := session.RegisterForExam(exams[0], options[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tanReq == nil || tanReq.Challenge.Type != stineapi.MobileTan {
+		t.Fatalf("expected a mobile tan to be requested, received: %+v", tanReq)
+	}
+	err = tanReq.Respond("424242")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tanReq, err = session.DeregisterFromExam(exams[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tanReq.Respond("424242")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	registrations := server.Registrations()
+	if len(registrations) != 2 || registrations[0].Deregistration || !registrations[1].Deregistration {
+		t.Error(fmt.Sprintf("registrations were not completed correctly: %+v", registrations))
+	}
+}
+
+func TestUnauthenticated(t *testing.T) {
+	server := stinetest.NewServer(newConfig())
+	defer server.Close()
+
+	session := stineapi.NewSession()
+	session.Client = server.Client()
+	session.SessionNo = "123456789012345"
+
+	exams, err := session.ListExamRegistrations()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(exams) != 0 {
+		t.Error("exams should not be listed for a session, which is not authenticated")
+	}
+}
+
+func TestAlive(t *testing.T) {
+	server := stinetest.NewServer(newConfig())
+	defer server.Close()
+
+	session := login(t, server)
+	if alive, err := session.Alive(); err != nil || !alive {
+		t.Fatal(fmt.Sprintf("session should be alive after the login, GOT: %t, %v", alive, err))
+	}
+
+	server.ExpireSessions()
+	if alive, err := session.Alive(); err != nil || alive {
+		t.Error(fmt.Sprintf("expired session should not be alive, GOT: %t, %v", alive, err))
+	}
+}
+
+func TestRelogin(t *testing.T) {
+	server := stinetest.NewServer(newConfig())
+	defer server.Close()
+
+	session := stineapi.NewSession()
+	session.Client = server.Client()
+	if err := session.Relogin(); !errors.Is(err, stineapi.ErrNoCredentialProvider) {
+		t.Error(fmt.Sprintf("WANT: %s, GOT: %v", stineapi.ErrNoCredentialProvider, err))
+	}
+
+	err := session.LoginWithProvider(stineapi.Credentials{Username: "BBB1234", Password: "password"}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if relogged, err := session.ReloginIfExpired(); err != nil || relogged {
+		t.Error(fmt.Sprintf("alive session should not be logged in again, GOT: %t, %v", relogged, err))
+	}
+	expired := session.SessionNo
+
+	server.ExpireSessions()
+	relogged, err := session.ReloginIfExpired()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !relogged {
+		t.Error("expired session should be logged in again")
+	}
+	if alive, err := session.Alive(); err != nil || !alive || session.SessionNo == expired {
+		t.Error(fmt.Sprintf("session should be alive with a new session number after the re-login, GOT: %t, %v", alive, err))
+	}
+}
+
+func TestLoginErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		password string
+		update   func(config *stinetest.Config)
+		want     error
+		step     stineapi.LoginStep
+	}{
+		{"wrong password", "wrong", func(config *stinetest.Config) {}, stineapi.ErrWrongCredentials, stineapi.LoginStepCredentials},
+		{"locked account", "password", func(config *stinetest.Config) { config.Account = stinetest.AccountLocked }, stineapi.ErrAccountLocked, stineapi.LoginStepCredentials},
+		{"expired password", "password", func(config *stinetest.Config) { config.Account = stinetest.PasswordExpired }, stineapi.ErrPasswordExpired, stineapi.LoginStepCredentials},
+		{"terms", "password", func(config *stinetest.Config) { config.Account = stinetest.TermsNotAccepted }, stineapi.ErrTermsNotAccepted, stineapi.LoginStepCredentials},
+		{"maintenance", "password", func(config *stinetest.Config) { config.MaintenanceUntil = time.Now().Add(time.Hour) }, stineapi.ErrMaintenance, stineapi.LoginStepStartPage},
+	}
+
+	for _, test := range tests {
+		config := newConfig()
+		test.update(&config)
+		server := stinetest.NewServer(config)
+
+		session := stineapi.NewSession()
+		session.Client = server.Client()
+		err := session.Login("BBB1234", test.password)
+
+		var loginErr *stineapi.LoginError
+		if !errors.Is(err, test.want) || !errors.As(err, &loginErr) || loginErr.Step != test.step {
+			t.Error(fmt.Sprintf("%s: WANT: %s at %s, GOT: %v", test.name, test.want, test.step, err))
+		}
+		if session.SessionNo != "" {
+			t.Error(fmt.Sprintf("%s: session should not be authenticated, GOT: %s", test.name, session.SessionNo))
+		}
+		server.Close()
+	}
+}
+
+func TestMaintenance(t *testing.T) {
+	server := stinetest.NewServer(newConfig())
+	defer server.Close()
+
+	session := login(t, server)
+	session.SetMaintenanceDetection(true)
+	until := time.Now().Add(2 * time.Hour).Truncate(time.Minute)
+	server.Update(func(config *stinetest.Config) {
+		config.MaintenanceUntil = until
+	})
+
+	_, err := session.GetCategories(1)
+	var maintenanceErr *stineapi.MaintenanceError
+	if !errors.As(err, &maintenanceErr) || !maintenanceErr.Until.Equal(until) {
+		t.Error(fmt.Sprintf("WANT: maintenance until %s, GOT: %v", until, err))
+	}
+	if _, err := session.ListExamRegistrations(); !errors.Is(err, stineapi.ErrMaintenance) {
+		t.Error(fmt.Sprintf("WANT: %s, GOT: %v", stineapi.ErrMaintenance, err))
+	}
+}
+
+func TestLanguages(t *testing.T) {
+	server := stinetest.NewServer(newConfig())
+	defer server.Close()
+
+	session := login(t, server)
+	results := map[stineapi.Language][]stineapi.Exam{}
+	categories := map[stineapi.Language]stineapi.Category{}
+
+	for _, language := range []stineapi.Language{stineapi.German, stineapi.English} {
+		err := session.ChangeLanguage(language)
+		if err != nil {
+			t.Fatal(err)
+		}
+		current, err := session.CurrentLanguage()
+		if err != nil || current != language {
+			t.Error(fmt.Sprintf("WANT: %s, GOT: %s, %v", language, current, err))
+		}
+
+		results[language], err = session.ListExamRegistrations()
+		if err != nil {
+			t.Fatal(err)
+		}
+		categories[language], err = session.GetCategories(1)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if diff := cmp.Diff(results[stineapi.German], results[stineapi.English]); diff != "" || len(results[stineapi.German]) != 2 {
+		t.Error(fmt.Sprintf("german and english exams differ: %s", diff))
+	}
+	if diff := cmp.Diff(categories[stineapi.German], categories[stineapi.English], cmpopts.IgnoreUnexported(stineapi.Category{})); diff != "" {
+		t.Error(fmt.Sprintf("german and english categories differ: %s", diff))
+	}
+}
+
+func TestPinLanguage(t *testing.T) {
+	server := stinetest.NewServer(newConfig())
+	defer server.Close()
+
+	session := login(t, server)
+	err := session.PinLanguage(stineapi.English)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the language is changed in another tab
+	otherTab := login(t, server)
+	err = otherTab.ChangeLanguage(stineapi.German)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = session.ListExamRegistrations()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if server.Language() != "en" {
+		t.Error(fmt.Sprintf("WANT: en, GOT: %s", server.Language()))
+	}
+
+	err = otherTab.ChangeLanguage(stineapi.German)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = session.Login("BBB1234", "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if server.Language() != "en" {
+		t.Error(fmt.Sprintf("language should be restored after the login, GOT: %s", server.Language()))
+	}
+}
+
+func TestCatalog(t *testing.T) {
+	server := stinetest.NewServer(newConfig())
+	defer server.Close()
+
+	crawler := login(t, server)
+	crawled, err := crawler.GetCategories(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := stineapi.MarshalCatalog(crawled)
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := stineapi.LoadCatalog(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the catalog is refreshed in a new session
+	session := login(t, server)
+	attached := session.Attach(loaded)
+	refreshed, err := attached.Refresh(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(refreshed.Categories) != 1 || len(refreshed.Categories[0].Modules) != 2 || !strings.Contains(refreshed.Url, session.SessionNo) {
+		t.Error(fmt.Sprintf("catalog was not refreshed with the new session: %+v", refreshed))
+	}
+}
+
+func TestStableIds(t *testing.T) {
+	server := stinetest.NewServer(newConfig())
+	defer server.Close()
+
+	var crawls []stineapi.Category
+	for i := 0; i < 2; i++ {
+		session := login(t, server)
+		crawled, err := session.GetCategories(1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		crawls = append(crawls, crawled)
+	}
+
+	first, second := crawls[0].Categories[0], crawls[1].Categories[0]
+	if first.Url == second.Url {
+		t.Fatal("sessions should have different session numbers")
+	}
+	if first.Id == "" || first.Id != second.Id {
+		t.Error(fmt.Sprintf("category ids differ between sessions: %s, %s", first.Id, second.Id))
+	}
+	se, seAgain := first.Modules[0], second.Modules[0]
+	if se.Id == "" || se.Id != seAgain.Id || se.Events[0].CourseId == "" || se.Events[0].CourseId != seAgain.Events[0].CourseId {
+		t.Error(fmt.Sprintf("module or course ids differ between sessions: %+v, %+v", se, seAgain))
+	}
+}
+
+func TestRegisterManyFallsBackAfterRejection(t *testing.T) {
+	server := stinetest.NewServer(stinetest.Config{
+		Username: "BBB1234",
+		Password: "password",
+		Modules: []stinetest.Module{
+			{Title: "Exercises Group 2", Error: "Die Veranstaltung ist ausgebucht", Events: []stinetest.Event{{Id: "64-012", Title: "Group 2"}}},
+			{Title: "Exercises Group 4", Events: []stinetest.Event{{Id: "64-014", Title: "Group 4"}}},
+		},
+	})
+	defer server.Close()
+
+	session := login(t, server)
+	category, err := session.GetCategories(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rejected := session.RegisterForModule(category.Modules[0])
+	_, err = rejected.Register()
+	var rejectedErr *stineapi.RejectedError
+	if !errors.As(err, &rejectedErr) || rejectedErr.Message != "Die Veranstaltung ist ausgebucht" || !errors.Is(err, stineapi.ErrRegistrationRejected) {
+		t.Error(fmt.Sprintf("WANT: rejection by stine, GOT: %v", err))
+	}
+
+	results := session.RegisterMany(stineapi.RegistrationPlan{
+		Items: []stineapi.PlanItem{
+			{Name: "exercise", Choices: []stineapi.PlanChoice{{Module: category.Modules[0]}, {Module: category.Modules[1]}}},
+		},
+	})
+	if results[0].Status != stineapi.PlanRegistered || results[0].Choice != 1 {
+		t.Error(fmt.Sprintf("fallback should be registered after the rejection, received %+v", results[0]))
+	}
+	if registrations := server.Registrations(); len(registrations) != 1 || registrations[0].Module != "Exercises Group 4" {
+		t.Error(fmt.Sprintf("only the fallback should be registered, registered: %+v", registrations))
+	}
+}
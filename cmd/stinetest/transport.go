@@ -0,0 +1,59 @@
+package stinetest
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// hosts, which are served by the fake server
+var stineHosts = []string{"stine.uni-hamburg.de", "www.stine.uni-hamburg.de", "cndsf.ad.uni-hamburg.de"}
+
+/*
+Transport is an [http.RoundTripper], which sends every request to STiNE or its identity server to another server.
+The Host header of the request is kept, so the server can tell which host was requested.
+
+Requests to other hosts are sent unchanged.
+*/
+type Transport struct {
+	target *url.URL
+	base   http.RoundTripper
+}
+
+// NewTransport creates a new [Transport], which sends the requests to the server at targetURL with base, [http.DefaultTransport] is used if base is nil.
+func NewTransport(targetURL string, base http.RoundTripper) *Transport {
+	target, err := url.Parse(targetURL)
+	if err != nil {
+		panic(err)
+	}
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	return &Transport{
+		target: target,
+		base:   base,
+	}
+}
+
+func isStineHost(host string) bool {
+	for _, stineHost := range stineHosts {
+		if strings.EqualFold(host, stineHost) {
+			return true
+		}
+	}
+	return false
+}
+
+// RoundTrip sends the request to the target server, if it is sent to STiNE or its identity server.
+func (transport *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !isStineHost(req.URL.Hostname()) {
+		return transport.base.RoundTrip(req)
+	}
+
+	rewritten := req.Clone(req.Context())
+	rewritten.URL.Scheme = transport.target.Scheme
+	rewritten.URL.Host = transport.target.Host
+	rewritten.Host = req.URL.Host
+	return transport.base.RoundTrip(rewritten)
+}
@@ -0,0 +1,135 @@
+package stineapi
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/martenmatrix/stine-api/cmd/internal/tan"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// MaxTanAttempts is the number of failed attempts, after which STiNE disables the iTAN list of a user.
+const MaxTanAttempts = 3
+
+// ErrLastTanAttempt is returned by SetTan, if the iTAN list would be disabled after another failed attempt.
+var ErrLastTanAttempt = errors.New("only one itan attempt is left before the itan list is disabled, call AllowLastAttempt to send the itan anyway")
+
+/*
+TanError is returned, if STiNE rejected an iTAN.
+RemainingAttempts is -1, if STiNE did not display how many attempts are left.
+*/
+type TanError = tan.Error
+
+/*
+TanAttemptCounter counts the failed iTAN attempts of every account.
+It can be set on a [Session] with SetTanAttemptCounter.
+*/
+type TanAttemptCounter interface {
+	// Failures returns the number of consecutive failed attempts of the account.
+	Failures(account string) (int, error)
+	// SetFailures stores the number of consecutive failed attempts of the account, it is set to 0 after a successful attempt.
+	SetFailures(account string, failures int) error
+}
+
+// memoryTanAttemptCounter counts failed attempts for the lifetime of the program
+type memoryTanAttemptCounter struct {
+	failures map[string]int
+	mu       sync.Mutex
+}
+
+func newMemoryTanAttemptCounter() *memoryTanAttemptCounter {
+	return &memoryTanAttemptCounter{
+		failures: map[string]int{},
+	}
+}
+
+// processTanAttempts is the default counter of every session, so new sessions and logins of an account continue counting
+var processTanAttempts = newMemoryTanAttemptCounter()
+
+func (counter *memoryTanAttemptCounter) Failures(account string) (int, error) {
+	counter.mu.Lock()
+	defer counter.mu.Unlock()
+
+	return counter.failures[account], nil
+}
+
+func (counter *memoryTanAttemptCounter) SetFailures(account string, failures int) error {
+	counter.mu.Lock()
+	defer counter.mu.Unlock()
+
+	counter.failures[account] = failures
+	return nil
+}
+
+/*
+FileTanAttemptCounter is a [TanAttemptCounter], which stores the failed attempts of every account in a JSON file,
+so they are not lost after a restart of the program.
+*/
+type FileTanAttemptCounter struct {
+	path string
+	mu   sync.Mutex
+}
+
+// NewFileTanAttemptCounter creates a new [FileTanAttemptCounter], which stores the failed attempts at the passed path. The file is created on the first failed attempt.
+func NewFileTanAttemptCounter(path string) *FileTanAttemptCounter {
+	return &FileTanAttemptCounter{
+		path: path,
+	}
+}
+
+// reads the failed attempts of every account from the file
+func (counter *FileTanAttemptCounter) read() (map[string]int, error) {
+	failures := map[string]int{}
+
+	data, err := os.ReadFile(counter.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return failures, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal(data, &failures)
+	if err != nil {
+		return nil, err
+	}
+	return failures, nil
+}
+
+// Failures returns the number of consecutive failed attempts of the account.
+func (counter *FileTanAttemptCounter) Failures(account string) (int, error) {
+	counter.mu.Lock()
+	defer counter.mu.Unlock()
+
+	failures, err := counter.read()
+	if err != nil {
+		return 0, err
+	}
+	return failures[account], nil
+}
+
+// SetFailures stores the number of consecutive failed attempts of the account.
+func (counter *FileTanAttemptCounter) SetFailures(account string, failures int) error {
+	counter.mu.Lock()
+	defer counter.mu.Unlock()
+
+	allFailures, err := counter.read()
+	if err != nil {
+		return err
+	}
+	allFailures[account] = failures
+
+	data, err := json.Marshal(allFailures)
+	if err != nil {
+		return err
+	}
+
+	// write to a temporary file first, so the counter is not lost if the program crashes
+	tmpPath := filepath.Join(filepath.Dir(counter.path), "."+filepath.Base(counter.path)+".tmp")
+	err = os.WriteFile(tmpPath, data, 0600)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, counter.path)
+}
@@ -0,0 +1,134 @@
+package stineapi
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/PuerkitoBio/goquery"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+)
+
+func TestSetTanCountsAttempts(t *testing.T) {
+	var tansSent int
+
+	fakeServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tansSent++
+		w.Write([]byte(`<span class="error">Die iTAN ist falsch.</span>`))
+	}))
+	defer fakeServer.Close()
+
+	counter := NewFileTanAttemptCounter(filepath.Join(t.TempDir(), "attempts.json"))
+	doc, err := goquery.NewDocumentFromReader(io.NopCloser(bytes.NewBufferString(`<span class="itan"> 54</span>`)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tanReq, _ := completeTan(tanSettings{attempts: counter, account: "BBB1234"}, newTanRequired(doc, &http.Client{}, "1", fakeServer.URL, "2", "SAVEREGISTRATION"), nil)
+
+	for i := 0; i < 2; i++ {
+		err = tanReq.SetTan("1234")
+		var tanErr *TanError
+		if !errors.As(err, &tanErr) {
+			t.Error(fmt.Sprintf("expected a TanError, received %s", err))
+		}
+	}
+
+	// third attempt would disable the itan list
+	err = tanReq.SetTan("1234")
+	if err != ErrLastTanAttempt {
+		t.Error(fmt.Sprintf("WANT: %s, GOT: %s", ErrLastTanAttempt, err))
+	}
+	if tansSent != 2 {
+		t.Error(fmt.Sprintf("expected 2 itans to be sent, however %d were sent", tansSent))
+	}
+
+	// failed attempts are persisted
+	failures, err := NewFileTanAttemptCounter(counter.path).Failures("BBB1234")
+	if err != nil || failures != 2 {
+		t.Error(fmt.Sprintf("expected 2 failed attempts to be stored, received %d %s", failures, err))
+	}
+
+	tanReq.AllowLastAttempt()
+	tanReq.SetTan("1234")
+	if tansSent != 3 {
+		t.Error("itan should be sent after the last attempt was allowed")
+	}
+}
+
+func TestSetTanResetsAttempts(t *testing.T) {
+	fakeServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer fakeServer.Close()
+
+	counter := newMemoryTanAttemptCounter()
+	counter.SetFailures("BBB1234", 1)
+
+	tanReq := &TanRequired{client: &http.Client{}, url: fakeServer.URL, attempts: counter, account: "BBB1234"}
+	err := tanReq.SetTan("1234")
+	if err != nil {
+		t.Errorf(err.Error())
+	}
+
+	failures, _ := counter.Failures("BBB1234")
+	if failures != 0 {
+		t.Error(fmt.Sprintf("failed attempts should be reset after a successful attempt, received %d", failures))
+	}
+}
+
+func TestSessionsShareTanAttempts(t *testing.T) {
+	first := NewSession()
+	first.username = "shared-attempts"
+	second := NewSession()
+	second.username = "shared-attempts"
+
+	err := first.tanSettings().attempts.SetFailures(first.username, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer processTanAttempts.SetFailures("shared-attempts", 0)
+
+	failures, _ := second.tanSettings().attempts.Failures(second.username)
+	if failures != 2 {
+		t.Error(fmt.Sprintf("a new session of the account should continue counting, WANT: 2, GOT: %d", failures))
+	}
+}
+
+func TestTanAttemptsAreNeverLowered(t *testing.T) {
+	fakeServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`<span class="error">Die iTAN ist falsch. Sie haben noch 2 Versuche.</span>`))
+	}))
+	defer fakeServer.Close()
+
+	counter := newMemoryTanAttemptCounter()
+	counter.SetFailures("BBB1234", 1)
+
+	tanReq := &TanRequired{client: &http.Client{}, url: fakeServer.URL, attempts: counter, account: "BBB1234"}
+	tanReq.SetTan("1234")
+
+	failures, _ := counter.Failures("BBB1234")
+	if failures != 2 {
+		t.Error(fmt.Sprintf("the remaining attempts displayed by stine should not lower the count, WANT: 2, GOT: %d", failures))
+	}
+}
+
+func TestOnlyItanAttemptsAreCounted(t *testing.T) {
+	fakeServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`<span class="error">Die TAN ist falsch.</span>`))
+	}))
+	defer fakeServer.Close()
+
+	counter := newMemoryTanAttemptCounter()
+	counter.SetFailures("BBB1234", 1)
+
+	for _, tanType := range []TanType{MobileTan, TotpTan, UnknownTan} {
+		tanReq := &TanRequired{client: &http.Client{}, url: fakeServer.URL, attempts: counter, account: "BBB1234", Challenge: TanChallenge{Type: tanType}}
+		tanReq.Respond("123456")
+	}
+
+	failures, _ := counter.Failures("BBB1234")
+	if failures != 1 {
+		t.Error(fmt.Sprintf("only rejected itans should be counted, WANT: 1, GOT: %d", failures))
+	}
+}
@@ -1,32 +1,239 @@
 package stineapi
 
 import (
+	"errors"
+	"github.com/PuerkitoBio/goquery"
 	"github.com/martenmatrix/stine-api/cmd/internal/tan"
 	"net/http"
+	"strings"
 )
 
+// TanType represents the kind of TAN STiNE asks for.
+type TanType int
+
+const (
+	IndexedTan TanType = iota // iTAN from the printed iTAN list, requested by its index
+	MobileTan                 // TAN sent to the mobile phone or displayed in the TAN app of the user
+	TotpTan                   // Time-based one-time password generated from a secret, e.g. by an authenticator app
+	UnknownTan                // TAN of a kind, which could not be identified on the page
+)
+
+// TanChallenge represents the TAN STiNE asks for to complete an action.
+type TanChallenge struct {
+	Type  TanType
+	Index string // Index of the requested iTAN with a leading zero e.g. "087", only set for IndexedTan
+	Data  string // Challenge displayed by STiNE e.g. instructions or a reference code, for UnknownTan the text of the form the TAN is entered in
+}
+
 /*
-TanRequired is returned from a function, if an iTAN is needed to complete the action.
-TanStartsWith represents the two starting numbers of the required iTAN with a leading zero.
+TanRequired is returned from a function, if a TAN is needed to complete the action.
+Challenge describes the requested TAN.
+TanStartsWith represents the two starting numbers of the required iTAN with a leading zero, it is only set for iTANs.
 */
 type TanRequired struct {
 	client         *http.Client // authenticated client on the stine website
 	sessionNo      string       // sessionNo of the authenticated client
 	url            string       // url the itan should be sent to
+	program        string       // program on the stine servers, which receives the itan
 	registrationId string
-	TanStartsWith  string // The numbers the required iTAN starts with, contains leading zero
+	attempts       TanAttemptCounter // counts failed attempts of the account, nil if attempts are not counted
+	account        string            // account failed attempts are counted for
+	allowLast      bool              // whether the last attempt before the itan list locks may be used
+	Challenge      TanChallenge      // The TAN STiNE asks for
+	TanStartsWith  string            // The numbers the required iTAN starts with, contains leading zero
+}
+
+// tanSettings contains everything required to enter an itan on behalf of an account
+type tanSettings struct {
+	provider TanProvider       // provides the itan, nil if the itan is entered manually
+	attempts TanAttemptCounter // counts failed attempts, nil if attempts are not counted
+	account  string            // account failed attempts are counted for
+}
+
+// parseTanChallenge extracts the requested TAN from the page, which asks for a TAN. If the kind of TAN cannot be identified, UnknownTan is returned.
+func parseTanChallenge(doc *goquery.Document) TanChallenge {
+	if itan := doc.Find(".itan").First(); itan.Length() > 0 {
+		itanStart := itan.Text()
+		return TanChallenge{
+			Type:  IndexedTan,
+			Index: strings.ReplaceAll(itanStart, " ", "0"),
+			Data:  strings.TrimSpace(itanStart),
+		}
+	}
+
+	if totp := doc.Find(".totp").First(); totp.Length() > 0 {
+		return TanChallenge{
+			Type: TotpTan,
+			Data: strings.TrimSpace(totp.Text()),
+		}
+	}
+
+	if mobile := doc.Find(".mtan").First(); mobile.Length() > 0 {
+		return TanChallenge{
+			Type: MobileTan,
+			Data: strings.TrimSpace(mobile.Text()),
+		}
+	}
+
+	form := doc.Find(`input[name="tan_code"]`).First().Closest("form")
+	return TanChallenge{
+		Type: UnknownTan,
+		Data: strings.Join(strings.Fields(form.Text()), " "),
+	}
+}
+
+// tanFormProgram returns the program of the form the TAN is entered in, other forms on the page e.g. in the header send to other programs
+func tanFormProgram(doc *goquery.Document, fallback string) string {
+	program, exists := doc.Find(`input[name="tan_code"]`).First().Closest("form").Find(`input[name="PRGNAME"]`).First().Attr("value")
+	if !exists || program == "" {
+		return fallback
+	}
+	return program
+}
+
+// creates a TanRequired struct from the page, which asks for the TAN, the TAN is sent to the passed program
+func newTanRequired(doc *goquery.Document, client *http.Client, sessionNo string, url string, registrationId string, program string) *TanRequired {
+	challenge := parseTanChallenge(doc)
+
+	return &TanRequired{
+		client:         client,
+		sessionNo:      sessionNo,
+		url:            url,
+		program:        program,
+		registrationId: registrationId,
+		Challenge:      challenge,
+		TanStartsWith:  challenge.Index,
+	}
+}
+
+// ErrUnsupportedChallenge is returned by a [TanProvider], if it is unable to provide a TAN for the type of the challenge.
+var ErrUnsupportedChallenge = errors.New("tan provider does not support the type of the tan challenge")
+
+/*
+TanProvider provides TANs, so actions requiring a TAN can be completed without user interaction.
+It can be set on a [Session] with SetTanProvider.
+*/
+type TanProvider interface {
+	// Tan returns the TAN for the passed challenge, an error should be returned if the type of the challenge is not supported.
+	// An iTAN is returned without its index, it is sent to STiNE as returned.
+	Tan(challenge TanChallenge) (string, error)
+	// Consume marks the TAN of the challenge as used, it is called after STiNE accepted the TAN.
+	Consume(challenge TanChallenge) error
+}
+
+// completes the action with a TAN from the provider and marks it as used
+func (tanReq *TanRequired) useProvider(provider TanProvider) error {
+	code, err := provider.Tan(tanReq.Challenge)
+	if err != nil {
+		return err
+	}
+
+	// the prefix is not removed, as an itan of the provider could start with the digits of its index
+	err = tanReq.send(code)
+	if err != nil {
+		return err
+	}
+
+	return provider.Consume(tanReq.Challenge)
+}
+
+// completeTan applies the settings to the TanRequired and completes the action with an iTAN from the provider, if an iTAN is required and a provider is set.
+// If the provider fails, the TanRequired is returned together with the error, so the iTAN can still be entered manually.
+func completeTan(settings tanSettings, tanReq *TanRequired, err error) (*TanRequired, error) {
+	if err != nil || tanReq == nil {
+		return tanReq, err
+	}
+
+	tanReq.attempts = settings.attempts
+	tanReq.account = settings.account
+	if settings.provider == nil {
+		return tanReq, nil
+	}
+
+	providerErr := tanReq.useProvider(settings.provider)
+	if providerErr != nil {
+		return tanReq, providerErr
+	}
+	return nil, nil
 }
 
 /*
-SetTan sends the provided iTAN to the STiNE servers to complete an action. If the validation fails, an error is returned.
+AllowLastAttempt allows SetTan to send an iTAN, although the iTAN list will be disabled if it is rejected.
+*/
+func (tanReq *TanRequired) AllowLastAttempt() {
+	tanReq.allowLast = true
+}
+
+/*
+SetTan sends the provided iTAN to the STiNE servers to complete an action. If the validation fails, a [TanError] is returned.
 The users iTAN list will be disabled after 3 failed attempts.
 The iTAN can be entered with the first three numbers or without the prefix provided by STiNE.
+
+Failed attempts are counted for every account by the [TanAttemptCounter] of the session.
+If only one attempt is left, [ErrLastTanAttempt] is returned without sending the iTAN, unless AllowLastAttempt was called.
+
+SetTan is equal to Respond, it is kept for iTANs.
 */
 func (tanReq *TanRequired) SetTan(itan string) error {
-	tanWithoutPrefix := tan.RemoveTanPrefix(itan, tanReq.TanStartsWith)
-	err := tan.SendTAN(tanReq.client, tanReq.url, tanWithoutPrefix, tanReq.sessionNo, tanReq.registrationId)
+	return tanReq.Respond(itan)
+}
+
+/*
+Respond sends the code requested by the Challenge to the STiNE servers to complete an action.
+For an iTAN, the code can be entered with or without the prefix provided by STiNE.
+
+Failed attempts are counted like for SetTan, but only for iTANs, as other TANs do not disable the iTAN list.
+*/
+func (tanReq *TanRequired) Respond(code string) error {
+	if tanReq.Challenge.Type == IndexedTan {
+		code = tan.RemoveTanPrefix(code, tanReq.TanStartsWith)
+	}
+	return tanReq.send(code)
+}
+
+// send sends the code as passed and counts failed attempts, only iTANs are counted as only the iTAN list is disabled
+func (tanReq *TanRequired) send(code string) error {
+	counted := tanReq.attempts != nil && tanReq.Challenge.Type == IndexedTan
+	if counted {
+		failures, err := tanReq.attempts.Failures(tanReq.account)
+		if err != nil {
+			return err
+		}
+		if failures >= MaxTanAttempts-1 && !tanReq.allowLast {
+			return ErrLastTanAttempt
+		}
+	}
+
+	err := tan.SendTAN(tanReq.client, tanReq.url, tanReq.program, code, tanReq.sessionNo, tanReq.registrationId)
+
+	var tanErr *TanError
+	if errors.As(err, &tanErr) && counted {
+		countErr := tanReq.recordFailure(tanErr)
+		if countErr != nil {
+			return countErr
+		}
+	}
 	if err != nil {
+		// network errors are not counted, as it is unknown if the itan was received
 		return err
 	}
+
+	if counted {
+		return tanReq.attempts.SetFailures(tanReq.account, 0)
+	}
 	return nil
 }
+
+// increases the failed attempts of the account, the remaining attempts reported by stine can only raise the count
+func (tanReq *TanRequired) recordFailure(tanErr *TanError) error {
+	failures, err := tanReq.attempts.Failures(tanReq.account)
+	if err != nil {
+		return err
+	}
+
+	failures++
+	if tanErr.RemainingAttempts >= 0 && MaxTanAttempts-tanErr.RemainingAttempts > failures {
+		failures = MaxTanAttempts - tanErr.RemainingAttempts
+	}
+	return tanReq.attempts.SetFailures(tanReq.account, failures)
+}
@@ -2,13 +2,17 @@ package stineapi
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
+	"github.com/PuerkitoBio/goquery"
 	"github.com/martenmatrix/stine-api/cmd/internal/tan"
+	"github.com/martenmatrix/stine-api/cmd/internal/totp"
 	"io"
 	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestRemoveTanPrefix(t *testing.T) {
@@ -40,6 +44,30 @@ func TestCheckForTanError(t *testing.T) {
 	if !strings.Contains(err.Error(), "a custom error msg") {
 		t.Error("err msg returned by stine is not contained in returned err")
 	}
+
+	var tanErr *TanError
+	if !errors.As(err, &tanErr) || tanErr.RemainingAttempts != -1 {
+		t.Error("expected a TanError without remaining attempts")
+	}
+
+	fakeResponse = &http.Response{
+		Body: io.NopCloser(bytes.NewBufferString(`<span class="error">Die iTAN ist falsch. Sie haben noch 2 Versuche.<span>`)),
+	}
+	err = tan.CheckForTANError(fakeResponse)
+
+	if !errors.As(err, &tanErr) || tanErr.RemainingAttempts != 2 {
+		t.Error(fmt.Sprintf("expected a TanError with 2 remaining attempts, received %s", err))
+	}
+
+	// numbers of attempts, which are not stated as remaining, are ignored
+	fakeResponse = &http.Response{
+		Body: io.NopCloser(bytes.NewBufferString(`<span class="error">Die iTAN ist falsch. Nach 3 Versuchen wird die iTAN-Liste gesperrt.<span>`)),
+	}
+	err = tan.CheckForTANError(fakeResponse)
+
+	if !errors.As(err, &tanErr) || tanErr.RemainingAttempts != -1 {
+		t.Error(fmt.Sprintf("expected a TanError without remaining attempts, received %s", err))
+	}
 }
 
 func TestSendTan(t *testing.T) {
@@ -71,9 +99,208 @@ func TestSendTan(t *testing.T) {
 	)
 	defer formRequestMock.Close()
 
-	err := tan.SendTAN(&http.Client{}, formRequestMock.URL, "23", fakeTAN.sessionNo, fakeTAN.registrationId)
+	err := tan.SendTAN(&http.Client{}, formRequestMock.URL, "SAVEREGISTRATION", "23", fakeTAN.sessionNo, fakeTAN.registrationId)
+
+	if err != nil {
+		t.Errorf(err.Error())
+	}
+}
+
+// fakeTanProvider provides the same itan for every index and remembers the consumed indices
+type fakeTanProvider struct {
+	itan     string
+	consumed []string
+}
+
+func (provider *fakeTanProvider) Tan(challenge TanChallenge) (string, error) {
+	return provider.itan, nil
+}
+
+func (provider *fakeTanProvider) Consume(challenge TanChallenge) error {
+	provider.consumed = append(provider.consumed, challenge.Index)
+	return nil
+}
+
+func TestTanProvider(t *testing.T) {
+	var tanSent string
 
+	fakeServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			w.Write([]byte(`<input name="rgtr_id" value="2132134"/>`))
+			return
+		}
+
+		err := r.ParseForm()
+		if err != nil {
+			t.Errorf("ERROR: %s", err)
+		}
+		if r.Form.Has("tan_code") {
+			tanSent = r.Form.Get("tan_code")
+			return
+		}
+		w.Write([]byte(`<span class="itan"> 54</span>`))
+	}))
+	defer fakeServer.Close()
+
+	// the itan of the provider starts with the digits of its index, which must not be removed
+	provider := &fakeTanProvider{itan: "054342"}
+	session := Session{Client: &http.Client{}, SessionNo: "342424"}
+	session.SetTanProvider(provider)
+
+	tanReq, err := session.RegisterForModule(Module{RegistrationLink: fakeServer.URL}).Register()
 	if err != nil {
 		t.Errorf(err.Error())
 	}
+
+	if tanReq != nil {
+		t.Error("itan should have been entered by the provider")
+	}
+	if tanSent != "054342" {
+		t.Error(fmt.Sprintf("EXPECTED: 054342, RECEIVED: %s", tanSent))
+	}
+	if fmt.Sprint(provider.consumed) != "[054]" {
+		t.Error(fmt.Sprintf("itan 054 should be consumed, consumed: %s", provider.consumed))
+	}
+}
+
+func TestParseTanChallenge(t *testing.T) {
+	tests := []struct {
+		html string
+		want TanChallenge
+	}{
+		{`<span class="itan"> 54</span>`, TanChallenge{Type: IndexedTan, Index: "054", Data: "54"}},
+		{`<span class="totp">Code der Authenticator-App</span>`, TanChallenge{Type: TotpTan, Data: "Code der Authenticator-App"}},
+		{`<span class="mtan">TAN wurde an +49 ***12 gesendet</span>`, TanChallenge{Type: MobileTan, Data: "TAN wurde an +49 ***12 gesendet"}},
+		{`<form><p>Bitte TAN eingeben</p><input type="text" name="tan_code"></form>`, TanChallenge{Type: UnknownTan, Data: "Bitte TAN eingeben"}},
+	}
+
+	for _, test := range tests {
+		doc, err := goquery.NewDocumentFromReader(strings.NewReader(test.html))
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := parseTanChallenge(doc)
+		if got != test.want {
+			t.Error(fmt.Sprintf("WANT: %+v, GOT: %+v", test.want, got))
+		}
+	}
+}
+
+func TestRespondTotp(t *testing.T) {
+	var tanSent string
+
+	fakeServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		tanSent = r.Form.Get("tan_code")
+	}))
+	defer fakeServer.Close()
+
+	tanReq := &TanRequired{
+		client:    &http.Client{},
+		url:       fakeServer.URL,
+		program:   "SAVEREGISTRATION",
+		attempts:  newMemoryTanAttemptCounter(),
+		Challenge: TanChallenge{Type: TotpTan},
+	}
+
+	err := tanReq.Respond("054321")
+	if err != nil {
+		t.Error(err)
+	}
+	if tanSent != "054321" {
+		t.Error(fmt.Sprintf("code of a totp challenge should be sent unchanged, sent: %s", tanSent))
+	}
+}
+
+func TestTotpProvider(t *testing.T) {
+	secret := "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+	provider, err := NewTotpProvider(secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = provider.Tan(TanChallenge{Type: IndexedTan, Index: "054"})
+	if err != ErrUnsupportedChallenge {
+		t.Error(fmt.Sprintf("WANT: %s, GOT: %s", ErrUnsupportedChallenge, err))
+	}
+
+	code, err := provider.Tan(TanChallenge{Type: TotpTan})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decoded, _ := totp.DecodeSecret(secret)
+	if code != totp.Generate(decoded, totp.Step(time.Now())) && code != totp.Generate(decoded, totp.Step(time.Now())-1) {
+		t.Error(fmt.Sprintf("code %s does not match the current time step", code))
+	}
+
+	// the same code cannot be used twice
+	err = provider.Consume(TanChallenge{Type: TotpTan})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = provider.Tan(TanChallenge{Type: TotpTan})
+	var usedErr *TotpCodeUsedError
+	if !errors.As(err, &usedErr) || usedErr.Wait <= 0 || usedErr.Wait > totp.Period {
+		t.Error(fmt.Sprintf("used code should return the time until the next code, received %v", err))
+	}
+
+	_, err = NewTotpProvider("not base32!")
+	if err == nil {
+		t.Error("invalid secret should be rejected")
+	}
+}
+
+func TestTanFormProgram(t *testing.T) {
+	// the logout form in the header is placed before the form the tan is entered in
+	page := `
+		<form id="logoutForm" method="post"><input type="hidden" name="PRGNAME" value="LOGOUT"></form>
+		<form method="post">
+			<input type="hidden" name="PRGNAME" value="SAVEEXAMREGISTRATION">
+			<span class="itan"> 54</span>
+			<input type="text" name="tan_code">
+		</form>`
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(page))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if program := tanFormProgram(doc, "SAVEREGISTRATION"); program != "SAVEEXAMREGISTRATION" {
+		t.Errorf("WANT: SAVEEXAMREGISTRATION, GOT: %s", program)
+	}
+
+	// module registrations always send the tan to SAVEREGISTRATION
+	var programSent string
+	fakeServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			w.Write([]byte(`<input name="rgtr_id" value="2132134"/>`))
+			return
+		}
+		r.ParseForm()
+		if r.Form.Has("tan_code") {
+			programSent = r.Form.Get("PRGNAME")
+			return
+		}
+		w.Write([]byte(page))
+	}))
+	defer fakeServer.Close()
+
+	session := Session{Client: &http.Client{}, SessionNo: "342424"}
+	tanReq, err := session.RegisterForModule(Module{RegistrationLink: fakeServer.URL}).Register()
+	if err != nil || tanReq == nil {
+		t.Fatal(fmt.Sprintf("expected an itan to be required, received %v", err))
+	}
+	err = tanReq.SetTan("0543423")
+	if err != nil {
+		t.Error(err.Error())
+	}
+	if programSent != "SAVEREGISTRATION" {
+		t.Errorf("WANT: SAVEREGISTRATION, GOT: %s", programSent)
+	}
+
+	page = `<form method="post"><input type="hidden" name="PRGNAME" value="LOGOUT"></form><form method="post"><input type="text" name="tan_code"></form>`
+	doc, _ = goquery.NewDocumentFromReader(strings.NewReader(page))
+	if program := tanFormProgram(doc, "SAVEREGISTRATION"); program != "SAVEREGISTRATION" {
+		t.Errorf("program of another form should not be used, WANT: SAVEREGISTRATION, GOT: %s", program)
+	}
 }
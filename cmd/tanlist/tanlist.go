@@ -0,0 +1,292 @@
+/*
+Package tanlist manages a printed iTAN list in a file, so registrations can be completed without user interaction.
+
+A [File] implements [stineapi.TanProvider] and can be set on a session with SetTanProvider.
+*/
+package tanlist
+
+import (
+	"bufio"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"github.com/martenmatrix/stine-api/cmd"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ErrUnknownIndex is returned, if the list does not contain an iTAN with the requested index.
+var ErrUnknownIndex = errors.New("itan list does not contain an itan with the requested index")
+
+// ErrAlreadyUsed is returned, if the requested iTAN was already used.
+var ErrAlreadyUsed = errors.New("itan with the requested index was already used")
+
+// Entry represents a single iTAN of an iTAN list.
+type Entry struct {
+	Index int    // Index of the iTAN as printed on the list, STiNE asks for the iTAN by this index
+	Tan   string // The iTAN itself without the index
+	Used  bool   // Whether the iTAN was already used
+}
+
+// splitLine splits a line of an itan list into its fields, the fields may be quoted like in a csv file
+func splitLine(line string) ([]string, error) {
+	var separator rune
+	switch {
+	case strings.Contains(line, ";"):
+		separator = ';'
+	case strings.Contains(line, ","):
+		separator = ','
+	default:
+		return strings.Fields(line), nil
+	}
+
+	reader := csv.NewReader(strings.NewReader(line))
+	reader.Comma = separator
+	reader.TrimLeadingSpace = true
+	fields, err := reader.Read()
+	if err != nil {
+		return nil, err
+	}
+	for i := range fields {
+		fields[i] = strings.TrimSpace(fields[i])
+	}
+	return fields, nil
+}
+
+// parses the fields of a line of an itan list
+func parseFields(fields []string) (Entry, error) {
+	// only the itan is listed, it starts with the three digit index e.g. 087233233
+	if len(fields) == 1 {
+		if len(fields[0]) <= 3 {
+			return Entry{}, errors.New(fmt.Sprintf("itan %s is too short to contain an index", fields[0]))
+		}
+		index, err := strconv.Atoi(fields[0][:3])
+		if err != nil {
+			return Entry{}, errors.New(fmt.Sprintf("unable to parse itan %s", fields[0]))
+		}
+		return Entry{Index: index, Tan: fields[0][3:]}, nil
+	}
+
+	index, err := strconv.Atoi(fields[0])
+	if err != nil {
+		return Entry{}, errors.New(fmt.Sprintf("unable to parse index %s", fields[0]))
+	}
+	if fields[1] == "" {
+		return Entry{}, errors.New(fmt.Sprintf("itan with index %d is empty", index))
+	}
+
+	entry := Entry{Index: index, Tan: fields[1]}
+	if len(fields) > 2 {
+		switch strings.ToLower(fields[2]) {
+		case "used", "true", "x", "1":
+			entry.Used = true
+		}
+	}
+	return entry, nil
+}
+
+/*
+Parse reads an iTAN list. Every line contains an index followed by the iTAN separated by a comma, semicolon or whitespace,
+optionally followed by "used", if the iTAN was already used. Fields may be quoted like in a CSV file.
+A line may also only contain the iTAN, if it starts with its three digit index, which is not part of the stored iTAN.
+
+Empty lines and lines starting with # are ignored. The first remaining line is ignored as well, if it is a CSV header.
+Every other line, which cannot be parsed, returns an error.
+*/
+func Parse(r io.Reader) ([]Entry, error) {
+	var entries []Entry
+	var lineNo int
+	firstLine := true
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields, err := splitLine(line)
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("line %d: %s", lineNo, err))
+		}
+		entry, err := parseFields(fields)
+		if err != nil && firstLine && len(fields) > 1 {
+			// header of a csv file
+			firstLine = false
+			continue
+		}
+		firstLine = false
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("line %d: %s", lineNo, err))
+		}
+		entries = append(entries, entry)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+/*
+File is an iTAN list stored in a file. Used iTANs are marked in the file, so they are not used again.
+*/
+type File struct {
+	LowWatermark int // A warning is logged, if fewer unused iTANs are left, defaults to 10
+	path         string
+	entries      []Entry
+	mu           sync.Mutex
+}
+
+// Open opens the iTAN list stored at the passed path, the file can be created with Import.
+func Open(path string) (*File, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	entries, err := Parse(file)
+	if err != nil {
+		return nil, err
+	}
+
+	return &File{
+		LowWatermark: 10,
+		path:         path,
+		entries:      entries,
+	}, nil
+}
+
+// Import reads the printed iTAN list from r, see [Parse] for the accepted formats, and stores it at the passed path.
+func Import(r io.Reader, path string) (*File, error) {
+	entries, err := Parse(r)
+	if err != nil {
+		return nil, err
+	}
+
+	list := &File{
+		LowWatermark: 10,
+		path:         path,
+		entries:      entries,
+	}
+	err = list.save()
+	if err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// save writes the list to a temporary file and replaces the stored list with it
+func (list *File) save() error {
+	tmp, err := os.CreateTemp(filepath.Dir(list.path), ".tanlist-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	writer := csv.NewWriter(tmp)
+	writer.Write([]string{"index", "tan", "used"})
+	for _, entry := range list.entries {
+		used := ""
+		if entry.Used {
+			used = "used"
+		}
+		writer.Write([]string{fmt.Sprintf("%03d", entry.Index), entry.Tan, used})
+	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Chmod(0600); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), list.path)
+}
+
+// find returns the entry with the index, which is passed as a string with leading zeros like STiNE lists it
+func (list *File) find(index string) (*Entry, error) {
+	parsedIndex, err := strconv.Atoi(strings.TrimSpace(index))
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("invalid itan index %s", index))
+	}
+
+	for i := range list.entries {
+		if list.entries[i].Index == parsedIndex {
+			return &list.entries[i], nil
+		}
+	}
+	return nil, ErrUnknownIndex
+}
+
+// Tan returns the unused iTAN with the index requested by the challenge e.g. "087" without the index, only challenges of the type IndexedTan are supported.
+func (list *File) Tan(challenge stineapi.TanChallenge) (string, error) {
+	if challenge.Type != stineapi.IndexedTan {
+		return "", stineapi.ErrUnsupportedChallenge
+	}
+
+	list.mu.Lock()
+	defer list.mu.Unlock()
+
+	entry, err := list.find(challenge.Index)
+	if err != nil {
+		return "", err
+	}
+	if entry.Used {
+		return "", ErrAlreadyUsed
+	}
+	return entry.Tan, nil
+}
+
+// Consume marks the iTAN requested by the challenge as used and stores the list. A warning is logged, if only a few unused iTANs are left.
+func (list *File) Consume(challenge stineapi.TanChallenge) error {
+	list.mu.Lock()
+	defer list.mu.Unlock()
+
+	entry, err := list.find(challenge.Index)
+	if err != nil {
+		return err
+	}
+	entry.Used = true
+
+	err = list.save()
+	if err != nil {
+		return err
+	}
+
+	if remaining := list.remaining(); remaining < list.LowWatermark {
+		log.Println(fmt.Sprintf("Only %d unused iTANs are left on the list, request a new list soon", remaining))
+	}
+	return nil
+}
+
+func (list *File) remaining() int {
+	var remaining int
+	for _, entry := range list.entries {
+		if !entry.Used {
+			remaining++
+		}
+	}
+	return remaining
+}
+
+// Remaining returns the number of unused iTANs on the list.
+func (list *File) Remaining() int {
+	list.mu.Lock()
+	defer list.mu.Unlock()
+
+	return list.remaining()
+}
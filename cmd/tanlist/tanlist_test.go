@@ -0,0 +1,104 @@
+package tanlist
+
+import (
+	"fmt"
+	"github.com/google/go-cmp/cmp"
+	"github.com/martenmatrix/stine-api/cmd"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	list := `
+		# printed itan list
+		index;tan
+		1;123456
+		2, 234567
+		3	345678	used
+		004456789
+	`
+
+	entries, err := Parse(strings.NewReader(list))
+	if err != nil {
+		t.Errorf(err.Error())
+	}
+
+	shouldReturn := []Entry{
+		{Index: 1, Tan: "123456"},
+		{Index: 2, Tan: "234567"},
+		{Index: 3, Tan: "345678", Used: true},
+		{Index: 4, Tan: "456789"},
+	}
+	if !cmp.Equal(entries, shouldReturn) {
+		t.Error(cmp.Diff(shouldReturn, entries))
+	}
+
+	_, err = Parse(strings.NewReader("42"))
+	if err == nil {
+		t.Error("itan without index should return an error")
+	}
+}
+
+func TestParseQuotedCSV(t *testing.T) {
+	entries, err := Parse(strings.NewReader("\"index\",\"tan\",\"used\"\n\"1\",\"123456\",\"\"\n\"87\",\"087123\",\"used\"\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	shouldReturn := []Entry{
+		{Index: 1, Tan: "123456"},
+		{Index: 87, Tan: "087123", Used: true},
+	}
+	if !cmp.Equal(entries, shouldReturn) {
+		t.Error(cmp.Diff(shouldReturn, entries))
+	}
+
+	// only the first line may be a header
+	_, err = Parse(strings.NewReader("1,123456\nl2,234567\n"))
+	if err == nil {
+		t.Error("line with a typo in the index should return an error")
+	}
+}
+
+func TestFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "itans.csv")
+
+	list, err := Import(strings.NewReader("1,123456\n87,233233\n"), path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	itan, err := list.Tan(stineapi.TanChallenge{Type: stineapi.IndexedTan, Index: "087"})
+	if err != nil || itan != "233233" {
+		t.Error(fmt.Sprintf("WANT: 233233, GOT: %s %s", itan, err))
+	}
+
+	_, err = list.Tan(stineapi.TanChallenge{Type: stineapi.IndexedTan, Index: "042"})
+	if err != ErrUnknownIndex {
+		t.Error(fmt.Sprintf("WANT: %s, GOT: %s", ErrUnknownIndex, err))
+	}
+
+	_, err = list.Tan(stineapi.TanChallenge{Type: stineapi.TotpTan})
+	if err != stineapi.ErrUnsupportedChallenge {
+		t.Error(fmt.Sprintf("WANT: %s, GOT: %s", stineapi.ErrUnsupportedChallenge, err))
+	}
+
+	err = list.Consume(stineapi.TanChallenge{Type: stineapi.IndexedTan, Index: "087"})
+	if err != nil {
+		t.Errorf(err.Error())
+	}
+
+	// used itans are persisted
+	reopened, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = reopened.Tan(stineapi.TanChallenge{Type: stineapi.IndexedTan, Index: "087"})
+	if err != ErrAlreadyUsed {
+		t.Error(fmt.Sprintf("WANT: %s, GOT: %s", ErrAlreadyUsed, err))
+	}
+	if reopened.Remaining() != 1 {
+		t.Errorf("expected 1 unused itan, received %d", reopened.Remaining())
+	}
+}
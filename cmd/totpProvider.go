@@ -0,0 +1,74 @@
+package stineapi
+
+import (
+	"fmt"
+	"github.com/martenmatrix/stine-api/cmd/internal/totp"
+	"sync"
+	"time"
+)
+
+/*
+TotpCodeUsedError is returned by [TotpProvider.Tan], if the current code was already accepted by STiNE, as every code can only be used once.
+Request the TAN again after Wait.
+*/
+type TotpCodeUsedError struct {
+	Wait time.Duration // Time until the next code is generated
+}
+
+func (usedErr *TotpCodeUsedError) Error() string {
+	return fmt.Sprintf("the current totp code was already used, the next code is generated in %s", usedErr.Wait)
+}
+
+/*
+TotpProvider is a [TanProvider], which computes time-based one-time passwords (TOTP) from the secret of the user,
+like an authenticator app does. It only provides TANs for challenges of the type TotpTan.
+*/
+type TotpProvider struct {
+	secret      []byte
+	pendingStep uint64 // time step of the last provided code
+	usedStep    uint64 // time step of the last code accepted by stine
+	mu          sync.Mutex
+}
+
+// NewTotpProvider creates a new [TotpProvider] from the base32 encoded secret, which is displayed while setting up an authenticator app.
+func NewTotpProvider(secret string) (*TotpProvider, error) {
+	decoded, err := totp.DecodeSecret(secret)
+	if err != nil {
+		return nil, err
+	}
+
+	return &TotpProvider{
+		secret: decoded,
+	}, nil
+}
+
+/*
+Tan returns the current code. If the current code was already accepted by STiNE, a [TotpCodeUsedError] is returned,
+which contains the time until the next code, so the caller decides whether to wait for it.
+*/
+func (provider *TotpProvider) Tan(challenge TanChallenge) (string, error) {
+	if challenge.Type != TotpTan {
+		return "", ErrUnsupportedChallenge
+	}
+
+	provider.mu.Lock()
+	defer provider.mu.Unlock()
+
+	step := totp.Step(time.Now())
+	if provider.usedStep != 0 && step <= provider.usedStep {
+		nextStep := time.Unix(int64(provider.usedStep+1)*int64(totp.Period/time.Second), 0)
+		return "", &TotpCodeUsedError{Wait: time.Until(nextStep)}
+	}
+
+	provider.pendingStep = step
+	return totp.Generate(provider.secret, step), nil
+}
+
+// Consume remembers the last provided code as used.
+func (provider *TotpProvider) Consume(challenge TanChallenge) error {
+	provider.mu.Lock()
+	defer provider.mu.Unlock()
+
+	provider.usedStep = provider.pendingStep
+	return nil
+}
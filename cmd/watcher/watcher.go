@@ -0,0 +1,347 @@
+/*
+Package watcher polls modules and events on STiNE and reports, as soon as a seat becomes available.
+Optionally, the user is registered for the module right away.
+*/
+package watcher
+
+import (
+	"context"
+	"errors"
+	"github.com/martenmatrix/stine-api/cmd"
+	"log"
+	"math/rand"
+	"net/http"
+	"time"
+)
+
+// ErrNoTanCallback is returned as the error of a [Seat], if an iTAN is required to complete a registration, but no TanCallback is set.
+var ErrNoTanCallback = errors.New("an itan is required to complete the registration, however no tan callback is set")
+
+/*
+Seat represents a free seat in an event, which was detected by the [Watcher].
+STiNE registers for whole modules, so an automatic registration registers for the module of the event and does not select the event.
+*/
+type Seat struct {
+	Module     stineapi.Module // Module the event belongs to
+	Event      stineapi.Event  // Event with a free seat
+	Registered bool            // Whether the user was registered for the module, only true if AutoRegister is enabled
+	Err        error           // Error, which occurred during the registration
+}
+
+// target is a category, whose modules and events are watched
+type target struct {
+	category stineapi.Category
+	ids      map[string]bool      // event ids and module titles to watch, if empty every module in the category is watched
+	free     map[string]bool      // whether an event had free seats on the last poll, key is the module title and event id
+	failures map[string]int       // consecutive failed registrations for a free event, same key as free
+	retryAt  map[string]time.Time // no registration for the free event is attempted before, same key as free
+}
+
+/*
+Watcher polls categories on STiNE and reports free seats in the watched modules and events.
+The exported fields can be changed before calling Run.
+*/
+type Watcher struct {
+	Interval             time.Duration                                      // Interval the categories are polled in, defaults to 1 minute
+	Jitter               time.Duration                                      // Maximum random deviation from the interval, so polls do not happen at fixed times, defaults to 10 seconds
+	MaxBackoff           time.Duration                                      // Maximum interval after consecutive failed polls, the interval doubles with every failure, defaults to 15 minutes
+	MaxRequestsPerMinute int                                                // Maximum number of requests per minute, including the requests of automatic registrations, defaults to 10
+	AutoRegister         bool                                               // Whether the user should be registered for the module of an event, as soon as a seat is available
+	ExamDate             stineapi.ExamDate                                  // Exam date selected on an automatic registration, see [stineapi.ModuleRegistration.SetExamDate]
+	TanCallback          func(tanReq *stineapi.TanRequired) (string, error) // Called, if an iTAN is required to complete an automatic registration, should return the iTAN
+	OnSeat               func(seat Seat)                                    // Called for every seat, which becomes available
+	PauseForMaintenance  bool                                               // Whether polling pauses until the announced end of a STiNE maintenance, defaults to true
+	KeepAlive            time.Duration                                      // Interval the session is checked in and logged in again, if it expired, only for sessions logged in with LoginWithProvider, defaults to 5 minutes
+	session              *stineapi.Session
+	targets              []*target
+	registered           map[string]bool // titles of modules the user was registered for by the watcher
+	requests             []time.Time     // points in time of the requests within the last minute
+}
+
+// New creates a new [Watcher], which polls with the passed authenticated session.
+func New(session *stineapi.Session) *Watcher {
+	return &Watcher{
+		Interval:             time.Minute,
+		Jitter:               10 * time.Second,
+		MaxBackoff:           15 * time.Minute,
+		MaxRequestsPerMinute: 10,
+		PauseForMaintenance:  true,
+		KeepAlive:            5 * time.Minute,
+		session:              session,
+		registered:           map[string]bool{},
+	}
+}
+
+/*
+Watch adds the modules and events listed directly in the passed category to the watched ones.
+The category is refreshed on every poll, which is why it should contain as few modules as possible.
+
+The ids can be event ids like "64-010" or module titles. If no ids are passed, every module in the category is watched.
+*/
+func (w *Watcher) Watch(category stineapi.Category, ids ...string) {
+	idSet := map[string]bool{}
+	for _, id := range ids {
+		idSet[id] = true
+	}
+
+	w.targets = append(w.targets, &target{
+		category: category,
+		ids:      idSet,
+		free:     map[string]bool{},
+		failures: map[string]int{},
+		retryAt:  map[string]time.Time{},
+	})
+}
+
+// blocks until another request can be sent without exceeding MaxRequestsPerMinute
+func (w *Watcher) waitForRequestSlot(ctx context.Context) error {
+	for {
+		// forget requests older than a minute
+		for len(w.requests) > 0 && time.Since(w.requests[0]) >= time.Minute {
+			w.requests = w.requests[1:]
+		}
+
+		if w.MaxRequestsPerMinute <= 0 || len(w.requests) < w.MaxRequestsPerMinute {
+			w.requests = append(w.requests, time.Now())
+			return nil
+		}
+
+		err := sleep(ctx, time.Minute-time.Since(w.requests[0]))
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// returns the time to wait until the next poll, considering the jitter and the number of consecutive failures
+func (w *Watcher) nextPollIn(failures int) time.Duration {
+	wait := w.Interval
+	for i := 0; i < failures && wait < w.MaxBackoff; i++ {
+		wait *= 2
+	}
+	if w.MaxBackoff > 0 && wait > w.MaxBackoff {
+		wait = w.MaxBackoff
+	}
+
+	if w.Jitter > 0 {
+		wait += time.Duration(rand.Int63n(int64(2*w.Jitter))) - w.Jitter
+	}
+	if wait < 0 {
+		wait = 0
+	}
+	return wait
+}
+
+// limitedTransport is a round tripper, which waits for a request slot of the watcher before every request
+type limitedTransport struct {
+	base    http.RoundTripper // round tripper the requests are sent with, http.DefaultTransport if nil
+	watcher *Watcher
+	ctx     context.Context // context of Run, waiting for a slot stops, once it is cancelled
+}
+
+func (transport *limitedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	err := transport.watcher.waitForRequestSlot(transport.ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	base := transport.base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return base.RoundTrip(req)
+}
+
+// limitedSession returns a copy of the session of the watcher, whose requests are counted towards MaxRequestsPerMinute
+func (w *Watcher) limitedSession(ctx context.Context) *stineapi.Session {
+	session := *w.session
+	client := *session.Client
+	client.Transport = &limitedTransport{base: client.Transport, watcher: w, ctx: ctx}
+	session.Client = &client
+	return &session
+}
+
+// checks, if the module or event is watched by the target
+func (t *target) watches(module stineapi.Module, event stineapi.Event) bool {
+	return len(t.ids) == 0 || t.ids[module.Title] || t.ids[event.Id]
+}
+
+// registers the user for the module of the seat
+func (w *Watcher) register(session *stineapi.Session, seat *Seat) {
+	modReg := session.RegisterForModule(seat.Module)
+	err := modReg.SetExamDate(w.ExamDate)
+	if err != nil {
+		seat.Err = err
+		return
+	}
+
+	tanReq, err := modReg.Register()
+	if err != nil {
+		seat.Err = err
+		return
+	}
+
+	if tanReq != nil {
+		if w.TanCallback == nil {
+			seat.Err = ErrNoTanCallback
+			return
+		}
+
+		itan, tanErr := w.TanCallback(tanReq)
+		if tanErr != nil {
+			seat.Err = tanErr
+			return
+		}
+		tanErr = tanReq.SetTan(itan)
+		if tanErr != nil {
+			seat.Err = tanErr
+			return
+		}
+	}
+
+	seat.Registered = true
+	w.registered[seat.Module.Title] = true
+}
+
+// compares the refreshed category with the last poll and handles every seat, which became available
+func (w *Watcher) check(session *stineapi.Session, t *target, refreshed stineapi.Category) {
+	for _, module := range refreshed.Modules {
+		if w.registered[module.Title] {
+			continue
+		}
+
+		for _, event := range module.Events {
+			if !t.watches(module, event) {
+				continue
+			}
+
+			key := module.Title + "/" + event.Id
+			free := event.CurrentCapacity < event.MaxCapacity
+			wasFree := t.free[key]
+			t.free[key] = free
+
+			if !free {
+				delete(t.failures, key)
+				delete(t.retryAt, key)
+				continue
+			}
+			// a seat is only handled again, if the registration for it failed and the backoff is over
+			if retryAt, retrying := t.retryAt[key]; wasFree && (!retrying || time.Now().Before(retryAt)) {
+				continue
+			}
+
+			seat := Seat{
+				Module: module,
+				Event:  event,
+			}
+			// module registration link is empty, if the user is already registered
+			if w.AutoRegister && module.RegistrationLink != "" {
+				w.register(session, &seat)
+				if seat.Registered {
+					delete(t.failures, key)
+					delete(t.retryAt, key)
+				} else {
+					t.failures[key]++
+					t.retryAt[key] = time.Now().Add(w.nextPollIn(t.failures[key] - 1))
+				}
+			}
+			if w.OnSeat != nil {
+				w.OnSeat(seat)
+			}
+			if seat.Registered {
+				break
+			}
+		}
+	}
+}
+
+/*
+Run polls the watched categories until the passed context is cancelled, the error of the context is returned.
+
+Free seats are reported with OnSeat. An event is reported again, after it was fully booked in the meantime.
+If an automatic registration fails, it is attempted and reported again on a later poll, while the seat is still free,
+the time between the attempts doubles like the interval after failed polls.
+During a STiNE maintenance with an announced end, polling pauses until the end, if PauseForMaintenance is set.
+A session logged in with LoginWithProvider is logged in again, if it expired, the session number of the passed session is updated.
+*/
+func (w *Watcher) Run(ctx context.Context) error {
+	var failures int
+	checkedAt := time.Now()
+
+	// every request of the polls and registrations is sent with the limited session
+	session := w.limitedSession(ctx)
+	categories := make([]stineapi.Category, len(w.targets))
+	attachedTo := ""
+
+	for {
+		// failed polls could be caused by an expired session
+		if w.KeepAlive > 0 && (time.Since(checkedAt) >= w.KeepAlive || failures > 0) {
+			_, err := session.ReloginIfExpired()
+			if err != nil {
+				log.Println("Unable to log in again:", err)
+			}
+			checkedAt = time.Now()
+		}
+		// the categories are refreshed with the session number of the current session, registrations could have logged in again as well
+		if session.SessionNo != attachedTo {
+			for i, t := range w.targets {
+				categories[i] = session.Attach(t.category)
+			}
+			attachedTo = session.SessionNo
+			w.session.SessionNo = session.SessionNo
+		}
+
+		failed := false
+		var maintenanceUntil time.Time
+
+		for i, t := range w.targets {
+			refreshed, err := categories[i].Refresh(0)
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			var maintenanceErr *stineapi.MaintenanceError
+			if w.PauseForMaintenance && errors.As(err, &maintenanceErr) && !maintenanceErr.Until.IsZero() {
+				// the other categories are unavailable as well
+				log.Println("STiNE is down for maintenance, pausing until", maintenanceErr.Until)
+				maintenanceUntil = maintenanceErr.Until
+				// if the maintenance takes longer than announced, the polls back off as usual
+				failed = true
+				break
+			}
+			if err != nil {
+				log.Println("Unable to refresh category", t.category.Title, err)
+				failed = true
+				continue
+			}
+			w.check(session, t, refreshed)
+		}
+
+		if failed {
+			failures++
+		} else {
+			failures = 0
+		}
+
+		wait := w.nextPollIn(failures)
+		if untilEnd := time.Until(maintenanceUntil); untilEnd > wait {
+			wait = untilEnd
+		}
+		err := sleep(ctx, wait)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// sleep blocks for the passed duration or until the context is cancelled
+func sleep(ctx context.Context, duration time.Duration) error {
+	timer := time.NewTimer(duration)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,423 @@
+package watcher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/martenmatrix/stine-api/cmd"
+	"github.com/martenmatrix/stine-api/cmd/stinetest"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+)
+
+// rewriteTransport sends every request to the test server instead of STiNE
+type rewriteTransport struct {
+	target *url.URL
+}
+
+func (t *rewriteTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	rewritten := req.Clone(req.Context())
+	rewritten.URL.Scheme = t.target.Scheme
+	rewritten.URL.Host = t.target.Host
+	return http.DefaultTransport.RoundTrip(rewritten)
+}
+
+const categoryPage = `
+	<table>
+	<tbody>
+	<tr>
+		<!-- MODULE -->
+		<td class="tbsubhead dl-inner">
+			<p><strong><a href="/scripts/module">InfB-SE 2 <span class="eventTitle">Software Development II (SuSe 23)</span></a></strong></p>
+			<p>Peter Lustig</p>
+		</td>
+		<td class="tbsubhead rw-qbf">
+			<a href="/scripts/register" class="img noFloat register">Register</a>
+		</td>
+	</tr>
+	<tr>
+		<!--logo column-->
+		<td class="tbdata dl-inner">
+			<p><strong><a href="/scripts/event" name="eventLink">64-012 <span class="eventTitle">Exercises Software Development II</span></a></strong></p>
+		</td>
+		<td class="tbdata">
+			07.03.2024<br>20 | %d
+		</td>
+	</tr>
+	</tbody>
+	</table>
+`
+
+func newFakeSTiNE(t *testing.T, freeAfterPolls int, tanSent *string) *httptest.Server {
+	var mu sync.Mutex
+	var polls int
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		switch {
+		case r.URL.Path == "/scripts/register" && r.Method == http.MethodGet:
+			w.Write([]byte(`<input name="rgtr_id" value="2132134"/>`))
+		case r.URL.Path == "/scripts/register" && r.Method == http.MethodPost:
+			err := r.ParseForm()
+			if err != nil {
+				t.Errorf("ERROR: %s", err)
+			}
+			if r.Form.Has("tan_code") {
+				*tanSent = r.Form.Get("tan_code")
+				return
+			}
+			w.Write([]byte(`<span class="itan"> 54</span>`))
+		default:
+			booked := 20
+			if polls >= freeAfterPolls {
+				booked = 19
+			}
+			polls++
+			w.Write([]byte(fmt.Sprintf(categoryPage, booked)))
+		}
+	}))
+}
+
+func newTestSession(server *httptest.Server) stineapi.Session {
+	serverURL, _ := url.Parse(server.URL)
+	session := stineapi.NewSession()
+	session.Client = &http.Client{Transport: &rewriteTransport{target: serverURL}}
+	session.SessionNo = "342424"
+	return session
+}
+
+func TestRunAutoRegister(t *testing.T) {
+	var tanSent string
+	fakeServer := newFakeSTiNE(t, 2, &tanSent)
+	defer fakeServer.Close()
+
+	session := newTestSession(fakeServer)
+	category, err := session.GetCategories(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var seats []Seat
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	w := New(&session)
+	w.Interval = 10 * time.Millisecond
+	w.Jitter = 0
+	w.AutoRegister = true
+	w.TanCallback = func(tanReq *stineapi.TanRequired) (string, error) {
+		return tanReq.TanStartsWith + "3423", nil
+	}
+	w.OnSeat = func(seat Seat) {
+		seats = append(seats, seat)
+		cancel()
+	}
+	w.Watch(category, "64-012")
+
+	err = w.Run(ctx)
+	if err != context.Canceled {
+		t.Errorf("WANT: %s, GOT: %s", context.Canceled, err)
+	}
+
+	if len(seats) != 1 {
+		t.Fatalf("expected exactly one free seat, received %d", len(seats))
+	}
+	if seats[0].Err != nil {
+		t.Errorf(seats[0].Err.Error())
+	}
+	if !seats[0].Registered {
+		t.Error("user should have been registered for the module")
+	}
+	if seats[0].Event.Id != "64-012" {
+		t.Errorf("WANT: 64-012, GOT: %s", seats[0].Event.Id)
+	}
+	if tanSent != "3423" {
+		t.Errorf("itan was not sent correctly, WANT: 3423, GOT: %s", tanSent)
+	}
+}
+
+func TestRunWithoutTanCallback(t *testing.T) {
+	var tanSent string
+	fakeServer := newFakeSTiNE(t, 0, &tanSent)
+	defer fakeServer.Close()
+
+	session := newTestSession(fakeServer)
+	category, err := session.GetCategories(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var seats []Seat
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	w := New(&session)
+	w.AutoRegister = true
+	w.OnSeat = func(seat Seat) {
+		seats = append(seats, seat)
+		cancel()
+	}
+	// watch by module title
+	w.Watch(category, "Software Development II (SuSe 23)")
+
+	w.Run(ctx)
+
+	if len(seats) != 1 {
+		t.Fatalf("expected exactly one free seat, received %d", len(seats))
+	}
+	if seats[0].Err != ErrNoTanCallback {
+		t.Errorf("WANT: %s, GOT: %s", ErrNoTanCallback, seats[0].Err)
+	}
+	if seats[0].Registered {
+		t.Error("user should not be registered without an itan")
+	}
+}
+
+func TestRunRetriesRejectedRegistration(t *testing.T) {
+	var mu sync.Mutex
+	var attempts int
+	fakeServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		switch {
+		case r.URL.Path == "/scripts/register" && r.Method == http.MethodGet:
+			w.Write([]byte(`<input name="rgtr_id" value="2132134"/>`))
+		case r.URL.Path == "/scripts/register" && r.Method == http.MethodPost:
+			attempts++
+			if attempts == 1 {
+				w.Write([]byte(`<div class="error">Die Veranstaltung ist ausgebucht</div>`))
+			}
+		default:
+			w.Write([]byte(fmt.Sprintf(categoryPage, 19)))
+		}
+	}))
+	defer fakeServer.Close()
+
+	session := newTestSession(fakeServer)
+	category, err := session.GetCategories(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var seats []Seat
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	w := New(&session)
+	w.Interval = 10 * time.Millisecond
+	w.Jitter = 0
+	w.AutoRegister = true
+	w.OnSeat = func(seat Seat) {
+		seats = append(seats, seat)
+		if seat.Registered {
+			cancel()
+		}
+	}
+	w.Watch(category, "64-012")
+
+	w.Run(ctx)
+
+	if len(seats) != 2 {
+		t.Fatalf("expected the seat to be reported for both registration attempts, received %d", len(seats))
+	}
+	if !errors.Is(seats[0].Err, stineapi.ErrRegistrationRejected) {
+		t.Errorf("WANT: %s, GOT: %s", stineapi.ErrRegistrationRejected, seats[0].Err)
+	}
+	if seats[0].Registered {
+		t.Error("user should not be registered, after stine rejected the registration")
+	}
+	if seats[1].Err != nil {
+		t.Errorf(seats[1].Err.Error())
+	}
+	if !seats[1].Registered {
+		t.Error("user should have been registered on the second attempt")
+	}
+}
+
+func TestRunCountsRegistrationRequests(t *testing.T) {
+	var tanSent string
+	fakeServer := newFakeSTiNE(t, 0, &tanSent)
+	defer fakeServer.Close()
+
+	session := newTestSession(fakeServer)
+	category, err := session.GetCategories(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var seats []Seat
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+
+	// the poll and the registration need 4 requests, the last one has to wait for the next minute
+	w := New(&session)
+	w.MaxRequestsPerMinute = 3
+	w.AutoRegister = true
+	w.TanCallback = func(tanReq *stineapi.TanRequired) (string, error) {
+		return tanReq.TanStartsWith + "3423", nil
+	}
+	w.OnSeat = func(seat Seat) {
+		seats = append(seats, seat)
+	}
+	w.Watch(category, "64-012")
+
+	err = w.Run(ctx)
+	if err != context.DeadlineExceeded {
+		t.Errorf("WANT: %s, GOT: %s", context.DeadlineExceeded, err)
+	}
+
+	if tanSent != "" {
+		t.Error("itan was sent, although the request limit per minute was reached")
+	}
+	if len(seats) != 1 {
+		t.Fatalf("expected exactly one free seat, received %d", len(seats))
+	}
+	if seats[0].Registered {
+		t.Error("user should not be registered, before the request limit allows it")
+	}
+	if len(w.requests) != 3 {
+		t.Errorf("WANT: 3 requests within the last minute, GOT: %d", len(w.requests))
+	}
+}
+
+func TestRunPausesForMaintenance(t *testing.T) {
+	// stine announces the end in its own time zone
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skip("time zone database is not available")
+	}
+
+	var mu sync.Mutex
+	var polls int
+	maintenance := false
+	fakeServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if maintenance {
+			polls++
+			end := time.Now().Add(time.Hour).In(berlin).Format("02.01.2006 15:04")
+			w.Write([]byte("<html><body><h1>Wartungsarbeiten</h1><p>STiNE ist bis " + end + " Uhr nicht erreichbar.</p></body></html>"))
+			return
+		}
+		w.Write([]byte(fmt.Sprintf(categoryPage, 20)))
+	}))
+	defer fakeServer.Close()
+
+	session := newTestSession(fakeServer)
+	session.SetMaintenanceDetection(true)
+	category, err := session.GetCategories(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mu.Lock()
+	maintenance = true
+	mu.Unlock()
+
+	w := New(&session)
+	w.Interval = 10 * time.Millisecond
+	w.Jitter = 0
+	w.Watch(category)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	w.Run(ctx)
+
+	mu.Lock()
+	defer mu.Unlock()
+	if polls != 1 {
+		t.Errorf("watcher should pause until the end of the maintenance, WANT: 1 poll, GOT: %d", polls)
+	}
+}
+
+func TestWaitForRequestSlot(t *testing.T) {
+	w := New(nil)
+	w.MaxRequestsPerMinute = 2
+	w.requests = []time.Time{time.Now().Add(-59900 * time.Millisecond), time.Now()}
+
+	start := time.Now()
+	err := w.waitForRequestSlot(context.Background())
+	if err != nil {
+		t.Errorf(err.Error())
+	}
+
+	if time.Since(start) < 50*time.Millisecond {
+		t.Error("request limit per minute was exceeded")
+	}
+	if len(w.requests) != 2 {
+		t.Errorf("expected 2 requests within the last minute, received %d", len(w.requests))
+	}
+}
+
+func TestNextPollIn(t *testing.T) {
+	w := New(nil)
+	w.Interval = time.Minute
+	w.Jitter = 0
+	w.MaxBackoff = 5 * time.Minute
+
+	if wait := w.nextPollIn(0); wait != time.Minute {
+		t.Errorf("WANT: 1m, GOT: %s", wait)
+	}
+	if wait := w.nextPollIn(2); wait != 4*time.Minute {
+		t.Errorf("WANT: 4m, GOT: %s", wait)
+	}
+	if wait := w.nextPollIn(10); wait != 5*time.Minute {
+		t.Errorf("WANT: 5m, GOT: %s", wait)
+	}
+
+	w.Jitter = 10 * time.Second
+	if wait := w.nextPollIn(0); wait < 50*time.Second || wait > 70*time.Second {
+		t.Errorf("jitter exceeds 10s, GOT: %s", wait)
+	}
+}
+
+func TestRunLogsInAgain(t *testing.T) {
+	server := stinetest.NewServer(stinetest.Config{
+		Username: "BBB1234",
+		Password: "password",
+		Modules:  []stinetest.Module{{Title: "Software Development II", Events: []stinetest.Event{{Id: "64-010", Title: "Lecture", MaxCapacity: 20, CurrentCapacity: 19}}}},
+	})
+	defer server.Close()
+
+	session := stineapi.NewSession()
+	session.Client = server.Client()
+	if err := session.LoginWithProvider(stineapi.Credentials{Username: "BBB1234", Password: "password"}, ""); err != nil {
+		t.Fatal(err)
+	}
+	category, err := session.GetCategories(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expired := session.SessionNo
+	server.ExpireSessions()
+
+	var seats []Seat
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	w := New(&session)
+	w.Interval = 10 * time.Millisecond
+	w.Jitter = 0
+	w.KeepAlive = 20 * time.Millisecond
+	w.OnSeat = func(seat Seat) {
+		seats = append(seats, seat)
+		cancel()
+	}
+	w.Watch(category, "64-010")
+
+	w.Run(ctx)
+
+	if len(seats) != 1 {
+		t.Fatalf("the free seat should be detected with the new session, received %d seats", len(seats))
+	}
+	if session.SessionNo == expired {
+		t.Error("session number of the passed session should be updated after the re-login")
+	}
+}
@@ -7,6 +7,10 @@ require (
 	github.com/google/go-cmp v0.6.0
 	github.com/luci/go-render v0.0.0-20160219211803-9a04cc21af0f
 	golang.org/x/net v0.16.0
+	golang.org/x/term v0.13.0
 )
 
-require github.com/andybalholm/cascadia v1.3.1 // indirect
+require (
+	github.com/andybalholm/cascadia v1.3.1 // indirect
+	golang.org/x/sys v0.13.0 // indirect
+)